@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/core"
@@ -19,38 +23,78 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"add": func(args []string) {
-		if len(args) < 1 {
-			fmt.Println("Usage: kitkat add <file-path>")
+		all, patch := false, false
+		var specs []string
+		for i, arg := range args {
+			if arg == "--" {
+				specs = append(specs, args[i+1:]...)
+				break
+			}
+			if arg == "-A" || arg == "--all" {
+				all = true
+				continue
+			}
+			if arg == "-p" || arg == "--patch" {
+				patch = true
+				continue
+			}
+			specs = append(specs, arg)
+		}
+		if (!all && !patch && len(specs) == 0) || (all && patch) {
+			fmt.Println("Usage: kitkat add [-A] <pathspec>... | add -p [<pathspec>...]")
 			os.Exit(2)
 		}
-		if args[0] == "-A" || args[0] == "--all" {
-			fmt.Println("Staging all changes...")
-			if err := core.AddAll(); err != nil {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+		ps := mustParsePathspec(specs)
+		if patch {
+			if err := core.AddPatch(ps); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
 			os.Exit(0)
 		}
-		exitCode := 0
-		for _, path := range args {
-			if err := core.AddFile(path); err != nil {
-				fmt.Printf("Error adding %s: %v\n", path, err)
-				exitCode = 1
-			}
+		if all && len(specs) == 0 {
+			fmt.Println("Staging all changes...")
 		}
-		os.Exit(exitCode)
+		if err := core.AddPaths(ps); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	},
 	"rm": func(args []string) {
-		if len(args) < 1 {
-			fmt.Println("Usage: kitkat rm <file>")
+		recursive := false
+		var specs []string
+		for i, arg := range args {
+			if arg == "--" {
+				specs = append(specs, args[i+1:]...)
+				break
+			}
+			if arg == "-r" {
+				recursive = true
+				continue
+			}
+			specs = append(specs, arg)
+		}
+		if len(specs) == 0 {
+			fmt.Println("Usage: kitkat rm [-r] <pathspec>...")
 			os.Exit(2)
 		}
-		filename := args[0]
-		if err := core.RemoveFile(filename); err != nil {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+		removed, err := core.RemovePaths(mustParsePathspec(specs), recursive)
+		for _, path := range removed {
+			fmt.Printf("Removed '%s'\n", path)
+		}
+		if err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
-		fmt.Printf("Removed '%s'\n", filename)
 		os.Exit(0)
 	},
 	"commit": func(args []string) {
@@ -59,82 +103,188 @@ var commands = map[string]CommandFunc{
 			os.Exit(1)
 		}
 
-		if len(args) < 2 {
-			fmt.Println("Usage: kitkat commit <-m | -am | --amend> <message>")
-			os.Exit(2)
-		}
-
-		var isAmend bool
-		var message string
-
-		switch args[0] {
-		// Checks for amending
-		case "--amend":
-			if len(args) < 3 || args[1] != "-m" {
-				fmt.Println("Usage: kitkat commit --amend -m <message>")
+		const usage = "Usage: kitkat commit [-a] [--amend [--no-edit] [--reset-author]] [--allow-empty] [--allow-empty-message] [--dry-run] [-e] [-s] [--trailer <key>=<value>] [--author=<author>] [--date=<date>] [-m <message> | -F <file> | -t <file>] [-- <message words>]"
+		var opts core.CommitOptions
+		var edit, noEdit, dryRun bool
+		var paragraphs []string
+		var messageFile string
+		// addWord adds a word to the paragraph the last -m started, so the
+		// message need not be quoted
+		addWord := func(word string) {
+			if len(paragraphs) == 0 {
+				fmt.Println(usage)
 				os.Exit(2)
 			}
-			isAmend = true
-			message = strings.Join(args[2:], " ")
-		// Normal commit flow
-		case "-am":
-			message = strings.Join(args[1:], " ")
-			newCommit, summary, err := core.CommitAll(message)
-			if err != nil {
-				if err.Error() == "nothing to commit, working tree clean" {
-					fmt.Println(err.Error())
-					os.Exit(1)
+			last := &paragraphs[len(paragraphs)-1]
+			if *last != "" {
+				*last += " "
+			}
+			*last += word
+		}
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			// After "--" every word is part of the message, even one starting with '-'
+			if arg == "--" {
+				for _, word := range args[i+1:] {
+					addWord(word)
 				}
+				break
+			}
+			// Flags that take a value, given as the next argument or after '='
+			name, value, hasValue := strings.Cut(arg, "=")
+			switch name {
+			case "--author", "--date", "-F", "--file", "-t", "--template", "--trailer":
+				if !hasValue {
+					if i+1 >= len(args) {
+						fmt.Printf("Error: %s requires a value\n", name)
+						os.Exit(2)
+					}
+					i++
+					value = args[i]
+				}
+				switch name {
+				case "--author":
+					opts.Author = value
+				case "--date":
+					opts.Date = value
+				case "-F", "--file":
+					messageFile = value
+				case "--trailer":
+					trailer, err := core.ParseTrailerArg(value)
+					if err != nil {
+						fmt.Println("Error:", err)
+						os.Exit(2)
+					}
+					opts.Trailers = append(opts.Trailers, trailer)
+				default:
+					opts.Template = value
+				}
+				continue
+			}
+			switch {
+			case arg == "-m" || arg == "-am":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				// Each -m adds a paragraph, starting with the argument after it
+				opts.All = opts.All || arg == "-am"
+				i++
+				paragraphs = append(paragraphs, args[i])
+			case arg == "-a" || arg == "--all":
+				opts.All = true
+			case arg == "-e" || arg == "--edit":
+				edit = true
+			case arg == "-s" || arg == "--signoff":
+				opts.Signoff = true
+			case arg == "--amend":
+				opts.Amend = true
+			case arg == "--no-edit":
+				noEdit = true
+			case arg == "--reset-author":
+				opts.ResetAuthor = true
+			case arg == "--allow-empty":
+				opts.AllowEmpty = true
+			case arg == "--allow-empty-message":
+				opts.AllowEmptyMessage = true
+			case arg == "--dry-run":
+				dryRun = true
+			case strings.HasPrefix(arg, "-"):
+				fmt.Printf("Error: unknown flag %s (quote the message, or put words starting with '-' after --)\n", arg)
 				os.Exit(2)
+			default:
+				addWord(arg)
 			}
-			printCommitResult(newCommit, summary)
-			os.Exit(0)
-		case "-m":
-			message = strings.Join(args[1:], " ")
-		default:
-			fmt.Println("Usage: kitkat commit <-m | -am | --amend> <message>")
+		}
+		message := strings.Join(paragraphs, "\n\n")
+		if messageFile != "" {
+			if len(paragraphs) > 0 {
+				fmt.Println("Error: options -m and -F cannot be used together")
+				os.Exit(2)
+			}
+			var content []byte
+			var err error
+			if messageFile == "-" {
+				content, err = io.ReadAll(os.Stdin)
+			} else {
+				content, err = os.ReadFile(messageFile)
+			}
+			if err != nil {
+				fmt.Println("Error: could not read log file:", err)
+				os.Exit(1)
+			}
+			message = string(content)
+		}
+		// Without a message the editor is opened to write one, unless
+		// --no-edit keeps the message of the commit being amended
+		opts.Edit = edit || (len(paragraphs) == 0 && messageFile == "" && !(noEdit && opts.Amend))
+		if noEdit && edit {
+			fmt.Println("Error: options --edit and --no-edit cannot be used together")
+			os.Exit(2)
+		}
+		if opts.ResetAuthor && !opts.Amend {
+			fmt.Println("Error: --reset-author can be used only with --amend")
 			os.Exit(2)
 		}
 
-		// Handle amend or normal commit
-		if isAmend {
-			newCommit, err := core.AmendCommit(message)
+		if dryRun {
+			ok, err := core.CommitDryRun(opts)
 			if err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
-			headState, err := core.GetHeadState()
-			if err != nil {
-				headData, _ := os.ReadFile(".kitkat/HEAD")
-				ref := strings.TrimSpace(string(headData))
-				headState = strings.TrimPrefix(ref, "ref: refs/heads/")
+			if !ok {
+				os.Exit(1)
 			}
-			fmt.Printf("[%s %s] %s (amended)\n", headState, newCommit.ID[:7], newCommit.Message)
 			os.Exit(0)
-		} else {
-			newCommit, summary, err := core.Commit(message)
-			if err != nil {
-				if err.Error() == "nothing to commit, working tree clean" {
-					fmt.Println(err.Error())
-					os.Exit(1)
-				} else {
-					fmt.Println("Error:", err)
-					os.Exit(1)
-				}
+		}
+
+		newCommit, summary, err := core.CommitWithOptions(message, opts)
+		if err != nil {
+			if err.Error() == "nothing to commit, working tree clean" {
+				fmt.Println(err.Error())
+				os.Exit(1)
 			}
-			printCommitResult(newCommit, summary)
-			os.Exit(0)
+			fmt.Println("Error:", err)
+			os.Exit(1)
 		}
+		printCommitResult(newCommit, summary)
+		os.Exit(0)
 	},
 	"log": func(args []string) {
-		oneline := false
-		limit := -1
+		opts := core.LogOptions{Limit: -1}
+		var paths []string
 		i := 0
 		for i < len(args) {
+			ok, err := parseDiffFlag(args[i], &opts.Diff)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(2)
+			}
+			if ok {
+				opts.ShowDiff = true
+				i++
+				continue
+			}
 			switch args[i] {
 			case "--oneline":
-				oneline = true
+				opts.Oneline = true
+				i++
+			case "-p", "--patch":
+				opts.ShowDiff = true
+				opts.Diff.Format = core.DiffPatch
 				i++
+			case "--":
+				paths = args[i+1:]
+				i = len(args)
+			case "--trailer":
+				if i+1 >= len(args) {
+					fmt.Println("Error: --trailer requires <key>[=<value>]")
+					os.Exit(2)
+				}
+				key, value, _ := strings.Cut(args[i+1], "=")
+				opts.Trailers = append(opts.Trailers, core.TrailerFilter{Key: key, Value: value})
+				i += 2
 			case "-n":
 				if i+1 >= len(args) {
 					fmt.Println("Error: -n requires a positive integer argument")
@@ -146,18 +296,120 @@ var commands = map[string]CommandFunc{
 					fmt.Println("Error: -n requires a positive integer argument")
 					os.Exit(2)
 				}
-				limit = n
+				opts.Limit = n
 				i += 2
 			default:
-				fmt.Printf("Error: unknown flag %s\n", args[i])
-				os.Exit(2)
+				if filter, ok := strings.CutPrefix(args[i], "--trailer="); ok {
+					key, value, _ := strings.Cut(filter, "=")
+					opts.Trailers = append(opts.Trailers, core.TrailerFilter{Key: key, Value: value})
+					i++
+					continue
+				}
+				format, ok := strings.CutPrefix(args[i], "--format=")
+				if !ok {
+					format, ok = strings.CutPrefix(args[i], "--pretty=")
+				}
+				if !ok {
+					fmt.Printf("Error: unknown flag %s\n", args[i])
+					os.Exit(2)
+				}
+				// "format:" and "tformat:" introduce a format string, as in git
+				if rest, ok := strings.CutPrefix(format, "format:"); ok {
+					format = rest
+				} else if rest, ok := strings.CutPrefix(format, "tformat:"); ok {
+					format = rest
+				}
+				if format == "oneline" {
+					opts.Oneline = true
+				} else if slices.Contains(core.LogFormats, format) || core.IsFormatString(format) {
+					opts.Format = format
+				} else {
+					fmt.Printf("Error: invalid --format: %s\n", format)
+					os.Exit(2)
+				}
+				i++
+			}
+		}
+		if len(paths) > 0 {
+			if !core.IsRepoInitialized() {
+				fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+				os.Exit(1)
 			}
+			opts.Paths = mustParsePathspec(paths)
 		}
-		if err := core.ShowLog(oneline, limit); err != nil {
+		if err := core.ShowLog(opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 	},
+	"interpret-trailers": func(args []string) {
+		var trailers []core.Trailer
+		var files []string
+		onlyTrailers, inPlace := false, false
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--trailer":
+				if i+1 >= len(args) {
+					fmt.Println("Error: --trailer requires <key>=<value>")
+					os.Exit(2)
+				}
+				i++
+				arg = "--trailer=" + args[i]
+				fallthrough
+			case strings.HasPrefix(arg, "--trailer="):
+				trailer, err := core.ParseTrailerArg(strings.TrimPrefix(arg, "--trailer="))
+				if err != nil {
+					fmt.Println("Error:", err)
+					os.Exit(2)
+				}
+				trailers = append(trailers, trailer)
+			case arg == "--parse" || arg == "--only-trailers":
+				onlyTrailers = true
+			case arg == "--in-place":
+				inPlace = true
+			case strings.HasPrefix(arg, "-"):
+				fmt.Printf("Error: unknown flag %s\n", arg)
+				os.Exit(2)
+			default:
+				files = append(files, arg)
+			}
+		}
+		if inPlace && len(files) == 0 {
+			fmt.Println("Error: --in-place requires a file")
+			os.Exit(2)
+		}
+		// Only the trailers would be left in the file
+		if inPlace && onlyTrailers {
+			fmt.Println("Error: --in-place cannot be used with --parse or --only-trailers")
+			os.Exit(2)
+		}
+		if len(files) == 0 {
+			content, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			fmt.Print(core.InterpretTrailers(string(content), trailers, onlyTrailers))
+			os.Exit(0)
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			result := core.InterpretTrailers(string(content), trailers, onlyTrailers)
+			if !inPlace {
+				fmt.Print(result)
+				continue
+			}
+			if err := os.WriteFile(file, []byte(result), 0644); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+	},
 	"shortlog": func(args []string) {
 		if err := core.ShowShortLog(); err != nil {
 			fmt.Println("Error:", err)
@@ -165,59 +417,251 @@ var commands = map[string]CommandFunc{
 		}
 	},
 	"status": func(args []string) {
-		if err := core.Status(); err != nil {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+		if err := core.Status(mustParsePathspec(args)); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 	},
 	"diff": func(args []string) {
 		staged := false
-		if len(args) > 0 {
-			if args[0] == "--cached" || args[0] == "--staged" {
+		var opts core.DiffOptions
+		for _, arg := range args {
+			ok, err := parseDiffFlag(arg, &opts)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(2)
+			}
+			if ok {
+				continue
+			}
+			switch arg {
+			case "--cached", "--staged":
 				staged = true
+			default:
+				fmt.Printf("Error: unknown flag %s\n", arg)
+				os.Exit(2)
 			}
 		}
-		if err := core.Diff(staged); err != nil {
+		if err := core.Diff(staged, opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 	},
 	"checkout": func(args []string) {
-		if len(args) < 1 {
-			fmt.Println("Usage: kitkat checkout [-b] <branch-name> | <file-path>")
+		usage := "Usage: kitkat checkout [-f | -m] [-b <new-branch>] <branch> | [-p] [--] <pathspec>..."
+		var opts core.CheckoutOptions
+		var newBranch string
+		patch := false
+		var rest, specs []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "--":
+				specs = append(specs, args[i+1:]...)
+				i = len(args)
+			case "-f", "--force":
+				opts.Force = true
+			case "-m", "--merge":
+				opts.Merge = true
+			case "-p", "--patch":
+				patch = true
+			case "-b":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				newBranch = args[i]
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		if opts.Force && opts.Merge {
+			fmt.Println("Error: -f and -m cannot be used together")
 			os.Exit(2)
 		}
-		if args[0] == "-b" {
-			if len(args) != 2 {
-				fmt.Println("Usage: kitkat checkout -b <branch-name>")
+		if patch {
+			if newBranch != "" || opts.Force || opts.Merge {
+				fmt.Println(usage)
 				os.Exit(2)
 			}
-			name := args[1]
-			if core.IsBranch(name) {
-				fmt.Printf("Error: Branch '%s' already exists\n", name)
+			if !core.IsRepoInitialized() {
+				fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
 				os.Exit(1)
 			}
-			if err := core.CreateBranch(name); err != nil {
+			if err := core.CheckoutPatch(mustParsePathspec(append(rest, specs...))); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
-			if err := core.CheckoutBranch(name); err != nil {
+			os.Exit(0)
+		}
+		if newBranch != "" {
+			if len(rest) != 0 {
+				fmt.Println(usage)
+				os.Exit(2)
+			}
+			if core.IsBranch(newBranch) {
+				fmt.Printf("Error: Branch '%s' already exists\n", newBranch)
+				os.Exit(1)
+			}
+			if err := core.CreateBranch(newBranch); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
-			os.Exit(0)
-		}
-		name := args[0]
-		if core.IsBranch(name) {
-			if err := core.CheckoutBranch(name); err != nil {
+			if err := core.CheckoutBranch(newBranch, opts); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
-		} else {
-			if err := core.CheckoutFile(name); err != nil {
+			os.Exit(0)
+		}
+		if len(rest) == 1 && len(specs) == 0 && core.IsBranch(rest[0]) {
+			if err := core.CheckoutBranch(rest[0], opts); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
+			os.Exit(0)
+		}
+
+		// Anything else names files to restore
+		specs = append(rest, specs...)
+		if len(specs) == 0 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+		if err := core.CheckoutPaths(mustParsePathspec(specs)); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+	"switch": func(args []string) {
+		usage := "Usage: kitkat switch [-f | -m] <branch> | switch -c <new-branch> [<start-point>] | switch --detach <commit>"
+		var opts core.CheckoutOptions
+		var newBranch string
+		detach := false
+		var rest []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "-f", "--force", "--discard-changes":
+				opts.Force = true
+			case "-m", "--merge":
+				opts.Merge = true
+			case "-d", "--detach":
+				detach = true
+			case "-c", "--create":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				newBranch = args[i]
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		if opts.Force && opts.Merge {
+			fmt.Println("Error: -f and -m cannot be used together")
+			os.Exit(2)
+		}
+		if len(rest) > 1 || (newBranch == "" && len(rest) == 0) || (newBranch != "" && detach) {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+
+		var err error
+		switch {
+		case newBranch != "":
+			start := ""
+			if len(rest) == 1 {
+				start = rest[0]
+			}
+			if err = core.SwitchNewBranch(newBranch, start, opts); err == nil {
+				fmt.Printf("Switched to a new branch '%s'\n", newBranch)
+			}
+		case detach:
+			var commitHash string
+			if commitHash, err = core.ResolveRevision(rest[0]); err == nil {
+				err = core.CheckoutCommit(commitHash, opts)
+			}
+			if err == nil {
+				fmt.Printf("HEAD is now at %s\n", commitHash[:7])
+			}
+		default:
+			if err = core.SwitchBranch(rest[0], opts); err == nil {
+				fmt.Printf("Switched to branch '%s'\n", rest[0])
+			}
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+	"restore": func(args []string) {
+		var opts core.RestoreOptions
+		var specs []string
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "--":
+				specs = append(specs, args[i+1:]...)
+				i = len(args)
+			case arg == "-S" || arg == "--staged":
+				opts.Staged = true
+			case arg == "-W" || arg == "--worktree":
+				opts.Worktree = true
+			case arg == "-s" || arg == "--source":
+				if i+1 >= len(args) {
+					fmt.Println("Error: --source requires a commit")
+					os.Exit(2)
+				}
+				i++
+				opts.Source = args[i]
+			case strings.HasPrefix(arg, "--source="):
+				opts.Source = strings.TrimPrefix(arg, "--source=")
+			default:
+				specs = append(specs, arg)
+			}
+		}
+		if len(specs) == 0 {
+			fmt.Println("Usage: kitkat restore [--source=<commit>] [--staged] [--worktree] [--] <pathspec>...")
+			os.Exit(2)
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+		if err := core.Restore(mustParsePathspec(specs), opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	},
+	"recover": func(args []string) {
+		rollback := false
+		for _, arg := range args {
+			switch arg {
+			case "--rollback":
+				rollback = true
+			default:
+				fmt.Println("Usage: kitkat recover [--rollback]")
+				os.Exit(2)
+			}
+		}
+		if err := core.RecoverCheckout(rollback); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
 		}
 	},
 	"merge": func(args []string) {
@@ -232,24 +676,103 @@ var commands = map[string]CommandFunc{
 		os.Exit(0)
 	},
 	"reset": func(args []string) {
-		if len(args) < 2 {
-			fmt.Println("Usage: kitkat reset --hard <commit-hash>")
-			os.Exit(2)
+		if len(args) > 0 && (args[0] == "-p" || args[0] == "--patch") {
+			if !core.IsRepoInitialized() {
+				fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+				os.Exit(1)
+			}
+			// An optional commit comes first; everything else is a pathspec
+			rev, specs := "", args[1:]
+			if dash := slices.Index(specs, "--"); dash >= 0 {
+				if dash > 1 {
+					fmt.Println("Usage: kitkat reset -p [<commit>] [--] [<pathspec>...]")
+					os.Exit(2)
+				}
+				if dash == 1 {
+					rev = specs[0]
+				}
+				specs = specs[dash+1:]
+			} else if len(specs) > 0 {
+				if _, err := core.ResolveRevision(specs[0]); err == nil {
+					rev, specs = specs[0], specs[1:]
+				}
+			}
+			if err := core.ResetPatch(rev, mustParsePathspec(specs)); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		}
-		if args[0] != "--hard" {
-			fmt.Println("Error: only 'reset --hard' is currently supported")
-			fmt.Println("Usage: kitkat reset --hard <commit-hash>")
-			os.Exit(2)
+		usage := "Usage: kitkat reset [--soft | --mixed | --hard] [<commit>] | reset [<commit>] [--] <pathspec>..."
+		mode, modeSet := core.ResetMixed, false
+		var rest, specs []string
+		dashed := false
+		for i, arg := range args {
+			switch arg {
+			case "--":
+				specs, dashed = args[i+1:], true
+			case "--soft":
+				mode, modeSet = core.ResetSoft, true
+			case "--mixed":
+				mode, modeSet = core.ResetMixed, true
+			case "--hard":
+				mode, modeSet = core.ResetHard, true
+			default:
+				rest = append(rest, arg)
+				continue
+			}
+			if dashed {
+				break
+			}
+		}
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (run `kitkat init`)")
+			os.Exit(1)
+		}
+
+		// Without '--', a leading argument that names a commit is the commit;
+		// anything after it is a pathspec
+		rev := ""
+		if dashed {
+			if len(rest) > 1 {
+				fmt.Println(usage)
+				os.Exit(2)
+			}
+			if len(rest) == 1 {
+				rev = rest[0]
+			}
+		} else if len(rest) > 0 {
+			if _, err := core.ResolveRevision(rest[0]); err == nil || modeSet {
+				rev, specs = rest[0], rest[1:]
+			} else {
+				specs = rest
+			}
+		}
+
+		if len(specs) > 0 {
+			if modeSet {
+				fmt.Println("Error: cannot do a soft, mixed or hard reset with paths")
+				os.Exit(2)
+			}
+			if err := core.ResetPaths(rev, mustParsePathspec(specs)); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
 		}
-		if err := core.ResetHard(args[1]); err != nil {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		if err := core.Reset(rev, mode); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
 		os.Exit(0)
 	},
 	"rebase": func(args []string) {
+		usage := "Usage: kitkat rebase [-i] [--autosquash] [--onto <newbase>] <upstream> [<branch>] | rebase --continue | --skip | --abort | --edit-todo"
 		if len(args) < 1 {
-			fmt.Println("Usage: kitkat rebase [-i <commit> | --continue | --abort]")
+			fmt.Println(usage)
 			os.Exit(2)
 		}
 
@@ -266,21 +789,54 @@ var commands = map[string]CommandFunc{
 				os.Exit(1)
 			}
 			os.Exit(0)
-		case "-i":
-			if len(args) < 2 {
-				fmt.Println("Usage: kitkat rebase -i <commit>")
-				os.Exit(2)
+		case "--skip":
+			if err := core.RebaseSkip(); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
 			}
-			if err := core.RebaseInteractive(args[1]); err != nil {
+			os.Exit(0)
+		case "--edit-todo":
+			if err := core.RebaseEditTodo(); err != nil {
 				fmt.Println("Error:", err)
 				os.Exit(1)
 			}
 			os.Exit(0)
-		default:
-			// If no flag, assumes simple rebase which isn't requested but we can default to error
-			fmt.Println("Usage: kitkat rebase [-i <commit> | --continue | --abort]")
+		}
+
+		var opts core.RebaseOptions
+		var rest []string
+		for i := 0; i < len(args); i++ {
+			switch args[i] {
+			case "-i", "--interactive":
+				opts.Interactive = true
+			case "--autosquash":
+				opts.Autosquash = true
+			case "--no-autosquash":
+				opts.Autosquash = false
+			case "--onto":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				opts.Onto = args[i]
+			default:
+				rest = append(rest, args[i])
+			}
+		}
+		if len(rest) < 1 || len(rest) > 2 {
+			fmt.Println(usage)
 			os.Exit(2)
 		}
+		opts.Upstream = rest[0]
+		if len(rest) == 2 {
+			opts.Branch = rest[1]
+		}
+		if err := core.Rebase(opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	},
 	"ls-files": func(args []string) {
 		if !core.IsRepoInitialized() {
@@ -288,36 +844,41 @@ var commands = map[string]CommandFunc{
 			os.Exit(1)
 		}
 
-		entries, err := core.LoadIndex()
-		if err != nil {
+		if len(args) > 0 && args[0] == "--" {
+			args = args[1:]
+		}
+		if err := core.ListFiles(mustParsePathspec(args)); err != nil {
 			fmt.Println("Error loading index:", err)
 			os.Exit(1)
 		}
-
-		for _, entry := range entries {
-			fmt.Println(entry.Path)
-		}
 		os.Exit(0)
 	},
 	"clean": func(args []string) {
 		force := false
-		includeIgnored := false
+		var opts core.CleanOptions
 
 		for _, arg := range args {
 			switch arg {
 			case "-f":
 				force = true
+			case "-n", "--dry-run":
+				opts.DryRun = true
 			case "-x":
-				includeIgnored = true
+				opts.IncludeIgnored = true
+			case "-d":
+				opts.Directories = true
+			default:
+				fmt.Printf("Error: unknown flag %s\n", arg)
+				os.Exit(2)
 			}
 		}
 
-		if !force {
-			fmt.Println("This will delete untracked files. Run 'kitkat clean -f' to proceed.")
+		if !force && !opts.DryRun {
+			fmt.Println("This will delete untracked files. Run 'kitkat clean -f' to proceed, or 'kitkat clean -n' to see what would be removed.")
 			os.Exit(0)
 		}
 
-		if err := core.Clean(true, includeIgnored); err != nil {
+		if err := core.Clean(opts); err != nil {
 			fmt.Println("Error:", err)
 			os.Exit(1)
 		}
@@ -346,6 +907,35 @@ var commands = map[string]CommandFunc{
 			os.Exit(0)
 		}
 
+		if len(args) > 0 && args[0] == "-a" {
+			var name, message string
+			rev := "HEAD"
+			positional := 0
+			for i := 1; i < len(args); i++ {
+				if args[i] == "-m" && i+1 < len(args) {
+					message = args[i+1]
+					i++
+					continue
+				}
+				switch positional {
+				case 0:
+					name = args[i]
+				case 1:
+					rev = args[i]
+				}
+				positional++
+			}
+			if name == "" || message == "" || positional > 2 {
+				fmt.Println("Usage: kitkat tag -a <tag-name> [<commit>] -m <message>")
+				os.Exit(2)
+			}
+			if err := core.CreateAnnotatedTag(name, rev, message); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+			os.Exit(0)
+		}
+
 		if len(args) < 2 {
 			fmt.Println("Usage: kitkat tag <tag-name> <commit-id>")
 			os.Exit(2)
@@ -405,6 +995,158 @@ var commands = map[string]CommandFunc{
 		}
 		os.Exit(0)
 	},
+	"show": func(args []string) {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (or any of the parent directories): .kitkat")
+			os.Exit(1)
+		}
+
+		var opts core.DiffOptions
+		var revs []string
+		for _, arg := range args {
+			ok, err := parseDiffFlag(arg, &opts)
+			if err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(2)
+			}
+			if ok {
+				continue
+			}
+			if strings.HasPrefix(arg, "-") {
+				fmt.Printf("Error: unknown flag %s\n", arg)
+				os.Exit(2)
+			}
+			revs = append(revs, arg)
+		}
+		if len(revs) == 0 {
+			revs = []string{"HEAD"}
+		}
+
+		exitCode := 0
+		for _, rev := range revs {
+			if err := core.Show(rev, opts); err != nil {
+				fmt.Println("Error:", err)
+				exitCode = 1
+			}
+		}
+		os.Exit(exitCode)
+	},
+	"apply": func(args []string) {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (or any of the parent directories): .kitkat")
+			os.Exit(1)
+		}
+
+		var opts core.ApplyOptions
+		var patches []string
+		for _, arg := range args {
+			switch arg {
+			case "--check":
+				opts.Check = true
+			case "--cached":
+				opts.Cached = true
+			case "-R", "--reverse":
+				opts.Reverse = true
+			default:
+				if strings.HasPrefix(arg, "-") && arg != "-" {
+					fmt.Printf("Error: unknown flag %s\n", arg)
+					os.Exit(2)
+				}
+				patches = append(patches, arg)
+			}
+		}
+		if len(patches) == 0 {
+			fmt.Println("Usage: kitkat apply [--check] [--cached] [-R | --reverse] <patch>...")
+			os.Exit(2)
+		}
+
+		for _, patch := range patches {
+			if err := core.Apply(patch, opts); err != nil {
+				fmt.Println("Error:", err)
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	},
+	"format-patch": func(args []string) {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (or any of the parent directories): .kitkat")
+			os.Exit(1)
+		}
+
+		usage := "Usage: kitkat format-patch [-o <dir>] [--stdout] [-<n>] [<since> | <revision-range>]"
+		var opts core.FormatPatchOptions
+		for i := 0; i < len(args); i++ {
+			arg := args[i]
+			switch {
+			case arg == "-o" || arg == "--output-directory":
+				if i+1 >= len(args) {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				i++
+				opts.OutputDir = args[i]
+			case arg == "--stdout":
+				opts.Stdout = true
+			case len(arg) > 1 && arg[0] == '-':
+				n, err := strconv.Atoi(arg[1:])
+				if err != nil || n <= 0 {
+					fmt.Printf("Error: unknown flag %s\n", arg)
+					os.Exit(2)
+				}
+				opts.Count = n
+			default:
+				if opts.Range != "" {
+					fmt.Println(usage)
+					os.Exit(2)
+				}
+				opts.Range = arg
+			}
+		}
+		if opts.Range == "" && opts.Count == 0 {
+			fmt.Println(usage)
+			os.Exit(2)
+		}
+
+		if err := core.FormatPatch(opts); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
+	"am": func(args []string) {
+		if !core.IsRepoInitialized() {
+			fmt.Println("Error: not a kitkat repository (or any of the parent directories): .kitkat")
+			os.Exit(1)
+		}
+		if len(args) == 0 {
+			fmt.Println("Usage: kitkat am <mbox>... | --continue | --skip | --abort")
+			os.Exit(2)
+		}
+
+		var err error
+		switch args[0] {
+		case "--continue":
+			err = core.AmContinue()
+		case "--skip":
+			err = core.AmSkip()
+		case "--abort":
+			err = core.AmAbort()
+		default:
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "-") && arg != "-" {
+					fmt.Printf("Error: unknown flag %s\n", arg)
+					os.Exit(2)
+				}
+			}
+			err = core.Am(args)
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	},
 	"branch": func(args []string) {
 		if len(args) == 0 {
 			fmt.Println("Usage: kitkat branch [-l | -r <branch-name> | -d <branch-name>]")
@@ -482,6 +1224,57 @@ var commands = map[string]CommandFunc{
 	},
 }
 
+// parseDiffFlag applies a diff output flag shared by diff and log to opts.
+// It reports whether the flag was recognised.
+func parseDiffFlag(arg string, opts *core.DiffOptions) (bool, error) {
+	switch arg {
+	case "--stat":
+		opts.Format = core.DiffStat
+	case "--numstat":
+		opts.Format = core.DiffNumstat
+	case "--name-only":
+		opts.Format = core.DiffNameOnly
+	case "--name-status":
+		opts.Format = core.DiffNameStatus
+	case "--word-diff", "--word-diff=plain":
+		opts.WordDiff = core.WordDiffPlain
+	case "--word-diff=color", "--color-words":
+		opts.WordDiff = core.WordDiffColor
+	case "--word-diff=none":
+		opts.WordDiff = core.WordDiffNone
+	case "-w", "--ignore-all-space":
+		opts.IgnoreAllSpace = true
+	case "-b", "--ignore-space-change":
+		opts.IgnoreSpaceChange = true
+	case "--ignore-blank-lines":
+		opts.IgnoreBlankLines = true
+	case "--ignore-cr-at-eol":
+		opts.IgnoreCRAtEOL = true
+	default:
+		var pattern string
+		switch {
+		case strings.HasPrefix(arg, "--word-diff-regex="):
+			pattern = strings.TrimPrefix(arg, "--word-diff-regex=")
+			if opts.WordDiff == core.WordDiffNone {
+				opts.WordDiff = core.WordDiffPlain
+			}
+		case strings.HasPrefix(arg, "--color-words="):
+			pattern = strings.TrimPrefix(arg, "--color-words=")
+			opts.WordDiff = core.WordDiffColor
+		case strings.HasPrefix(arg, "--word-diff="):
+			return false, fmt.Errorf("unknown word diff mode '%s'", strings.TrimPrefix(arg, "--word-diff="))
+		default:
+			return false, nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid word regex: %w", err)
+		}
+		opts.WordRegex = re
+	}
+	return true, nil
+}
+
 // printCommitResult formats and prints the commit result with summary
 func printCommitResult(newCommit models.Commit, summary string) {
 	headState, err := core.GetHeadState()
@@ -490,7 +1283,20 @@ func printCommitResult(newCommit models.Commit, summary string) {
 		ref := strings.TrimSpace(string(headData))
 		headState = strings.TrimPrefix(ref, "ref: refs/heads/")
 	}
-	fmt.Printf("[%s %s] %s\n%s\n", headState, newCommit.ID[:7], newCommit.Message, summary)
+	if strings.HasPrefix(headState, "HEAD (detached") {
+		headState = "detached HEAD"
+	}
+	fmt.Printf("[%s %s] %s\n%s\n", headState, newCommit.ID[:7], core.CommitSubject(newCommit.Message), summary)
+}
+
+// mustParsePathspec parses pathspec arguments, exiting on invalid ones
+func mustParsePathspec(args []string) *core.Pathspec {
+	ps, err := core.ParsePathspec(args)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	return ps
 }
 
 func main() {
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCLICommitMessage(t *testing.T) {
+	tmpDir := t.TempDir()
+	binName := "kitkat"
+	if runtime.GOOS == "windows" {
+		binName += ".exe"
+	}
+	binPath := filepath.Join(tmpDir, binName)
+	buildCmd := exec.Command("go", "build", "-o", binPath, "main.go")
+	if output, err := buildCmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to build kitkat binary: %v\nOutput: %s", err, output)
+	}
+
+	repo := filepath.Join(tmpDir, "repo")
+	if err := os.Mkdir(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	run := func(stdin string, args ...string) string {
+		t.Helper()
+		cmd := exec.Command(binPath, args...)
+		cmd.Dir = repo
+		cmd.Env = append(os.Environ(), "HOME="+tmpDir, "KITKAT_COMMITTER_NAME=Ada", "KITKAT_COMMITTER_EMAIL=ada@example.com")
+		cmd.Stdin = strings.NewReader(stdin)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("kitkat %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+		return string(output)
+	}
+	commitFile := func(content string, args ...string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repo, "f.txt"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run("", "add", "f.txt")
+		run("from stdin\n\nwith a body\n", append([]string{"commit"}, args...)...)
+	}
+
+	run("", "init")
+	commitFile("one\n", "-F", "-")
+	// Flags are recognised among the words of the message
+	commitFile("two\n", "-m", "use", "-s", "for", "signoff", "-m", "body", "--", "-x", "--amend")
+	run("", "commit", "-m", "deploy", "--allow-empty")
+	run("", "commit", "-m", "redeploy", "--allow-empty", "--amend")
+
+	log := run("", "log")
+	for _, want := range []string{
+		"    redeploy\n",
+		"    use for signoff\n    \n    body -x --amend\n    \n    Signed-off-by: Ada <ada@example.com>\n",
+		"    from stdin\n    \n    with a body\n",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log is missing %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "    deploy\n") {
+		t.Errorf("--amend did not replace the empty commit:\n%s", log)
+	}
+}
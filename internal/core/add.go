@@ -19,34 +19,43 @@ func AddFile(path string) error {
 		return errors.New("not a kitkat repository (run `kitkat init`)")
 	}
 
-	hash, err := storage.HashAndStoreFile(path)
+	// Stat before reading so a change made while hashing is noticed next time
+	info, err := os.Lstat(path)
 	if err != nil {
 		return err
 	}
-
-	index, err := storage.LoadIndex()
+	hash, err := storage.HashAndStoreFile(path)
 	if err != nil {
 		return err
 	}
 
-	// Skip if already tracked with same hash
-	if existing, ok := index[path]; ok && existing == hash {
+	entry := storage.NewIndexEntry(path, hash, info)
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		entries[path] = entry
 		return nil
-	}
-
-	index[path] = hash
-	return storage.WriteIndex(index)
+	})
 }
 
 // AddAll stages all changes in the working directory.
 // This includes new files, modified files, and deleted files.
 func AddAll() error {
-	// Load the current index from the last known state.
+	return AddPaths(nil)
+}
+
+// AddPaths stages the new, modified and deleted files a pathspec selects; a nil
+// pathspec selects everything. Ignored files are skipped unless named exactly.
+// Nothing is staged if a pattern matches no file.
+func AddPaths(ps *Pathspec) error {
+	// The index stays locked for the whole walk so no concurrent update is lost
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		return addPaths(entries, ps)
+	})
+}
+
+// addPaths brings the entries a pathspec selects in line with the working directory
+func addPaths(entries map[string]storage.IndexEntry, ps *Pathspec) error {
 	// This map represents what we *think* is currently staged.
-	index, err := storage.LoadIndex()
-	if err != nil {
-		return err
-	}
+	index := storage.IndexHashes(entries)
 
 	// Load ignore patterns
 	ignorePatterns, err := LoadIgnorePatterns()
@@ -57,6 +66,7 @@ func AddAll() error {
 	// We need a way to track which files we see in the working directory
 	// A map is used for this, giving us O(1) average time complexity for lookups
 	filesInWorkDir := make(map[string]bool)
+	var pending []trackedFile
 
 	// Walk the entire directory tree, starting from the current location "."
 	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
@@ -81,43 +91,70 @@ func AddAll() error {
 		}
 
 		// We only care about files, not directories
-		if info.IsDir() {
+		if info.IsDir() || !ps.Matches(cleanPath) {
 			return nil
 		}
 
-		// Check if file should be ignored (but only if not already tracked)
-		if ShouldIgnore(cleanPath, ignorePatterns, index) {
+		// Check if file should be ignored (but only if not already tracked or named explicitly)
+		if ShouldIgnore(cleanPath, ignorePatterns, index) && !ps.names(cleanPath) {
 			return nil // Skip this file
 		}
 
 		// Mark this file as "seen" in the working directory
 		filesInWorkDir[cleanPath] = true
 
-		// Hash the file and add/update it in the index.
-		// This is the same logic as AddFile, but applied to every file we find
-		hash, err := storage.HashAndStoreFile(cleanPath)
-		if err != nil {
-			// Continue even if one file fails.
-			fmt.Printf("warning: could not add file %s: %v\n", cleanPath, err)
+		// Files whose stat data still matches the index are already staged as they are
+		if entry, ok := entries[cleanPath]; ok && entry.StatMatches(info) {
 			return nil
 		}
-		index[cleanPath] = hash
+
+		// Everything else is hashed once the walk is done
+		pending = append(pending, trackedFile{Path: cleanPath, Info: info})
 		return nil
 	})
 	if err != nil {
 		return err
 	}
 
+	// Every pattern must match a file on disk or in the index
+	known := make([]string, 0, len(filesInWorkDir)+len(entries))
+	for path := range filesInWorkDir {
+		known = append(known, path)
+	}
+	for path := range entries {
+		known = append(known, path)
+	}
+	if err := ps.errUnmatched(known); err != nil {
+		return err
+	}
+
+	// Hash and store the new and changed files in parallel, then add/update them
+	// in the index in walk order. This is the same logic as AddFile, but applied
+	// to every file we find
+	hashes := make([]string, len(pending))
+	hashErrs := make([]error, len(pending))
+	forEachParallel(len(pending), func(i int) error {
+		hashes[i], hashErrs[i] = storage.HashAndStoreFile(pending[i].Path)
+		return nil
+	})
+	for i, file := range pending {
+		if hashErrs[i] != nil {
+			// Continue even if one file fails.
+			fmt.Printf("warning: could not add file %s: %v\n", file.Path, hashErrs[i])
+			continue
+		}
+		entries[file.Path] = storage.NewIndexEntry(file.Path, hashes[i], file.Info)
+	}
+
 	// Find and handle deleted files.
 	// We loop through the original index. If a file from the index was NOT seen
 	// during our walk of the working directory, it must have been deleted
-	for pathInIndex := range index {
-		if !filesInWorkDir[pathInIndex] {
+	for pathInIndex := range entries {
+		if !filesInWorkDir[pathInIndex] && ps.Matches(pathInIndex) {
 			// Remove the deleted file from our index map
-			delete(index, pathInIndex)
+			delete(entries, pathInIndex)
 		}
 	}
 
-	// Write the fully updated index back to disk
-	return storage.WriteIndex(index)
+	return nil
 }
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mboxSeparator matches the "From <hash> <date>" line that starts each message
+// written by format-patch
+var mboxSeparator = regexp.MustCompile(`(?m)^From [0-9a-f]{40} `)
+
+// patchSubjectPrefix matches bracketed tags such as "[PATCH 2/5]" at the start of a subject
+var patchSubjectPrefix = regexp.MustCompile(`^\s*(\[[^\]]*\]\s*)+`)
+
+// mailPatch is a commit recovered from a patch email
+type mailPatch struct {
+	AuthorName  string
+	AuthorEmail string
+	Date        time.Time
+	Message     string // Subject line, followed by the body if there is one
+	Patch       string // Everything from the "---" separator on
+}
+
+// subject returns the first line of the commit message
+func (m mailPatch) subject() string {
+	subject, _, _ := strings.Cut(m.Message, "\n")
+	return subject
+}
+
+// splitMbox splits an mbox into its messages. Input without separator lines is
+// treated as a single message.
+func splitMbox(data string) []string {
+	locs := mboxSeparator.FindAllStringIndex(data, -1)
+	if len(locs) == 0 {
+		return []string{data}
+	}
+	var messages []string
+	for i, loc := range locs {
+		end := len(data)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		messages = append(messages, data[loc[0]:end])
+	}
+	return messages
+}
+
+// parseMail reads the author, date and commit message from the headers and body
+// of a patch email and separates them from the diff
+func parseMail(raw string) (mailPatch, error) {
+	if strings.HasPrefix(raw, "From ") {
+		// The mbox separator line is not a header
+		if _, rest, ok := strings.Cut(raw, "\n"); ok {
+			raw = rest
+		}
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return mailPatch{}, fmt.Errorf("malformed patch email: %w", err)
+	}
+
+	var mp mailPatch
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return mailPatch{}, fmt.Errorf("patch email has no valid From header: %w", err)
+	}
+	mp.AuthorName, mp.AuthorEmail = from.Name, from.Address
+	if mp.AuthorName == "" {
+		mp.AuthorName = from.Address
+	}
+	mp.Date, err = msg.Header.Date()
+	if err != nil {
+		mp.Date = time.Now()
+	}
+
+	decoder := new(mime.WordDecoder)
+	subject, err := decoder.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	subject = strings.TrimSpace(patchSubjectPrefix.ReplaceAllString(subject, ""))
+
+	data, err := io.ReadAll(msg.Body)
+	if err != nil {
+		return mailPatch{}, err
+	}
+	// The message body ends at the "---" line before the diffstat, or at the
+	// first file header when there is no separator
+	lines := strings.SplitAfter(string(data), "\n")
+	split := len(lines)
+	for i, line := range lines {
+		text := strings.TrimRight(line, "\r\n")
+		if text == "---" || strings.HasPrefix(text, "diff --git ") || strings.HasPrefix(text, "--- ") {
+			split = i
+			break
+		}
+	}
+	body := strings.TrimSpace(strings.Join(lines[:split], ""))
+	mp.Patch = strings.Join(lines[split:], "")
+
+	mp.Message = subject
+	if body != "" {
+		mp.Message += "\n\n" + body
+	}
+	if mp.Message == "" {
+		return mailPatch{}, fmt.Errorf("patch email has no subject")
+	}
+	return mp, nil
+}
+
+// Am applies a series of patch emails, as written by format-patch, and commits
+// each one with its original author, date and message. When a patch does not
+// apply the session stops so it can be resumed with AmContinue or AmSkip, or
+// undone with AmAbort.
+func Am(paths []string) error {
+	// Guard: ensure we're inside a kitkat repo
+	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
+		return errors.New("not a kitkat repository (run `kitkat init`)")
+	}
+	if IsAmInProgress() {
+		return fmt.Errorf("previous am still in progress; use 'kitkat am --continue', '--skip' or '--abort'")
+	}
+	if IsRebaseInProgress() {
+		return fmt.Errorf("a rebase is in progress; finish or abort it first")
+	}
+	if dirty, err := hasTrackedChanges(); err != nil {
+		return err
+	} else if dirty {
+		return fmt.Errorf("you have uncommitted changes; commit them before running am")
+	}
+
+	var messages []string
+	for _, path := range paths {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return fmt.Errorf("could not read patch: %w", err)
+		}
+		messages = append(messages, splitMbox(string(data))...)
+	}
+	if len(messages) == 0 {
+		return fmt.Errorf("no patches to apply")
+	}
+
+	origHead, _ := readHead()
+	state := AmState{OrigHead: origHead, Next: 1, Last: len(messages)}
+	if err := SaveAmState(state); err != nil {
+		return err
+	}
+	for i, message := range messages {
+		if err := os.WriteFile(amMessagePath(i+1), []byte(message), 0644); err != nil {
+			return err
+		}
+	}
+	return runAm(&state)
+}
+
+// AmContinue commits the resolved changes of the patch that failed to apply,
+// using its original metadata, and carries on with the rest of the series
+func AmContinue() error {
+	state, err := LoadAmState()
+	if err != nil {
+		return err
+	}
+	mp, err := loadAmMessage(state.Next)
+	if err != nil {
+		return err
+	}
+	if err := commitMailPatch(mp); err != nil {
+		if strings.Contains(err.Error(), "nothing to commit") {
+			return fmt.Errorf("no changes staged for %s; stage the resolved files or use 'kitkat am --skip'", mp.subject())
+		}
+		return err
+	}
+	state.Next++
+	return runAm(state)
+}
+
+// AmSkip drops the patch that failed to apply and continues with the next one
+func AmSkip() error {
+	state, err := LoadAmState()
+	if err != nil {
+		return err
+	}
+	if head, _ := readHead(); head != "" {
+		if err := UpdateWorkspaceAndIndex(head); err != nil {
+			return err
+		}
+	}
+	state.Next++
+	return runAm(state)
+}
+
+// AmAbort stops the session and restores the branch to where it was before am started
+func AmAbort() error {
+	state, err := LoadAmState()
+	if err != nil {
+		return err
+	}
+	if state.OrigHead != "" {
+		if err := UpdateBranchPointer(state.OrigHead); err != nil {
+			return err
+		}
+		if err := UpdateWorkspaceAndIndex(state.OrigHead); err != nil {
+			return err
+		}
+	}
+	return ClearAmState()
+}
+
+// runAm applies the remaining messages of the session in order
+func runAm(state *AmState) error {
+	for ; state.Next <= state.Last; state.Next++ {
+		if err := SaveAmState(*state); err != nil {
+			return err
+		}
+		mp, err := loadAmMessage(state.Next)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applying: %s\n", mp.subject())
+
+		if err := applyMailPatch(mp); err != nil {
+			return fmt.Errorf("%w\nPatch failed at %04d %s\n"+
+				"Resolve the problem, stage the result and run 'kitkat am --continue'.\n"+
+				"Use 'kitkat am --skip' to drop this patch or 'kitkat am --abort' to restore the original branch.",
+				err, state.Next, mp.subject())
+		}
+		if err := commitMailPatch(mp); err != nil {
+			return err
+		}
+	}
+	return ClearAmState()
+}
+
+// loadAmMessage reads and parses message n of the session
+func loadAmMessage(n int) (mailPatch, error) {
+	data, err := os.ReadFile(amMessagePath(n))
+	if err != nil {
+		return mailPatch{}, fmt.Errorf("could not read patch %04d: %w", n, err)
+	}
+	return parseMail(string(data))
+}
+
+// applyMailPatch applies the diff of a patch email to the working directory and the index
+func applyMailPatch(mp mailPatch) error {
+	patches, err := parsePatch(mp.Patch)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return fmt.Errorf("patch is empty")
+	}
+	results, err := applyPatches(patches, false)
+	if err != nil {
+		return err
+	}
+	if err := writePatchesToWorkdir(results); err != nil {
+		return err
+	}
+	return writePatchesToIndex(results)
+}
+
+// commitMailPatch commits the index with the author, date and message of a patch email
+func commitMailPatch(mp mailPatch) error {
+	_, _, err := createCommit(commitOptions{
+		Message:     mp.Message,
+		AuthorName:  mp.AuthorName,
+		AuthorEmail: mp.AuthorEmail,
+		Timestamp:   mp.Date,
+	})
+	return err
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// AmState tracks an ongoing am session. Each message being applied is stored
+// as a numbered file (0001, 0002, ...) next to the state files.
+type AmState struct {
+	OrigHead string // Commit ID where we started (for abort)
+	Next     int    // Number of the message being applied (1-based)
+	Last     int    // Number of the final message
+}
+
+func amDir() string {
+	return filepath.Join(RepoDir, "rebase-apply")
+}
+
+// amMessagePath returns where message n of the session is stored
+func amMessagePath(n int) string {
+	return filepath.Join(amDir(), fmt.Sprintf("%04d", n))
+}
+
+func SaveAmState(state AmState) error {
+	if err := os.MkdirAll(amDir(), 0755); err != nil {
+		return err
+	}
+	files := map[string]string{
+		"orig-head": state.OrigHead,
+		"next":      strconv.Itoa(state.Next),
+		"last":      strconv.Itoa(state.Last),
+	}
+	for name, value := range files {
+		if err := os.WriteFile(filepath.Join(amDir(), name), []byte(value), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func LoadAmState() (*AmState, error) {
+	if !IsAmInProgress() {
+		return nil, fmt.Errorf("no am in progress")
+	}
+	read := func(name string) string {
+		data, _ := os.ReadFile(filepath.Join(amDir(), name))
+		return strings.TrimSpace(string(data))
+	}
+	next, err := strconv.Atoi(read("next"))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt am state: %w", err)
+	}
+	last, err := strconv.Atoi(read("last"))
+	if err != nil {
+		return nil, fmt.Errorf("corrupt am state: %w", err)
+	}
+	return &AmState{OrigHead: read("orig-head"), Next: next, Last: last}, nil
+}
+
+func IsAmInProgress() bool {
+	_, err := os.Stat(amDir())
+	return err == nil
+}
+
+func ClearAmState() error {
+	return os.RemoveAll(amDir())
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testMbox = `From 1111111111111111111111111111111111111111 Mon Sep 17 00:00:00 2001
+From: Ada Lovelace <ada@example.com>
+Date: Tue, 3 Feb 2026 10:20:30 +0100
+Subject: [PATCH 1/2] Add notes
+
+Explain the engine.
+---
+ notes | 1 +
+ 1 file changed, 1 insertion(+)
+
+diff --git a/notes b/notes
+new file mode 100644
+--- /dev/null
++++ b/notes
+@@ -0,0 +1 @@
++engine
+
+From 2222222222222222222222222222222222222222 Mon Sep 17 00:00:00 2001
+From: =?utf-8?q?Bj=C3=B6rn?= <bjorn@example.com>
+Date: Wed, 4 Feb 2026 08:00:00 +0000
+Subject: [PATCH 2/2] Tweak notes
+
+diff --git a/notes b/notes
+--- a/notes
++++ b/notes
+@@ -1 +1 @@
+-engine
++analytical engine
+`
+
+func TestParseMbox(t *testing.T) {
+	messages := splitMbox(testMbox)
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(messages))
+	}
+
+	first, err := parseMail(messages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AuthorName != "Ada Lovelace" || first.AuthorEmail != "ada@example.com" {
+		t.Errorf("unexpected author %q <%q>", first.AuthorName, first.AuthorEmail)
+	}
+	if want := time.Date(2026, 2, 3, 9, 20, 30, 0, time.UTC); !first.Date.Equal(want) {
+		t.Errorf("expected date %v, got %v", want, first.Date)
+	}
+	if first.Message != "Add notes\n\nExplain the engine." {
+		t.Errorf("unexpected message %q", first.Message)
+	}
+	patches, err := parsePatch(first.Patch)
+	if err != nil || len(patches) != 1 || !patches[0].IsNew {
+		t.Errorf("unexpected patch %+v (%v)", patches, err)
+	}
+
+	second, err := parseMail(messages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.AuthorName != "Björn" || second.Message != "Tweak notes" {
+		t.Errorf("unexpected second message %q by %q", second.Message, second.AuthorName)
+	}
+	if !strings.HasPrefix(second.Patch, "diff --git") {
+		t.Errorf("patch should start at the file header, got %q", second.Patch)
+	}
+}
+
+func TestPatchSlug(t *testing.T) {
+	cases := map[string]string{
+		"Fix: handle  empty files!": "Fix-handle-empty-files",
+		"v1.2 release":              "v1.2-release",
+		"???":                       "patch",
+	}
+	for subject, want := range cases {
+		if got := patchSlug(subject); got != want {
+			t.Errorf("patchSlug(%q) = %q, want %q", subject, got, want)
+		}
+	}
+}
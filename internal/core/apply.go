@@ -0,0 +1,228 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ApplyOptions controls how Apply uses a patch
+type ApplyOptions struct {
+	Check   bool // Only report whether the patch applies; change nothing
+	Cached  bool // Apply to the index instead of the working directory
+	Reverse bool // Undo the patch instead of applying it
+}
+
+// patchResult is the outcome of applying one file patch in memory
+type patchResult struct {
+	patch   filePatch
+	content []byte
+	mode    uint32 // Mode the patched file is recorded with
+}
+
+// Apply reads a unified diff from patchPath ("-" for standard input) and applies it
+// to the working directory, or to the index with opts.Cached. Every file is checked
+// before anything is written, so a patch either applies completely or not at all.
+func Apply(patchPath string, opts ApplyOptions) error {
+	// Guard: ensure we're inside a kitkat repo
+	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
+		return errors.New("not a kitkat repository (run `kitkat init`)")
+	}
+
+	var data []byte
+	var err error
+	if patchPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(patchPath)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read patch: %w", err)
+	}
+
+	patches, err := parsePatch(string(data))
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		return fmt.Errorf("no valid patches in input")
+	}
+	if opts.Reverse {
+		for i := range patches {
+			patches[i] = patches[i].reverse()
+		}
+	}
+
+	results, err := applyPatches(patches, opts.Cached)
+	if err != nil {
+		return err
+	}
+	if opts.Check {
+		fmt.Println("Patch applies cleanly.")
+		return nil
+	}
+
+	if opts.Cached {
+		return writePatchesToIndex(results)
+	}
+	return writePatchesToWorkdir(results)
+}
+
+// applyPatches applies every file patch in memory against the index or the
+// working directory and returns the resulting contents
+func applyPatches(patches []filePatch, cached bool) ([]patchResult, error) {
+	index, err := storage.LoadIndexEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	// readSource loads the current content of a path, reporting whether it exists
+	readSource := func(path string) ([]byte, bool, error) {
+		if cached {
+			entry, ok := index[path]
+			if !ok {
+				return nil, false, nil
+			}
+			content, err := storage.ReadObject(entry.Hash)
+			return content, true, err
+		}
+		content, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return content, err == nil, err
+	}
+
+	var results []patchResult
+	for _, p := range patches {
+		for _, path := range []string{p.OldPath, p.NewPath} {
+			if path != "" && !IsSafePath(path) {
+				return nil, fmt.Errorf("unsafe path in patch: %s", path)
+			}
+		}
+
+		var source []byte
+		var sourceMode uint32
+		if p.IsNew {
+			_, exists, err := readSource(p.NewPath)
+			if err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, fmt.Errorf("%s: already exists", p.NewPath)
+			}
+		} else {
+			content, exists, err := readSource(p.OldPath)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				return nil, fmt.Errorf("%s: does not exist", p.OldPath)
+			}
+			source = content
+			if sourceMode, err = sourceFileMode(p.OldPath, index, cached); err != nil {
+				return nil, err
+			}
+		}
+		if p.isRename() {
+			if _, exists, err := readSource(p.NewPath); err != nil {
+				return nil, err
+			} else if exists {
+				return nil, fmt.Errorf("%s: already exists", p.NewPath)
+			}
+		}
+
+		name := p.NewPath
+		if name == "" {
+			name = p.OldPath
+		}
+		content, notes, err := applyHunks(source, p.Hunks)
+		if err != nil {
+			return nil, fmt.Errorf("patch failed: %s: %w", name, err)
+		}
+		if p.IsDel && len(content) > 0 {
+			return nil, fmt.Errorf("patch failed: %s: deleted file still has contents", name)
+		}
+		for _, note := range notes {
+			fmt.Printf("%s: %s\n", name, note)
+		}
+		// The patch's mode wins; otherwise a modified or renamed file keeps its own
+		mode := p.NewMode
+		if mode == 0 {
+			mode = sourceMode
+		}
+		if mode == 0 {
+			mode = storage.ModeRegular
+		}
+		results = append(results, patchResult{patch: p, content: content, mode: mode})
+	}
+	return results, nil
+}
+
+// writePatchesToWorkdir writes the patched contents to the working directory
+func writePatchesToWorkdir(results []patchResult) error {
+	for _, r := range results {
+		p := r.patch
+		if p.IsDel || p.isRename() {
+			if err := os.Remove(p.OldPath); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyParents(p.OldPath)
+		}
+		if p.IsDel {
+			fmt.Printf("Deleted %s\n", p.OldPath)
+			continue
+		}
+
+		perm := os.FileMode(0644)
+		if r.mode == storage.ModeExecutable {
+			perm = 0755
+		}
+		if err := os.MkdirAll(filepath.Dir(p.NewPath), 0755); err != nil {
+			return err
+		}
+		if err := SafeWrite(p.NewPath, r.content, perm); err != nil {
+			return err
+		}
+		fmt.Printf("Applied patch to %s\n", p.NewPath)
+	}
+	return nil
+}
+
+// writePatchesToIndex stores the patched contents as blobs and stages them
+func writePatchesToIndex(results []patchResult) error {
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		for _, r := range results {
+			p := r.patch
+			if p.IsDel || p.isRename() {
+				delete(entries, p.OldPath)
+			}
+			if p.IsDel {
+				continue
+			}
+			hash, err := saveObject(r.content)
+			if err != nil {
+				return err
+			}
+			entries[p.NewPath] = storage.IndexEntry{Path: p.NewPath, Hash: hash, Mode: r.mode}
+		}
+		return nil
+	})
+}
+
+// sourceFileMode returns the mode of a file a patch changes, as staged with
+// cached or as found in the working directory otherwise
+func sourceFileMode(path string, index map[string]storage.IndexEntry, cached bool) (uint32, error) {
+	if cached {
+		return index[path].Mode, nil
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	return storage.ModeFromFileInfo(info), nil
+}
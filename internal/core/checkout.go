@@ -1,50 +1,65 @@
 package core
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
-	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-// Restore a file in the working directory to its state in the last commit
-func CheckoutFile(filePath string) error {
-	// Get the target content (from HEAD/Last Commit)
-	lastCommit, err := storage.GetLastCommit()
+// CheckoutPaths restores the files a pathspec selects to their state in HEAD.
+// It refuses to overwrite files with local changes or untracked files.
+func CheckoutPaths(ps *Pathspec) error {
+	// Get the target content (from HEAD)
+	headCommit, err := GetHeadCommit()
 	if err != nil {
 		return err
 	}
 
-	tree, err := storage.ParseTree(lastCommit.TreeHash)
+	tree, err := storage.ParseTreeEntries(headCommit.TreeHash)
 	if err != nil {
 		return err
 	}
 
-	blobHash, ok := tree[filePath]
-	if !ok {
-		return errors.New("file not found in the last commit")
+	paths := make([]string, 0, len(tree))
+	for path := range tree {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if err := ps.errUnmatched(paths); err != nil {
+		return err
 	}
 
+	// Load index to check if the files are tracked and clean
+	index, err := storage.LoadIndex()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		if !ps.Matches(path) {
+			continue
+		}
+		if err := checkoutPath(path, tree[path], index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkoutPath restores a single file in the working directory to entry
+func checkoutPath(filePath string, entry storage.TreeEntry, index map[string]string) error {
 	// SAFETY CHECK: Prevent overwriting dirty or untracked files
-	if _, err := os.Stat(filePath); err == nil {
+	if _, err := os.Lstat(filePath); err == nil {
 		// File exists, check if it is safe to overwrite
-		currentHash, err := calculateHash(filePath)
+		currentHash, err := storage.HashFile(filePath)
 		if err != nil {
 			return fmt.Errorf("failed to calculate hash for safety check: %v", err)
 		}
 
-		// Load index to check if the file is tracked and clean
-		index, err := storage.LoadIndex()
-		if err != nil {
-			return err
-		}
-
 		if trackedHash, ok := index[filePath]; ok {
 			// File is tracked: fail if local changes exist (Index != Disk)
 			if currentHash != trackedHash {
@@ -57,16 +72,12 @@ func CheckoutFile(filePath string) error {
 	}
 
 	// Safe to overwrite: Perform the checkout
-	content, err := storage.ReadObject(blobHash)
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filePath, content, 0644)
+	return writeWorkFile(filePath, entry)
 }
 
 // Switch the current HEAD to the named branch and updates the working directory.
-func CheckoutBranch(name string) error {
+// Local changes the branch does not touch are carried across.
+func CheckoutBranch(name string, opts CheckoutOptions) error {
 	branchPath := filepath.Join(headsDir, name)
 	commitHashBytes, err := os.ReadFile(branchPath)
 	if err != nil {
@@ -80,83 +91,63 @@ func CheckoutBranch(name string) error {
 	if err != nil {
 		return err
 	}
-	targetTree, err := storage.ParseTree(commit.TreeHash)
-	if err != nil {
-		return err
-	}
 
-	isDirty, err := IsWorkDirDirty()
+	// Update the working directory and index to match the target tree and point
+	// HEAD to the new branch, aborting before any file is touched if local
+	// changes would be lost
+	update, err := headUpdate(fmt.Sprintf("ref: refs/heads/%s", name))
 	if err != nil {
-		return fmt.Errorf("could not check for local changes: %w", err)
-	}
-	if isDirty {
-		return errors.New("error: Your local changes to the following files would be overwritten by checkout:\n\tPlease commit your changes or stash them before you switch branches")
-	}
-
-	// Before making changes, we should check if the user has unstaged work
-	// that would be overwritten
-	// So the real Git would abort here
-	// For now, this is what i have done
-
-	// Update the working directory to match the target tree
-	// First, delete files that are not in the target tree
-	currentIndex, _ := storage.LoadIndex()
-	for path := range currentIndex {
-		if _, existsInTarget := targetTree[path]; !existsInTarget {
-			os.Remove(path)
-		}
-	}
-
-	// Now, write/update files from the target tree
-	for path, hash := range targetTree {
-		content, err := storage.ReadObject(hash)
-		if err != nil {
-			return err
-		}
-		// Ensure directory exists before writing file
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
-		}
-		if err := os.WriteFile(path, content, 0644); err != nil {
-			return err
-		}
-	}
-
-	// Update the index to match the new tree
-	if err := storage.WriteIndex(targetTree); err != nil {
 		return err
 	}
-
-	// Update HEAD to point to the new branch
-	newHEADContent := fmt.Sprintf("ref: refs/heads/%s", name)
-	return os.WriteFile(".kitkat/HEAD", []byte(newHEADContent), 0644)
+	return checkoutTree(commit.ID, opts, "checkout", update)
 }
 
 // CheckoutCommit moves HEAD to a specific commit and updates the working directory
 // This puts the repository in a "detached HEAD" state
-func CheckoutCommit(commitHash string) error {
+func CheckoutCommit(commitHash string, opts CheckoutOptions) error {
 	// Verify the commit actually exists
 	_, err := storage.FindCommit(commitHash)
 	if err != nil {
 		return fmt.Errorf("commit '%s' not found", commitHash)
 	}
 
-	if err := UpdateWorkspaceAndIndex(commitHash); err != nil {
+	update, err := headUpdate(commitHash)
+	if err != nil {
 		return err
 	}
+	return checkoutTree(commitHash, opts, "checkout", update)
+}
 
-	return os.WriteFile(".kitkat/HEAD", []byte(commitHash), 0644)
+// SwitchBranch switches to an existing branch. Unlike checkout it never treats
+// its argument as a file or a commit.
+func SwitchBranch(name string, opts CheckoutOptions) error {
+	if !IsBranch(name) {
+		if _, err := ResolveRevision(name); err == nil {
+			return fmt.Errorf("a branch is expected, got '%s' (use --detach to check out a commit)", name)
+		}
+		return fmt.Errorf("invalid reference: %s", name)
+	}
+	return CheckoutBranch(name, opts)
 }
 
-func calculateHash(path string) (string, error) {
-	f, err := os.Open(path)
+// SwitchNewBranch creates a branch at start (HEAD if empty) and switches to it.
+// The branch is only created if the switch succeeds.
+func SwitchNewBranch(name, start string, opts CheckoutOptions) error {
+	if IsBranch(name) {
+		return fmt.Errorf("a branch named '%s' already exists", name)
+	}
+	if start == "" {
+		start = "HEAD"
+	}
+	commitHash, err := ResolveRevision(start)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("invalid reference: %s", start)
 	}
-	defer f.Close()
-	h := sha1.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
+
+	branch := refUpdate{Path: filepath.Join(headsDir, name), New: commitHash}
+	head, err := headUpdate(fmt.Sprintf("ref: refs/heads/%s", name))
+	if err != nil {
+		return err
 	}
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return checkoutTree(commitHash, opts, "checkout", branch, head)
 }
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// A checkout is made a single transaction by a journal written before any file
+// is touched. It holds the plan, a backup of every file the plan overwrites or
+// removes, the old index and the ref updates. A checkout that fails is rolled
+// back from the journal; one cut short by a crash is finished or rolled back by
+// 'kitkat recover'. Every step can be safely repeated, so a checkout can be
+// resumed or undone from any point.
+var checkoutJournalPath = filepath.Join(RepoDir, "checkout-journal")
+
+var errInterruptedCheckout = errors.New("a previous checkout was interrupted; run 'kitkat recover' to finish it or 'kitkat recover --rollback' to undo it")
+
+// refUpdate is a ref file rewritten as part of a checkout
+type refUpdate struct {
+	Path string // For example .kitkat/HEAD or .kitkat/refs/heads/main
+	Old  string // "" if the ref did not exist
+	New  string
+}
+
+// journalBackup is a working file as it was before the checkout
+type journalBackup struct {
+	Path string
+	Hash string // Blob holding the content (or symlink target)
+	Mode uint32
+}
+
+// checkoutJournal is everything needed to finish or undo a checkout
+type checkoutJournal struct {
+	Plan    *checkoutPlan
+	Refs    []refUpdate
+	Backups []journalBackup
+	Index   map[string]storage.IndexEntry // The index before the checkout
+}
+
+// IsCheckoutInterrupted reports whether a checkout was cut short and needs recovering
+func IsCheckoutInterrupted() bool {
+	_, err := os.Stat(checkoutJournalPath)
+	return err == nil
+}
+
+// RecoverCheckout finishes an interrupted checkout, or undoes it if rollback is set
+func RecoverCheckout(rollback bool) error {
+	data, err := os.ReadFile(checkoutJournalPath)
+	if os.IsNotExist(err) {
+		return errors.New("no interrupted checkout to recover")
+	}
+	if err != nil {
+		return err
+	}
+	var j checkoutJournal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return fmt.Errorf("could not parse checkout journal: %w", err)
+	}
+
+	if rollback {
+		err = j.rollback()
+	} else {
+		err = j.apply()
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(checkoutJournalPath)
+}
+
+// runCheckout carries out a plan and its ref updates as one transaction,
+// rolling everything back if any step fails
+func runCheckout(plan *checkoutPlan, refs []refUpdate) error {
+	j, err := beginCheckout(plan, refs)
+	if err != nil {
+		return err
+	}
+	if err := j.apply(); err != nil {
+		if rollbackErr := j.rollback(); rollbackErr != nil {
+			return fmt.Errorf("%w; rolling back also failed: %v\n%v", err, rollbackErr, errInterruptedCheckout)
+		}
+		os.Remove(checkoutJournalPath)
+		return fmt.Errorf("%w (all changes were rolled back)", err)
+	}
+	return os.Remove(checkoutJournalPath)
+}
+
+// beginCheckout works out the merged files and backups of a plan and writes the
+// journal. Nothing outside the object database is changed before it is written.
+func beginCheckout(plan *checkoutPlan, refs []refUpdate) (*checkoutJournal, error) {
+	j := &checkoutJournal{Plan: plan, Refs: refs}
+
+	var backups []string
+	for i, step := range plan.Steps {
+		if step.Action == checkoutKeep {
+			continue
+		}
+		if step.Action == checkoutMerge {
+			hash, conflict, err := mergeWorkFile(step)
+			if err != nil {
+				return nil, err
+			}
+			plan.Steps[i].Merged, plan.Steps[i].Conflict = hash, conflict
+		}
+		backups = append(backups, step.Path)
+	}
+	for _, path := range plan.Clear {
+		err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				backups = append(backups, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := j.backup(backups); err != nil {
+		return nil, err
+	}
+
+	index, err := storage.LoadIndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	j.Index = index
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, err
+	}
+	if err := SafeWrite(checkoutJournalPath, data, 0644); err != nil {
+		return nil, fmt.Errorf("could not write checkout journal: %w", err)
+	}
+	return j, nil
+}
+
+// backup stores the working files at paths, where there are any, so they can be
+// restored. Files are stored in parallel but recorded in the order given.
+func (j *checkoutJournal) backup(paths []string) error {
+	backups := make([]journalBackup, len(paths))
+	err := forEachParallel(len(paths), func(i int) error {
+		info, err := os.Lstat(paths[i])
+		if isMissing(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		hash, err := storage.HashAndStoreFile(paths[i])
+		if err != nil {
+			return err
+		}
+		backups[i] = journalBackup{Path: paths[i], Hash: hash, Mode: storage.ModeFromFileInfo(info)}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, b := range backups {
+		if b.Path != "" {
+			j.Backups = append(j.Backups, b)
+		}
+	}
+	return nil
+}
+
+// apply moves the working tree, index and refs to the target: paths in the way
+// are cleared, removed files go first, then target versions are written, the
+// index is updated and finally the refs
+func (j *checkoutJournal) apply() error {
+	for _, path := range j.Plan.Clear {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	for _, step := range j.Plan.Steps {
+		if step.Action != checkoutRemove {
+			continue
+		}
+		if err := os.Remove(step.Path); err == nil {
+			removeEmptyParents(step.Path)
+		} else if !isMissing(err) {
+			return err
+		}
+	}
+	var writes []checkoutStep
+	for _, step := range j.Plan.Steps {
+		if step.Action == checkoutWrite || step.Action == checkoutMerge {
+			writes = append(writes, step)
+		}
+	}
+	written := make(map[string]os.FileInfo, len(writes))
+	infos := make([]os.FileInfo, len(writes))
+	err := forEachParallel(len(writes), func(i int) error {
+		entry := writes[i].Target
+		if writes[i].Action == checkoutMerge {
+			entry.Hash = writes[i].Merged
+		}
+		if err := writeWorkFile(writes[i].Path, entry); err != nil {
+			return err
+		}
+		var err error
+		infos[i], err = os.Lstat(writes[i].Path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i, step := range writes {
+		// A merged file holds more than the target, so it must be hashed again
+		if step.Action == checkoutWrite {
+			written[step.Path] = infos[i]
+		}
+	}
+
+	err = storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		for _, step := range j.Plan.Steps {
+			switch step.Action {
+			case checkoutWrite, checkoutMerge:
+				entries[step.Path] = writtenEntry(step.Path, step.Target.Hash, step.Target.Mode, written[step.Path])
+			case checkoutRemove:
+				delete(entries, step.Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range j.Refs {
+		if err := SafeWrite(ref.Path, []byte(ref.New), 0644); err != nil {
+			return fmt.Errorf("failed to update %s: %w", ref.Path, err)
+		}
+	}
+	return nil
+}
+
+// rollback puts the working tree, index and refs back the way they were
+func (j *checkoutJournal) rollback() error {
+	for _, ref := range j.Refs {
+		if ref.Old == "" {
+			if err := os.Remove(ref.Path); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", ref.Path, err)
+			}
+			continue
+		}
+		if err := SafeWrite(ref.Path, []byte(ref.Old), 0644); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", ref.Path, err)
+		}
+	}
+
+	// Remove whatever the checkout put in place, then restore the backups
+	for _, step := range j.Plan.Steps {
+		if step.Action == checkoutKeep {
+			continue
+		}
+		if err := os.RemoveAll(step.Path); err != nil {
+			return err
+		}
+		removeEmptyParents(step.Path)
+	}
+	for _, path := range j.Plan.Clear {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	infos := make([]os.FileInfo, len(j.Backups))
+	err := forEachParallel(len(j.Backups), func(i int) error {
+		b := j.Backups[i]
+		if err := writeWorkFile(b.Path, storage.TreeEntry{Hash: b.Hash, Mode: b.Mode}); err != nil {
+			return err
+		}
+		var err error
+		infos[i], err = os.Lstat(b.Path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The old index comes back last, with fresh stat data for the files just
+	// restored that match what it records
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		for path := range entries {
+			delete(entries, path)
+		}
+		for path, entry := range j.Index {
+			entries[path] = entry
+		}
+		for i, b := range j.Backups {
+			if entry, ok := entries[b.Path]; ok {
+				var info os.FileInfo
+				if entry.Hash == b.Hash && entry.Mode == b.Mode {
+					info = infos[i]
+				}
+				entries[b.Path] = writtenEntry(b.Path, entry.Hash, entry.Mode, info)
+			}
+		}
+		return nil
+	})
+}
+
+// writtenEntry returns the index entry of a file the journal just wrote with
+// the given content and mode. info is the file's lstat result, or nil if the
+// file does not hold exactly that content, in which case no stat data is kept.
+func writtenEntry(path, hash string, mode uint32, info os.FileInfo) storage.IndexEntry {
+	if info == nil {
+		return storage.IndexEntry{Path: path, Hash: hash, Mode: mode}
+	}
+	entry := storage.NewIndexEntry(path, hash, info)
+	// The mode is the recorded one even where the file system cannot hold it
+	entry.Mode = mode
+	return entry
+}
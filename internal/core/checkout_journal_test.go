@@ -0,0 +1,182 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// setupJournalRepo creates a repository where branch feature changes a.txt and
+// b.txt, with main checked out
+func setupJournalRepo(t *testing.T) (featureTree map[string]storage.TreeEntry) {
+	t.Helper()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(cwd) })
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFiles := func(content string) {
+		for _, path := range []string{"a.txt", "b.txt"} {
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := Commit(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFiles("base\n")
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFiles("feature\n")
+	head, err := GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	featureTree, err = storage.ParseTreeEntries(head.TreeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return featureTree
+}
+
+func assertCheckedOut(t *testing.T, branch, content string) {
+	t.Helper()
+	if head, _ := os.ReadFile(HeadPath); string(head) != "ref: refs/heads/"+branch {
+		t.Errorf("HEAD = %q, want %s", head, branch)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"a.txt", "b.txt"} {
+		if got, _ := os.ReadFile(path); string(got) != content {
+			t.Errorf("%s = %q, want %q", path, got, content)
+		}
+		if hash, _ := storage.HashFile(path); index[path] != hash {
+			t.Errorf("index entry for %s does not match the working tree", path)
+		}
+	}
+	if IsCheckoutInterrupted() {
+		t.Error("checkout journal left behind")
+	}
+}
+
+func TestCheckoutRollsBackOnFailure(t *testing.T) {
+	featureTree := setupJournalRepo(t)
+
+	// a.txt is written first, then b.txt fails because its blob is gone
+	if err := os.Remove(filepath.Join(ObjectsDir, featureTree["b.txt"].Hash)); err != nil {
+		t.Fatal(err)
+	}
+	err := CheckoutBranch("feature", CheckoutOptions{})
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected a rolled back checkout, got %v", err)
+	}
+	assertCheckedOut(t, "main", "base\n")
+}
+
+func TestRecoverCheckout(t *testing.T) {
+	setupJournalRepo(t)
+
+	// Simulate a crash just after the journal was written
+	plan, err := prepareCheckout(mustBranch(t, "feature"), CheckoutOptions{}, "checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, err := headUpdate("ref: refs/heads/feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := beginCheckout(plan, []refUpdate{update}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature", CheckoutOptions{}); err != errInterruptedCheckout {
+		t.Fatalf("expected checkout to refuse while interrupted, got %v", err)
+	}
+	if err := Restore(nil, RestoreOptions{Source: "HEAD"}); err != errInterruptedCheckout {
+		t.Fatalf("expected restore to refuse while interrupted, got %v", err)
+	}
+	if err := RecoverCheckout(false); err != nil {
+		t.Fatal(err)
+	}
+	assertCheckedOut(t, "feature", "feature\n")
+
+	// Simulate a crash after every change was made but before the journal was removed
+	plan, err = prepareCheckout(mustBranch(t, "main"), CheckoutOptions{}, "checkout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update, err = headUpdate("ref: refs/heads/main"); err != nil {
+		t.Fatal(err)
+	}
+	j, err := beginCheckout(plan, []refUpdate{update})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.apply(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RecoverCheckout(true); err != nil {
+		t.Fatal(err)
+	}
+	assertCheckedOut(t, "feature", "feature\n")
+}
+
+func mustBranch(t *testing.T, name string) string {
+	t.Helper()
+	hash, err := os.ReadFile(filepath.Join(HeadsDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(hash))
+}
+
+func TestWrittenEntryKeepsStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Stat data is only recorded for files that are not racily modified
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := writtenEntry("file", "hash", storage.ModeRegular, info)
+	if !entry.StatMatches(info) || entry.Hash != "hash" || entry.Path != "file" {
+		t.Errorf("entry of a written file is %+v", entry)
+	}
+	if entry := writtenEntry("file", "hash", storage.ModeExecutable, info); entry.Mode != storage.ModeExecutable {
+		t.Errorf("entry has mode %o, want the recorded one", entry.Mode)
+	}
+	// A file that does not hold the recorded content must be hashed again
+	if entry := writtenEntry("file", "hash", storage.ModeRegular, nil); entry.HasStat() {
+		t.Errorf("entry without a written file has stat data: %+v", entry)
+	}
+}
@@ -0,0 +1,432 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// CheckoutOptions controls what a checkout does with local changes that
+// conflict with the target tree
+type CheckoutOptions struct {
+	Force bool // Discard local changes and overwrite untracked files
+	Merge bool // Three-way merge local changes into the target version
+}
+
+// checkoutAction is what a checkout does to a single path
+type checkoutAction int
+
+const (
+	checkoutKeep   checkoutAction = iota // Leave the index entry and working file alone
+	checkoutWrite                        // Write the target version to the index and working tree
+	checkoutRemove                       // Remove the path from the index and working tree
+	checkoutMerge                        // Merge the local changes into the target version
+)
+
+// checkoutStep is the transition planned for one path. Head and Target are its
+// entries in the current and target trees; a missing entry has an empty Hash.
+type checkoutStep struct {
+	Path   string
+	Action checkoutAction
+	Head   storage.TreeEntry
+	Target storage.TreeEntry
+	Local  byte // 'A', 'M' or 'D' for local changes carried across, otherwise 0
+
+	// For checkoutMerge, the merged content written to the working tree
+	Merged   string
+	Conflict bool
+}
+
+// checkoutPlan moves the index and working tree from one tree to another
+type checkoutPlan struct {
+	Steps     []checkoutStep
+	Clear     []string // Untracked or ignored paths in the way, removed before writing
+	Modified  []string // Files whose local changes would be lost
+	Untracked []string // Untracked files that would be overwritten
+}
+
+// checkoutTree moves the index and working tree from HEAD to the tree of
+// commitHash and applies refs, all as one journaled transaction. Local changes
+// to paths the target does not touch are carried across; anything that would
+// be lost aborts the checkout before a single file is written, unless opts say
+// otherwise. verb names the command in the error.
+func checkoutTree(commitHash string, opts CheckoutOptions, verb string, refs ...refUpdate) error {
+	if IsCheckoutInterrupted() {
+		return errInterruptedCheckout
+	}
+	plan, err := prepareCheckout(commitHash, opts, verb)
+	if err != nil {
+		return err
+	}
+	if err := runCheckout(plan, refs); err != nil {
+		return err
+	}
+
+	for _, step := range plan.Steps {
+		if step.Conflict {
+			fmt.Printf("CONFLICT (content): Merge conflict in %s\n", step.Path)
+		}
+	}
+	if !opts.Force {
+		for _, step := range plan.Steps {
+			if step.Local != 0 {
+				fmt.Printf("%c\t%s\n", step.Local, step.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// prepareCheckout plans a checkout of commitHash from HEAD without touching any
+// file, and fails if the plan would lose local changes
+func prepareCheckout(commitHash string, opts CheckoutOptions, verb string) (*checkoutPlan, error) {
+	commit, err := storage.FindCommit(commitHash)
+	if err != nil {
+		return nil, err
+	}
+	targetTree, err := storage.ParseTreeEntries(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := loadHeadTree()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planCheckout(headTree, targetTree, entries, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.err(verb); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// loadHeadTree returns the tree HEAD points to, or an empty tree before the first commit
+func loadHeadTree() (map[string]storage.TreeEntry, error) {
+	commit, err := GetHeadCommit()
+	if err == storage.ErrNoCommits || errors.Is(err, os.ErrNotExist) {
+		return make(map[string]storage.TreeEntry), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return storage.ParseTreeEntries(commit.TreeHash)
+}
+
+// planCheckout works out the transition of every path in HEAD, the index or the
+// target. For each path:
+//   - unchanged between HEAD and target: local changes are kept
+//   - no local changes: the target version is written (or the file removed)
+//   - the index already matches the target: local changes are kept
+//   - the working file already matches the target: nothing is lost
+//
+// Anything else is a conflict, resolved by opts.Force (take the target) or
+// opts.Merge (merge the working file into the target) where possible.
+func planCheckout(headTree, targetTree map[string]storage.TreeEntry, entries map[string]storage.IndexEntry, opts CheckoutOptions) (*checkoutPlan, error) {
+	ignorePatterns, err := LoadIgnorePatterns()
+	if err != nil {
+		return nil, err
+	}
+	index := storage.IndexHashes(entries)
+
+	pathSet := make(map[string]bool)
+	for path := range headTree {
+		pathSet[path] = true
+	}
+	for path := range targetTree {
+		pathSet[path] = true
+	}
+	for path := range entries {
+		pathSet[path] = true
+	}
+	paths := make([]string, 0, len(pathSet))
+	for path := range pathSet {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	plan := &checkoutPlan{}
+	for _, path := range paths {
+		head, inHead := headTree[path]
+		target, inTarget := targetTree[path]
+		entry, inIndex := entries[path]
+		indexTree := storage.TreeEntry{Hash: entry.Hash, Mode: entry.Mode}
+		step := checkoutStep{Path: path, Head: head, Target: target}
+
+		// Whether the working file matches the index is only worked out when needed
+		var workClean, workChecked bool
+		workMatchesIndex := func() (bool, error) {
+			if !workChecked {
+				workChecked = true
+				var err error
+				workClean, err = worktreeMatches(path, indexTree, inIndex, &entry)
+				if err != nil {
+					return false, err
+				}
+			}
+			return workClean, nil
+		}
+
+		indexClean := sameTreeEntry(head, inHead, indexTree, inIndex)
+		indexAtTarget := sameTreeEntry(target, inTarget, indexTree, inIndex)
+		change := checkoutRemove
+		if inTarget {
+			change = checkoutWrite
+		}
+
+		if opts.Force {
+			// Files that are neither staged nor wanted are untracked and stay
+			if !inIndex && !inTarget {
+				plan.Steps = append(plan.Steps, step)
+				continue
+			}
+			clean, err := workMatchesIndex()
+			if err != nil {
+				return nil, err
+			}
+			if !indexAtTarget || !clean {
+				step.Action = change
+			}
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+
+		if sameTreeEntry(head, inHead, target, inTarget) {
+			local, err := localChange(path, inHead, inIndex, indexClean, workMatchesIndex)
+			if err != nil {
+				return nil, err
+			}
+			step.Local = local
+			plan.Steps = append(plan.Steps, step)
+			continue
+		}
+
+		clean, err := workMatchesIndex()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case indexClean && clean:
+			step.Action = change
+		case indexAtTarget:
+			// Once HEAD moves, only the working file can still differ
+			step.Local, err = localChange(path, inTarget, inIndex, true, workMatchesIndex)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			atTarget, err := worktreeMatches(path, target, inTarget, nil)
+			if err != nil {
+				return nil, err
+			}
+			untracked := !inIndex && !inHead
+			switch {
+			case atTarget && (indexClean || untracked):
+				step.Action = change
+			case untracked && ShouldIgnore(path, ignorePatterns, index):
+				// Ignored files are expendable
+				step.Action = change
+			case opts.Merge && canMergeWorkFile(path, head, inHead, target, inTarget):
+				step.Action = checkoutMerge
+			case untracked:
+				plan.Untracked = append(plan.Untracked, path)
+			default:
+				plan.Modified = append(plan.Modified, path)
+			}
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+
+	if err := plan.findBlockers(ignorePatterns, index, opts.Force); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// findBlockers looks for untracked files and directories standing where the
+// plan writes a file: a file where a directory must be created, or a directory
+// holding files that are not removed where a file must be written
+func (p *checkoutPlan) findBlockers(ignorePatterns []IgnorePattern, index map[string]string, force bool) error {
+	removed := make(map[string]bool)
+	for _, step := range p.Steps {
+		if step.Action == checkoutRemove {
+			removed[step.Path] = true
+		}
+	}
+	cleared := make(map[string]bool)
+	block := func(path string) {
+		if cleared[path] {
+			return
+		}
+		cleared[path] = true
+		if force || ShouldIgnore(path, ignorePatterns, index) {
+			p.Clear = append(p.Clear, path)
+			return
+		}
+		p.Untracked = append(p.Untracked, path)
+	}
+
+	for _, step := range p.Steps {
+		if step.Action != checkoutWrite && step.Action != checkoutMerge {
+			continue
+		}
+		for dir := filepath.Dir(step.Path); dir != "." && dir != string(os.PathSeparator); dir = filepath.Dir(dir) {
+			if _, tracked := index[dir]; tracked {
+				continue
+			}
+			if info, err := os.Lstat(dir); err == nil && !info.IsDir() && !removed[dir] {
+				block(dir)
+			}
+		}
+		info, err := os.Lstat(step.Path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		err = filepath.Walk(step.Path, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && !removed[filepath.Clean(path)] {
+				block(step.Path)
+				return filepath.SkipAll
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sort.Strings(p.Untracked)
+	return nil
+}
+
+// err returns the error that aborts the checkout, listing the files that would
+// be lost, or nil if the plan is safe to apply
+func (p *checkoutPlan) err(verb string) error {
+	if len(p.Modified) == 0 && len(p.Untracked) == 0 {
+		return nil
+	}
+	action := verb
+	if verb == "checkout" {
+		action = "switch branches"
+	}
+
+	var b strings.Builder
+	if len(p.Modified) > 0 {
+		fmt.Fprintf(&b, "Your local changes to the following files would be overwritten by %s:\n", verb)
+		for _, path := range p.Modified {
+			fmt.Fprintf(&b, "\t%s\n", path)
+		}
+		fmt.Fprintf(&b, "Please commit your changes or stash them before you %s.\n", action)
+	}
+	if len(p.Untracked) > 0 {
+		fmt.Fprintf(&b, "The following untracked working tree files would be overwritten by %s:\n", verb)
+		for _, path := range p.Untracked {
+			fmt.Fprintf(&b, "\t%s\n", path)
+		}
+		fmt.Fprintf(&b, "Please move or remove them before you %s.\n", action)
+	}
+	b.WriteString("Aborting")
+	return errors.New(b.String())
+}
+
+// mergeWorkFile merges the changes in a working file (made against the HEAD
+// version) into the target version and stores the result, leaving conflict
+// markers where they overlap
+func mergeWorkFile(step checkoutStep) (hash string, conflict bool, err error) {
+	base, err := storage.ReadObject(step.Head.Hash)
+	if err != nil {
+		return "", false, err
+	}
+	theirs, err := storage.ReadObject(step.Target.Hash)
+	if err != nil {
+		return "", false, err
+	}
+	ours, err := os.ReadFile(step.Path)
+	if err != nil {
+		return "", false, err
+	}
+	merged, conflict := merge3(base, ours, theirs, "local", "target")
+	hash, err = saveObject(merged)
+	return hash, conflict, err
+}
+
+// canMergeWorkFile reports whether a locally changed path can be merged into the
+// target: both versions and the working file must be regular files
+func canMergeWorkFile(path string, head storage.TreeEntry, inHead bool, target storage.TreeEntry, inTarget bool) bool {
+	if !inHead || !inTarget || head.Mode == storage.ModeSymlink || target.Mode == storage.ModeSymlink {
+		return false
+	}
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// localChange describes the local change to a path for the summary printed
+// after a checkout, or returns 0 if the path has none
+func localChange(path string, inHead, inIndex, indexClean bool, workMatchesIndex func() (bool, error)) (byte, error) {
+	switch {
+	case inHead && !inIndex:
+		return 'D', nil
+	case !inHead && inIndex:
+		return 'A', nil
+	case !indexClean:
+		return 'M', nil
+	case !inIndex:
+		return 0, nil
+	}
+	clean, err := workMatchesIndex()
+	if err != nil || clean {
+		return 0, err
+	}
+	if _, err := os.Lstat(path); isMissing(err) {
+		return 'D', nil
+	}
+	return 'M', nil
+}
+
+// sameTreeEntry reports whether two possibly missing entries are the same
+func sameTreeEntry(a storage.TreeEntry, inA bool, b storage.TreeEntry, inB bool) bool {
+	return inA == inB && (!inA || (a.Hash == b.Hash && a.Mode == b.Mode))
+}
+
+// worktreeMatches reports whether the working file at path is exactly want, or
+// is absent if present is false. entry, if not nil, is the index entry for path
+// and lets a file whose stat data is unchanged skip hashing.
+func worktreeMatches(path string, want storage.TreeEntry, present bool, entry *storage.IndexEntry) (bool, error) {
+	info, err := os.Lstat(path)
+	if isMissing(err) {
+		return !present, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !present || info.IsDir() || storage.ModeFromFileInfo(info) != want.Mode {
+		return false, nil
+	}
+	if entry != nil && entry.Hash == want.Hash && entry.StatMatches(info) {
+		return true, nil
+	}
+	hash, err := storage.HashFile(path)
+	if err != nil {
+		return false, err
+	}
+	return hash == want.Hash, nil
+}
+
+// isMissing reports whether an lstat error means there is no file at the path,
+// including when one of its parents is a file rather than a directory
+func isMissing(err error) bool {
+	return os.IsNotExist(err) || errors.Is(err, syscall.ENOTDIR)
+}
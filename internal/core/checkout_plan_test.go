@@ -0,0 +1,81 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutBranchLocalChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commitFiles := func(message string, paths ...string) {
+		t.Helper()
+		for _, path := range paths {
+			if err := AddFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("shared.txt", "one\n")
+	write("other.txt", "one\n")
+	commitFiles("base", "shared.txt", "other.txt")
+	if err := CreateBranch("feature"); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckoutBranch("feature", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	write("shared.txt", "two\n")
+	commitFiles("change shared", "shared.txt")
+	if err := CheckoutBranch("main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A local edit to a file the branch does not change is carried across
+	write("other.txt", "local\n")
+	if err := CheckoutBranch("feature", CheckoutOptions{}); err != nil {
+		t.Fatalf("checkout with compatible changes failed: %v", err)
+	}
+	if content, _ := os.ReadFile("other.txt"); string(content) != "local\n" {
+		t.Errorf("other.txt = %q, want local edit kept", content)
+	}
+
+	// An edit to a file the branch changes aborts without touching anything
+	write("shared.txt", "edited\n")
+	err = CheckoutBranch("main", CheckoutOptions{})
+	if err == nil || !strings.Contains(err.Error(), "\tshared.txt\n") {
+		t.Fatalf("expected checkout to list shared.txt, got %v", err)
+	}
+	if content, _ := os.ReadFile("shared.txt"); string(content) != "edited\n" {
+		t.Errorf("shared.txt = %q after aborted checkout", content)
+	}
+
+	// -f discards it
+	if err := CheckoutBranch("main", CheckoutOptions{Force: true}); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile("shared.txt"); string(content) != "one\n" {
+		t.Errorf("shared.txt = %q after forced checkout, want one", content)
+	}
+}
@@ -10,10 +10,18 @@ import (
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+// CleanOptions controls what Clean removes
+type CleanOptions struct {
+	DryRun         bool // Only print what would be removed
+	IncludeIgnored bool // Also remove ignored files
+	Directories    bool // Also remove untracked directories
+}
+
 // Removes untracked files from the working directory
-// If includeIgnored is false, ignored files are preserved
-// If includeIgnored is true, ignored files are also removed
-func Clean(dryRun bool, includeIgnored bool) error {
+// Ignored files are preserved unless opts.IncludeIgnored is set. Directories
+// emptied by the removal are pruned; with opts.Directories, directories that
+// contain no tracked files are removed as a whole.
+func Clean(opts CleanOptions) error {
 	// Guard: ensure we're inside a kitkat repo
 	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
 		return errors.New("not a kitkat repository (run `kitkat init`)")
@@ -30,6 +38,40 @@ func Clean(dryRun bool, includeIgnored bool) error {
 		return err
 	}
 
+	// Every directory that holds a tracked file, however deep, must be kept
+	trackedDirs := make(map[string]bool)
+	for path := range index {
+		for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+
+	// removable reports whether a file may be deleted, and whether it is ignored
+	removable := func(path string) (bool, bool) {
+		if _, tracked := index[path]; tracked {
+			return false, false
+		}
+		isIgnored := ShouldIgnore(path, ignorePatterns, index)
+		return !isIgnored || opts.IncludeIgnored, isIgnored
+	}
+
+	remove := func(path, display string, isIgnored bool) error {
+		if opts.DryRun {
+			if isIgnored {
+				fmt.Printf("Would remove (ignored) %s\n", display)
+			} else {
+				fmt.Printf("Would remove %s\n", display)
+			}
+			return nil
+		}
+		fmt.Printf("Removing %s\n", display)
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		removeEmptyParents(path)
+		return nil
+	}
+
 	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -45,33 +87,53 @@ func Clean(dryRun bool, includeIgnored bool) error {
 			return nil
 		}
 
-		// skip directories and the root marker "."
-		if info.IsDir() || clean == "." {
+		// skip the root marker "."
+		if clean == "." {
 			return nil
 		}
 
-		// if not tracked, remove (or print if dry run)
-		if _, tracked := index[clean]; !tracked {
-			// Check if file is ignored
-			isIgnored := ShouldIgnore(clean, ignorePatterns, index)
-
-			// Skip ignored files unless -x flag is set
-			if isIgnored && !includeIgnored {
+		if info.IsDir() {
+			if !opts.Directories || trackedDirs[clean] {
 				return nil
 			}
-
-			if dryRun {
-				if isIgnored {
-					fmt.Printf("Would remove (ignored) %s\n", clean)
-				} else {
-					fmt.Printf("Would remove %s\n", clean)
-				}
+			// An untracked directory goes as a whole, unless it holds files we must keep
+			canRemove, err := dirRemovable(clean, removable)
+			if err != nil {
+				return err
+			}
+			if !canRemove {
 				return nil
 			}
-			fmt.Printf("Removing %s\n", clean)
-			return os.Remove(clean)
+			if err := remove(clean, clean+string(os.PathSeparator), false); err != nil {
+				return err
+			}
+			return filepath.SkipDir
+		}
+
+		// if not tracked, remove (or print if dry run)
+		if ok, isIgnored := removable(clean); ok {
+			return remove(clean, clean, isIgnored)
 		}
 		return nil
 	})
 	return err
 }
+
+// dirRemovable reports whether every file below dir may be removed
+func dirRemovable(dir string, removable func(string) (bool, bool)) (bool, error) {
+	canRemove := true
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if ok, _ := removable(filepath.Clean(path)); !ok {
+			canRemove = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return canRemove, err
+}
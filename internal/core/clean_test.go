@@ -0,0 +1,141 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	defer ClearIgnoreCache()
+
+	setup := func() {
+		t.Helper()
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		files := map[string]string{
+			".kitignore":       "*.log\n",
+			"keep/tracked.txt": "tracked\n",
+			"u.txt":            "untracked\n",
+			"keep/sub/u.txt":   "untracked\n",
+			"new/x.txt":        "untracked\n",
+			"new/deep/y.txt":   "untracked\n",
+			"debug.log":        "ignored\n",
+			"logs/z.log":       "ignored\n",
+			"keep/tracked.log": "ignored\n",
+		}
+		for path, content := range files {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.Mkdir("empty", 0755); err != nil {
+			t.Fatal(err)
+		}
+		// Patterns read by an earlier test belong to another repository
+		ClearIgnoreCache()
+		for _, path := range []string{".kitignore", "keep/tracked.txt"} {
+			if err := AddFile(path); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// survivors lists every file and directory outside the repo dir, with a
+	// trailing slash on directories
+	survivors := func() string {
+		t.Helper()
+		var paths []string
+		err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == RepoDir {
+				return filepath.SkipDir
+			}
+			if path == "." {
+				return nil
+			}
+			if info.IsDir() {
+				path += "/"
+			}
+			paths = append(paths, filepath.ToSlash(path))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(paths)
+		return strings.Join(paths, " ")
+	}
+
+	everything := ".kitignore debug.log empty/ keep/ keep/sub/ keep/sub/u.txt keep/tracked.log keep/tracked.txt logs/ logs/z.log new/ new/deep/ new/deep/y.txt new/x.txt u.txt"
+	tests := []struct {
+		name   string
+		opts   CleanOptions
+		want   string
+		output []string
+	}{
+		{
+			name: "untracked files",
+			opts: CleanOptions{},
+			// Directories emptied by the removal go too, others stay
+			want: ".kitignore debug.log empty/ keep/ keep/tracked.log keep/tracked.txt logs/ logs/z.log",
+		},
+		{
+			name:   "dry run",
+			opts:   CleanOptions{DryRun: true},
+			want:   everything,
+			output: []string{"Would remove u.txt\n", "Would remove keep/sub/u.txt\n", "Would remove new/x.txt\n"},
+		},
+		{
+			name: "directories",
+			opts: CleanOptions{Directories: true},
+			// A directory holding only ignored files must be kept
+			want: ".kitignore debug.log keep/ keep/tracked.log keep/tracked.txt logs/ logs/z.log",
+		},
+		{
+			name: "ignored",
+			opts: CleanOptions{IncludeIgnored: true},
+			want: ".kitignore empty/ keep/ keep/tracked.txt",
+		},
+		{
+			name: "directories and ignored",
+			opts: CleanOptions{Directories: true, IncludeIgnored: true},
+			want: ".kitignore keep/ keep/tracked.txt",
+		},
+		{
+			name:   "dry run with directories and ignored",
+			opts:   CleanOptions{DryRun: true, Directories: true, IncludeIgnored: true},
+			want:   everything,
+			output: []string{"Would remove (ignored) debug.log\n", "Would remove new/\n", "Would remove empty/\n", "Would remove logs/\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup()
+			out := captureStdout(t, func() error { return Clean(tt.opts) })
+			if got := survivors(); got != tt.want {
+				t.Errorf("left\n%s\nwant\n%s", got, tt.want)
+			}
+			for _, line := range tt.output {
+				if !strings.Contains(out, line) {
+					t.Errorf("output is missing %q:\n%s", line, out)
+				}
+			}
+		})
+	}
+}
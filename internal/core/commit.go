@@ -10,7 +10,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/LeeFred3042U/kitcat/internal/diff"
 	"github.com/LeeFred3042U/kitcat/internal/models"
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
@@ -23,19 +22,163 @@ func hashCommit(c models.Commit) string {
 	h.Write([]byte(c.Parent))
 	h.Write([]byte(c.Message))
 	h.Write([]byte(c.Timestamp.UTC().Format(time.RFC3339Nano)))
+	if c.CommitterName != "" {
+		h.Write([]byte(c.CommitterName))
+		h.Write([]byte(c.CommitterEmail))
+		h.Write([]byte(c.CommitTime.UTC().Format(time.RFC3339Nano)))
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
+// configIdentity returns the user name and email from the global config,
+// falling back to placeholders when they are not set
+func configIdentity() (name, email string) {
+	name, _, _ = GetConfig("user.name")
+	if name == "" {
+		name = "Unknown"
+	}
+	email, _, _ = GetConfig("user.email")
+	if email == "" {
+		email = "unknown@example.com"
+	}
+	return name, email
+}
+
+// commitOptions carries the metadata of a commit being created. The committer
+// defaults to the one committerIdent returns.
+type commitOptions struct {
+	Message        string
+	AuthorName     string
+	AuthorEmail    string
+	Timestamp      time.Time
+	CommitterName  string
+	CommitterEmail string
+	CommitTime     time.Time
+	Amend          bool // Replace HEAD: commit on top of its parent instead
+	AllowEmpty     bool // Record the commit even if its tree matches its parent's
+}
+
+// CommitOptions controls how a commit is recorded
+type CommitOptions struct {
+	All      bool      // Stage changes to tracked files first, like `commit -a`
+	Author   string    // Override the author, as "Name <email>"
+	Date     string    // Override the author date
+	Edit     bool      // Open the editor on the message before committing
+	Template string    // File the message starts from when editing an empty message; commit.template if empty
+	Signoff  bool      // Add a Signed-off-by trailer for the committer
+	Trailers []Trailer // Trailers to add to the message
+	Amend    bool      // Replace HEAD, keeping its author, date and (without a new message) its message
+	// With Amend, take the author and date from the environment or config instead of HEAD
+	ResetAuthor       bool
+	AllowEmpty        bool // Commit even when nothing changed, e.g. to mark a deploy
+	AllowEmptyMessage bool // Commit even when the message is empty
+}
+
 // Commit creates a new snapshot of the repository based on the current state of the index
 // It prevents empty commits and returns the full commit object and a formatted summary
 func Commit(message string) (models.Commit, string, error) {
-	authorName, _, _ := GetConfig("user.name")
-	if authorName == "" {
-		authorName = "Unknown"
+	return CommitWithOptions(message, CommitOptions{})
+}
+
+// CommitWithOptions is Commit with the author and date taken from opts when
+// given, and from the KITKAT_AUTHOR_* environment variables or the config
+// otherwise. The message is cleaned up first, and an empty one aborts the commit.
+// With opts.Amend the index is committed in place of HEAD, on top of its parent.
+func CommitWithOptions(message string, opts CommitOptions) (models.Commit, string, error) {
+	author, err := authorIdent()
+	if err != nil {
+		return models.Commit{}, "", err
+	}
+	if opts.Amend {
+		head, err := GetHeadCommit()
+		if err != nil {
+			return models.Commit{}, "", errors.New("no commits to amend")
+		}
+		if !opts.ResetAuthor {
+			author = identity{Name: head.AuthorName, Email: head.AuthorEmail, When: head.Timestamp}
+		}
+		if message == "" {
+			message = head.Message
+		}
+	}
+	if opts.Author != "" {
+		if author.Name, author.Email, err = ParseIdent(opts.Author); err != nil {
+			return models.Commit{}, "", err
+		}
+	}
+	if opts.Date != "" {
+		if author.When, err = ParseDate(opts.Date); err != nil {
+			return models.Commit{}, "", err
+		}
+	}
+	if opts.All {
+		if err := AddAll(); err != nil {
+			return models.Commit{}, "", fmt.Errorf("failed to stage changes before committing: %w", err)
+		}
+	}
+	if message, err = commitMessage(message, opts); err != nil {
+		return models.Commit{}, "", err
+	}
+	return createCommit(commitOptions{
+		Message:     message,
+		AuthorName:  author.Name,
+		AuthorEmail: author.Email,
+		Timestamp:   author.When,
+		Amend:       opts.Amend,
+		AllowEmpty:  opts.AllowEmpty,
+	})
+}
+
+// CommitDryRun prints the status of what a commit with opts would record,
+// without changing anything, and reports whether the commit could be made
+func CommitDryRun(opts CommitOptions) (bool, error) {
+	base, err := loadHeadTree()
+	if err != nil {
+		return false, err
+	}
+	if opts.Amend {
+		// An amended commit replaces HEAD, so it is compared with HEAD's parent
+		head, err := GetHeadCommit()
+		if err != nil {
+			return false, errors.New("no commits to amend")
+		}
+		base = make(map[string]storage.TreeEntry)
+		if head.Parent != "" {
+			parent, err := storage.FindCommit(head.Parent)
+			if err != nil {
+				return false, err
+			}
+			if base, err = storage.ParseTreeEntries(parent.TreeHash); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return false, err
+	}
+	if opts.All {
+		// Stage into the loaded entries only; the index on disk is left alone
+		if err := addPaths(entries, nil); err != nil {
+			return false, err
+		}
+	}
+	report, err := collectStatusOf(nil, base, entries)
+	if err != nil {
+		return false, err
 	}
-	authorEmail, _, _ := GetConfig("user.email")
-	if authorEmail == "" {
-		authorEmail = "unknown@example.com"
+	report.write(os.Stdout, "")
+	return len(report.Staged) > 0 || opts.AllowEmpty, nil
+}
+
+// createCommit records the index as a new commit on top of HEAD (or in place
+// of it when amending) using the given metadata and advances the current
+// branch to it
+func createCommit(opts commitOptions) (models.Commit, string, error) {
+	// The index may be half way between two trees
+	if IsCheckoutInterrupted() {
+		return models.Commit{}, "", errInterruptedCheckout
 	}
 
 	treeHash, err := storage.CreateTree()
@@ -45,24 +188,49 @@ func Commit(message string) (models.Commit, string, error) {
 
 	var parentID, parentTreeHash string
 	parentCommit, err := GetHeadCommit()
-	// If error, we assume root commit (no parent) unless critical system error
-	// In strict world, we'd check error type.
-	if err == nil {
+	if opts.Amend {
+		if err != nil {
+			return models.Commit{}, "", errors.New("no commits to amend")
+		}
+		parentID = parentCommit.Parent
+		parentCommit = models.Commit{}
+		if parentID != "" {
+			if parentCommit, err = storage.FindCommit(parentID); err != nil {
+				return models.Commit{}, "", err
+			}
+		}
+		parentTreeHash = parentCommit.TreeHash
+	} else if err == nil {
+		// If error, we assume root commit (no parent) unless critical system error
+		// In strict world, we'd check error type.
 		parentID = parentCommit.ID
 		parentTreeHash = parentCommit.TreeHash
 	}
 
-	if treeHash == parentTreeHash {
+	if treeHash == parentTreeHash && !opts.AllowEmpty {
+		if opts.Amend {
+			return models.Commit{}, "", errors.New("amending would make the commit empty")
+		}
 		return models.Commit{}, "", errors.New("nothing to commit, working tree clean")
 	}
 
+	if opts.CommitterName == "" {
+		committer, err := committerIdent()
+		if err != nil {
+			return models.Commit{}, "", err
+		}
+		opts.CommitterName, opts.CommitterEmail, opts.CommitTime = committer.Name, committer.Email, committer.When
+	}
 	commit := models.Commit{
-		Parent:      parentID,
-		Message:     message,
-		Timestamp:   time.Now().UTC(),
-		TreeHash:    treeHash,
-		AuthorName:  authorName,
-		AuthorEmail: authorEmail,
+		Parent:         parentID,
+		Message:        opts.Message,
+		Timestamp:      opts.Timestamp,
+		TreeHash:       treeHash,
+		AuthorName:     opts.AuthorName,
+		AuthorEmail:    opts.AuthorEmail,
+		CommitterName:  opts.CommitterName,
+		CommitterEmail: opts.CommitterEmail,
+		CommitTime:     opts.CommitTime,
 	}
 	commit.ID = hashCommit(commit)
 
@@ -70,24 +238,19 @@ func Commit(message string) (models.Commit, string, error) {
 		return models.Commit{}, "", err
 	}
 
-	refPath, err := getCurrentBranchRefPath()
+	// Advance the current branch, or HEAD itself when it is detached
+	headData, err := os.ReadFile(HeadPath)
 	if err != nil {
-		headData, readErr := os.ReadFile(".kitkat/HEAD")
-		if readErr != nil {
-			return models.Commit{}, "", fmt.Errorf("could not read HEAD: %w", readErr)
-		}
-		ref := strings.TrimSpace(string(headData))
-		if !strings.HasPrefix(ref, "ref: ") {
-			return models.Commit{}, "", fmt.Errorf("cannot commit in detached HEAD state")
-		}
-		refPath = strings.TrimPrefix(ref, "ref: ")
-		if err := os.MkdirAll(filepath.Dir(filepath.Join(".kitkat", refPath)), 0755); err != nil {
+		return models.Commit{}, "", fmt.Errorf("could not read HEAD: %w", err)
+	}
+	refFile := HeadPath
+	if refPath, ok := strings.CutPrefix(strings.TrimSpace(string(headData)), "ref: "); ok {
+		refFile = filepath.Join(".kitkat", refPath)
+		if err := os.MkdirAll(filepath.Dir(refFile), 0755); err != nil {
 			return models.Commit{}, "", fmt.Errorf("could not create refs directory: %w", err)
 		}
 	}
-
-	branchFilePath := filepath.Join(".kitkat", refPath)
-	if err := SafeWrite(branchFilePath, []byte(commit.ID), 0644); err != nil {
+	if err := SafeWrite(refFile, []byte(commit.ID), 0644); err != nil {
 		return models.Commit{}, "", fmt.Errorf("failed to update branch pointer: %w", err)
 	}
 
@@ -101,68 +264,9 @@ func Commit(message string) (models.Commit, string, error) {
 	return commit, summary, nil
 }
 
-// AmendCommit updates the message of the most recent commit without changing files.
-// It loads the last commit, updates its message, re-hashes it, and updates the branch pointer.
-func AmendCommit(newMessage string) (models.Commit, error) {
-	// Get the last commit
-	lastCommit, err := storage.GetLastCommit()
-	if err != nil {
-		if err == storage.ErrNoCommits {
-			return models.Commit{}, errors.New("no commits to amend")
-		}
-		return models.Commit{}, fmt.Errorf("failed to get last commit: %w", err)
-	}
-
-	// Create a new commit with the updated message but same tree and parent
-	amendedCommit := models.Commit{
-		Parent:      lastCommit.Parent,
-		Message:     newMessage,
-		Timestamp:   lastCommit.Timestamp, // Keep original timestamp
-		TreeHash:    lastCommit.TreeHash,  // Same files
-		AuthorName:  lastCommit.AuthorName,
-		AuthorEmail: lastCommit.AuthorEmail,
-	}
-
-	// Re-hash the commit (this generates a new ID)
-	amendedCommit.ID = hashCommit(amendedCommit)
-
-	// Save the amended commit
-	if err := storage.AppendCommit(amendedCommit); err != nil {
-		return models.Commit{}, fmt.Errorf("failed to save amended commit: %w", err)
-	}
-
-	// Update the branch pointer to the new commit ID
-	refPath, err := getCurrentBranchRefPath()
-	if err != nil {
-		return models.Commit{}, fmt.Errorf("failed to get current branch: %w", err)
-	}
-
-	branchFilePath := filepath.Join(".kitkat", refPath)
-	if err := SafeWrite(branchFilePath, []byte(amendedCommit.ID), 0644); err != nil {
-		return models.Commit{}, fmt.Errorf("failed to update branch pointer: %w", err)
-	}
-
-	return amendedCommit, nil
-}
-
 // CommitAll is a convenience function that implements the `commit -am` shortcut.
 func CommitAll(message string) (models.Commit, string, error) {
-	if err := AddAll(); err != nil {
-		return models.Commit{}, "", fmt.Errorf("failed to stage changes before committing: %w", err)
-	}
-	return Commit(message)
-}
-
-func getCurrentBranchRefPath() (string, error) {
-	headData, err := os.ReadFile(".kitkat/HEAD")
-	if err != nil {
-		return "", err
-	}
-	ref := strings.TrimSpace(string(headData))
-	if !strings.HasPrefix(ref, "ref: ") {
-		return "", fmt.Errorf("invalid HEAD format: %s", ref)
-	}
-	return strings.TrimPrefix(ref, "ref: "), nil
+	return CommitWithOptions(message, CommitOptions{All: true})
 }
 
 // pluralize is a simple helper for the summary string
@@ -176,49 +280,21 @@ func pluralize(count int) string {
 // GenerateCommitSummary compares parent and new trees to create a formatted summary
 // of files changed, lines inserted, and lines deleted
 func GenerateCommitSummary(parentTree, newTree map[string]string) (string, error) {
-	filesChanged, insertions, deletions := 0, 0, 0
-	allPaths := make(map[string]bool)
-	for path := range parentTree {
-		allPaths[path] = true
-	}
-	for path := range newTree {
-		allPaths[path] = true
-	}
-
-	for path := range allPaths {
-		oldHash, inOld := parentTree[path]
-		newHash, inNew := newTree[path]
-
-		if inOld && !inNew {
-			filesChanged++
-			oldContent, _ := storage.ReadObject(oldHash)
-			deletions += len(strings.Split(string(oldContent), "\n"))
-		} else if !inOld && inNew {
-			filesChanged++
-			newContent, _ := storage.ReadObject(newHash)
-			insertions += len(strings.Split(string(newContent), "\n"))
-		} else if inOld && inNew && oldHash != newHash {
-			filesChanged++
-			oldContent, _ := storage.ReadObject(oldHash)
-			newContent, _ := storage.ReadObject(newHash)
-			d := diff.NewMyersDiff(strings.Split(string(oldContent), "\n"), strings.Split(string(newContent), "\n"))
-			for _, chk := range d.Diffs() {
-				if chk.Operation == diff.INSERT {
-					insertions += len(chk.Text)
-				}
-				if chk.Operation == diff.DELETE {
-					deletions += len(chk.Text)
-				}
-			}
-		}
+	changes, err := treeChanges(parentTree, newTree)
+	if err != nil {
+		return "", err
 	}
 
-	plural := "s"
-	if filesChanged == 1 {
-		plural = ""
+	insertions, deletions := 0, 0
+	for _, c := range changes {
+		added, deleted := countLineChanges(c.Old, c.New, DiffOptions{})
+		insertions += added
+		deletions += deleted
 	}
+
+	filesChanged := len(changes)
 	return fmt.Sprintf("%d file%s changed, %d insertion%s(+), %d deletion%s(-)",
-		filesChanged, plural,
+		filesChanged, pluralize(filesChanged),
 		insertions, pluralize(insertions),
 		deletions, pluralize(deletions)), nil
 }
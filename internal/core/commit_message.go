@@ -0,0 +1,159 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commitEditMsgPath is the file the commit message is edited in
+const commitEditMsgPath = ".kitkat/COMMIT_EDITMSG"
+
+// errEmptyMessage is returned when a commit message is empty after cleanup
+var errEmptyMessage = errors.New("aborting commit due to empty commit message")
+
+// commitMessageHelp is the comment placed under the message in the editor
+const commitMessageHelp = `
+# Please enter the commit message for your changes. Lines starting
+# with '#' will be ignored, and an empty message aborts the commit.
+#
+`
+
+// CommitSubject returns the first line of a commit message
+func CommitSubject(message string) string {
+	subject, _, _ := strings.Cut(message, "\n")
+	return subject
+}
+
+// CleanupMessage tidies a commit message: trailing whitespace is removed from
+// every line, runs of blank lines are collapsed and leading and trailing blank
+// lines are dropped. With stripComments, lines starting with '#' are removed.
+func CleanupMessage(message string, stripComments bool) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// readCommitTemplate returns the contents of the commit template at path, or of
+// the one commit.template names when path is empty. "~/" is expanded to the
+// home directory. No template is an empty string.
+func readCommitTemplate(path string) (string, error) {
+	if path == "" {
+		path, _, _ = GetConfig("commit.template")
+		if path == "" {
+			return "", nil
+		}
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(home, rest)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read commit template: %w", err)
+	}
+	return string(content), nil
+}
+
+// editCommitMessage lets the user write a commit message in their editor. The
+// file starts with initial, followed by a commented summary of the status.
+// The result has comments stripped.
+func editCommitMessage(initial string) (string, error) {
+	report, err := collectStatus(nil)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	buf.WriteString(initial)
+	if initial != "" && !strings.HasSuffix(initial, "\n") {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(commitMessageHelp)
+	report.write(&buf, "# ")
+	if err := os.WriteFile(commitEditMsgPath, buf.Bytes(), 0644); err != nil {
+		return "", err
+	}
+	if err := runEditor(commitEditMsgPath); err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(commitEditMsgPath)
+	if err != nil {
+		return "", err
+	}
+	return CleanupMessage(string(content), true), nil
+}
+
+// commitMessage returns the cleaned up message of a new commit, letting the
+// user edit it first when opts asks to
+func commitMessage(message string, opts CommitOptions) (string, error) {
+	if !opts.Edit {
+		if message = CleanupMessage(message, false); message == "" && !opts.AllowEmptyMessage {
+			return "", errEmptyMessage
+		}
+		return addCommitTrailers(message, opts)
+	}
+
+	// Don't make the user write a message for a commit that can't be made
+	if !opts.Amend && !opts.AllowEmpty {
+		staged, err := hasStagedChanges()
+		if err != nil {
+			return "", err
+		}
+		if !staged {
+			return "", errors.New("nothing to commit, working tree clean")
+		}
+	}
+
+	var template string
+	var err error
+	if message == "" {
+		if template, err = readCommitTemplate(opts.Template); err != nil {
+			return "", err
+		}
+		message = template
+	}
+	if message, err = editCommitMessage(message); err != nil {
+		return "", err
+	}
+	if message == "" && !opts.AllowEmptyMessage {
+		return "", errEmptyMessage
+	}
+	if template != "" && message == CleanupMessage(template, true) {
+		return "", errors.New("aborting commit; you did not edit the message")
+	}
+	return addCommitTrailers(message, opts)
+}
+
+// addCommitTrailers adds the trailers opts asks for to a commit message
+func addCommitTrailers(message string, opts CommitOptions) (string, error) {
+	trailers := opts.Trailers
+	if opts.Signoff {
+		signoff, err := signoffTrailer()
+		if err != nil {
+			return "", err
+		}
+		trailers = append(trailers, signoff)
+	}
+	return AddTrailers(message, trailers), nil
+}
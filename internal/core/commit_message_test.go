@@ -0,0 +1,138 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCleanupMessage(t *testing.T) {
+	tests := []struct {
+		in    string
+		strip bool
+		want  string
+	}{
+		{"subject", false, "subject"},
+		{"\n\nsubject  \n\n\n\nbody\t\n\n", false, "subject\n\nbody"},
+		{"subject\n# comment\n\n# another\nbody\n", true, "subject\n\nbody"},
+		{"# heading kept\nbody", false, "# heading kept\nbody"},
+		{"# only comments\n#\n", true, ""},
+	}
+	for _, tt := range tests {
+		if got := CleanupMessage(tt.in, tt.strip); got != tt.want {
+			t.Errorf("CleanupMessage(%q, %v) = %q, want %q", tt.in, tt.strip, got, tt.want)
+		}
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("editor scripts need a POSIX shell")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("KITKAT_COMMITTER_NAME", "Ada")
+	t.Setenv("KITKAT_COMMITTER_EMAIL", "ada@example.com")
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// editor points EDITOR at a script run with the message file as $1. The
+	// file as the editor found it is kept in "seen".
+	scripts := t.TempDir()
+	editor := func(name, body string) {
+		t.Helper()
+		path := filepath.Join(scripts, name)
+		script := "#!/bin/sh\ncp \"$1\" " + filepath.Join(scripts, "seen") + "\n" + body + "\n"
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("EDITOR", path)
+	}
+	seen := func() string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(scripts, "seen"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	// Nothing staged: the editor is not even opened
+	editor("unused", "exit 1")
+	if _, err := commitMessage("", CommitOptions{Edit: true}); err == nil || !strings.Contains(err.Error(), "nothing to commit") {
+		t.Errorf("editing with nothing staged gave %v", err)
+	}
+
+	if err := os.WriteFile("f.txt", []byte("f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("f.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("tmpl.txt", []byte("Subject\n\n# Explain why\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "config.tmpl"), []byte("From config\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		opts    CommitOptions
+		script  string
+		want    string
+		wantErr string
+	}{
+		{name: "message", message: "subject  \n\n\n\nbody\n", want: "subject\n\nbody"},
+		{name: "empty message", message: "\n \n", wantErr: "empty commit message"},
+		{name: "allowed empty message", message: "", opts: CommitOptions{AllowEmptyMessage: true}, want: ""},
+		{name: "signoff", message: "subject", opts: CommitOptions{Signoff: true}, want: "subject\n\nSigned-off-by: Ada <ada@example.com>"},
+		{name: "edited", opts: CommitOptions{Edit: true}, script: `echo "written # here" >> "$1"`, want: "written # here"},
+		{name: "edited message", message: "given", opts: CommitOptions{Edit: true}, script: `echo "# note" >> "$1"`, want: "given"},
+		{name: "emptied", message: "given", opts: CommitOptions{Edit: true}, script: `: > "$1"`, wantErr: "empty commit message"},
+		{name: "editor fails", opts: CommitOptions{Edit: true}, script: "exit 1", wantErr: "failed to run editor"},
+		{name: "template", opts: CommitOptions{Edit: true, Template: "tmpl.txt"}, script: `echo "More" >> "$1"`, want: "Subject\n\nMore"},
+		{name: "unedited template", opts: CommitOptions{Edit: true, Template: "tmpl.txt"}, script: "true", wantErr: "did not edit the message"},
+		{name: "missing template", opts: CommitOptions{Edit: true, Template: "nope.txt"}, script: "true", wantErr: "could not read commit template"},
+		{name: "configured template", opts: CommitOptions{Edit: true}, script: `sed -i.bak 's/config/the config/' "$1"`, want: "From the config"},
+	}
+	for _, tt := range tests {
+		if tt.name == "configured template" {
+			if err := SetConfig("commit.template", "~/config.tmpl"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		editor(strings.ReplaceAll(tt.name, " ", "-"), tt.script)
+		got, err := commitMessage(tt.message, tt.opts)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: got %q, %v; want error %q", tt.name, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// The editor starts from the template and a commented status summary
+	editor("check", `echo "More" >> "$1"`)
+	if _, err := commitMessage("", CommitOptions{Edit: true, Template: "tmpl.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if content := seen(); !strings.HasPrefix(content, "Subject\n\n# Explain why\n") || !strings.Contains(content, "#\tnew file:  f.txt") {
+		t.Errorf("editor was given\n%s", content)
+	}
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestAmendCommitsIndexOnHeadParent(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile := func(content, message string, opts CommitOptions) string {
+		t.Helper()
+		if err := os.WriteFile("f.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := CommitWithOptions(message, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.ID
+	}
+
+	first := commitFile("one\n", "first", CommitOptions{Author: "Ada <ada@example.com>", Date: "2020-01-02T03:04:05Z"})
+	commitFile("two\n", "second", CommitOptions{})
+
+	// After a reset, amending rewrites HEAD rather than the newest commit,
+	// and takes the staged content with it
+	if err := Reset(first, ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	amended := commitFile("three\n", "", CommitOptions{Amend: true})
+	c, err := storage.FindCommit(amended)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Parent != "" || c.Message != "first" {
+		t.Errorf("amended commit has parent %q and message %q", c.Parent, c.Message)
+	}
+	if c.AuthorName != "Ada" || !c.Timestamp.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("amend changed the author to %s at %v", c.AuthorName, c.Timestamp)
+	}
+	if tree, _ := storage.ParseTree(c.TreeHash); tree["f.txt"] == "" {
+		t.Fatal("amended commit lost f.txt")
+	} else if content, _ := storage.ReadObject(tree["f.txt"]); string(content) != "three\n" {
+		t.Errorf("amended commit has f.txt %q, want the staged content", content)
+	}
+
+	// Amending in detached HEAD moves HEAD itself
+	if err := CheckoutCommit(amended, CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	detached := commitFile("four\n", "fourth", CommitOptions{Amend: true, ResetAuthor: true})
+	if head, _ := readHead(); head != detached {
+		t.Errorf("HEAD is %s, want the amended commit %s", head, detached)
+	}
+	if branch, _ := os.ReadFile(".kitkat/refs/heads/main"); string(branch) != amended {
+		t.Errorf("main moved to %s while HEAD was detached", branch)
+	}
+}
+
+func TestAllowEmptyCommits(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("f.txt", []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("f.txt"); err != nil {
+		t.Fatal(err)
+	}
+	base, _, err := Commit("base")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Commit("marker"); err == nil {
+		t.Fatal("empty commit was made without AllowEmpty")
+	}
+	marker, _, err := CommitWithOptions("marker", CommitOptions{AllowEmpty: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marker.Parent != base.ID || marker.TreeHash != base.TreeHash {
+		t.Errorf("marker commit has parent %s and tree %s", marker.Parent, marker.TreeHash)
+	}
+
+	if _, _, err := CommitWithOptions("  \n", CommitOptions{AllowEmpty: true}); err != errEmptyMessage {
+		t.Errorf("got %v for an empty message, want %v", err, errEmptyMessage)
+	}
+	if c, _, err := CommitWithOptions("", CommitOptions{AllowEmpty: true, AllowEmptyMessage: true}); err != nil || c.Message != "" {
+		t.Errorf("got %q, %v with AllowEmptyMessage", c.Message, err)
+	}
+}
+
+func TestCommitDryRun(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("f.txt", "one\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("base"); err != nil {
+		t.Fatal(err)
+	}
+
+	// -a would commit a new file, so the dry run succeeds without staging it
+	write("new.txt", "new\n")
+	if ok, err := CommitDryRun(CommitOptions{}); err != nil || ok {
+		t.Errorf("dry run without -a = %v, %v; want false", ok, err)
+	}
+	if ok, err := CommitDryRun(CommitOptions{All: true}); err != nil || !ok {
+		t.Errorf("dry run with -a = %v, %v; want true", ok, err)
+	}
+	if entries, _ := storage.LoadIndexEntries(); len(entries) != 2 {
+		t.Errorf("dry run changed the index to %d entries", len(entries))
+	}
+	if err := os.Remove("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Amending a commit back to its parent's content would make it empty;
+	// amending it with a change would not
+	write("f.txt", "two\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("second"); err != nil {
+		t.Fatal(err)
+	}
+	write("f.txt", "one\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := CommitDryRun(CommitOptions{Amend: true}); err != nil || ok {
+		t.Errorf("dry run of an empty amend = %v, %v; want false", ok, err)
+	}
+	if _, _, err := CommitWithOptions("", CommitOptions{Amend: true}); err == nil {
+		t.Error("empty amend was committed")
+	}
+	write("f.txt", "three\n")
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := CommitDryRun(CommitOptions{Amend: true}); err != nil || !ok {
+		t.Errorf("dry run of an amend = %v, %v; want true", ok, err)
+	}
+}
@@ -1,9 +1,13 @@
 package core
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/diff"
@@ -18,6 +22,69 @@ const (
 	colorBlue  = "\033[1;34m"
 )
 
+// DiffFormat selects how a set of file changes is rendered
+type DiffFormat int
+
+const (
+	// DiffPatch prints the full line-by-line diff of every changed file
+	DiffPatch DiffFormat = iota
+	// DiffStat prints a per-file histogram of insertions and deletions
+	DiffStat
+	// DiffNumstat prints machine-readable "added<TAB>deleted<TAB>path" lines
+	DiffNumstat
+	// DiffNameOnly prints only the names of changed files
+	DiffNameOnly
+	// DiffNameStatus prints the names of changed files prefixed with A, M or D
+	DiffNameStatus
+)
+
+// DiffOptions controls the output of Diff
+type DiffOptions struct {
+	Format    DiffFormat
+	WordDiff  WordDiffMode   // Intra-line highlighting used by DiffPatch
+	WordRegex *regexp.Regexp // What counts as a word; nil means runs of non-whitespace
+
+	IgnoreAllSpace    bool // -w: ignore all whitespace when comparing lines
+	IgnoreSpaceChange bool // -b: ignore changes in the amount of whitespace
+	IgnoreBlankLines  bool // ignore changes whose lines are all blank
+	IgnoreCRAtEOL     bool // ignore a carriage return at the end of a line
+}
+
+// statBarWidth is the maximum number of +/- characters drawn per file by --stat
+const statBarWidth = 40
+
+// fileChange describes a single path that differs between two snapshots.
+// Old and New hold the full contents on each side; a missing side is nil.
+type fileChange struct {
+	Path   string
+	Status byte // 'A' (added), 'M' (modified) or 'D' (deleted)
+	Old    []byte
+	New    []byte
+}
+
+// splitLines splits file content into lines for the diff engine.
+// A trailing newline does not produce an extra empty line and empty content has no lines.
+func splitLines(content []byte) []string {
+	s := strings.TrimSuffix(string(content), "\n")
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+// countLineChanges returns the number of inserted and deleted lines between two file contents
+func countLineChanges(oldContent, newContent []byte, opts DiffOptions) (insertions, deletions int) {
+	for _, chk := range lineDiff(splitLines(oldContent), splitLines(newContent), opts) {
+		switch chk.Operation {
+		case diff.INSERT:
+			insertions += len(chk.Text)
+		case diff.DELETE:
+			deletions += len(chk.Text)
+		}
+	}
+	return insertions, deletions
+}
+
 // displayDiff formats and prints the structured diff output from the Myers algorithm.
 // It iterates through each change (insertion, deletion, or equal) and applies the appropriate color
 func displayDiff(diffs []diff.Diff[string]) {
@@ -44,193 +111,324 @@ func displayDiff(diffs []diff.Diff[string]) {
 	}
 }
 
-// Diff calculates and displays the differences between the last commit and the current staging area (index)
-// It identifies which files have been added, deleted, or modified.
-func Diff(staged bool) error {
-	// Retrieve the metadata for the most recent commit.
-	lastCommit, err := storage.GetLastCommit()
-	if err != nil {
-		// If there are no commits yet, there's nothing to compare against.
-		if err == storage.ErrNoCommits {
-			fmt.Println("No commits yet. Nothing to diff against.")
-			return nil
+// printPatch diffs two file contents line by line and prints the result,
+// using word-level highlighting when the options ask for it
+func printPatch(oldContent, newContent []byte, opts DiffOptions) {
+	diffs := lineDiff(splitLines(oldContent), splitLines(newContent), opts)
+	if opts.WordDiff != WordDiffNone {
+		displayWordDiff(diffs, opts)
+		return
+	}
+	displayDiff(diffs)
+}
+
+// treeChanges compares two path -> hash maps and loads the contents of every changed file.
+// The result is sorted by path so that output is deterministic.
+func treeChanges(oldTree, newTree map[string]string) ([]fileChange, error) {
+	var changes []fileChange
+	for path, newHash := range newTree {
+		oldHash, inOld := oldTree[path]
+		if inOld && oldHash == newHash {
+			continue
 		}
-		return err
+		newContent, err := storage.ReadObject(newHash)
+		if err != nil {
+			return nil, err
+		}
+		change := fileChange{Path: path, Status: 'A', New: newContent}
+		if inOld {
+			oldContent, err := storage.ReadObject(oldHash)
+			if err != nil {
+				return nil, err
+			}
+			change.Status = 'M'
+			change.Old = oldContent
+		}
+		changes = append(changes, change)
+	}
+	for path, oldHash := range oldTree {
+		if _, inNew := newTree[path]; inNew {
+			continue
+		}
+		oldContent, err := storage.ReadObject(oldHash)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, fileChange{Path: path, Status: 'D', Old: oldContent})
 	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
 
-	// Load the current staging area into a map. This represents what will be in the *next* commit
-	index, err := storage.LoadIndex()
-	if err != nil {
-		return err
+// workdirChanges compares the index against the working directory.
+// Tracked files missing from disk are reported as deletions.
+func workdirChanges(entries map[string]storage.IndexEntry) ([]fileChange, error) {
+	var changes []fileChange
+	for path, entry := range entries {
+		// Unchanged stat data means unchanged content; skip reading either side
+		if info, err := os.Lstat(path); err == nil && entry.StatMatches(info) {
+			continue
+		}
+		indexHash := entry.Hash
+		indexContent, err := storage.ReadObject(indexHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read index object %s: %w", indexHash, err)
+		}
+		fileContent, err := readWorkFile(path)
+		if err != nil {
+			changes = append(changes, fileChange{Path: path, Status: 'D', Old: indexContent})
+			continue
+		}
+		if string(fileContent) != string(indexContent) {
+			changes = append(changes, fileChange{Path: path, Status: 'M', Old: indexContent, New: fileContent})
+		}
 	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
 
-	if staged {
+// effectiveChanges drops files whose only differences are ignored by the
+// whitespace options, so reformatted files do not show up at all
+func effectiveChanges(changes []fileChange, opts DiffOptions) []fileChange {
+	if !opts.ignoresWhitespace() {
+		return changes
+	}
+	var result []fileChange
+	for _, c := range changes {
+		if c.Status != 'M' {
+			result = append(result, c)
+			continue
+		}
+		if insertions, deletions := countLineChanges(c.Old, c.New, opts); insertions+deletions > 0 {
+			result = append(result, c)
+		}
+	}
+	return result
+}
 
-		// From the commit, get the tree object which represents the state of the repository at that time
-		// This is a map of `filePath -> contentHash`
-		tree, err := storage.ParseTree(lastCommit.TreeHash)
+// untrackedFiles returns every regular file in the working directory that is not in the index
+func untrackedFiles(index map[string]string) ([]string, error) {
+	var untracked []string
+	err := filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// First Loop: Iterate through files in the index to find additions and modifications
-		for path, indexHash := range index {
-			treeHash, ok := tree[path]
-			// If a file is in the index but not in the old tree, it's a new file.
-			if !ok {
-				fmt.Printf("%sAdded file: %s%s\n", colorBlue, path, colorReset)
-
-				// Show content of added file (all lines are additions)
-				content, err := storage.ReadObject(indexHash)
-				if err != nil {
-					return err
-				}
-
-				contentStr := strings.TrimRight(string(content), "\n")
-				fileLines := strings.Split(contentStr, "\n")
-				emptyLines := []string{}
-
-				myers := diff.NewMyersDiff(emptyLines, fileLines)
-				diffs := myers.Diffs()
-				displayDiff(diffs)
-				continue
+		// Skip .kitkat directory
+		if filepath.Base(path) == RepoDir {
+			if d.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
+		}
 
-			// If the file exists in both, but the content hash is different, it has been modified
-			if indexHash != treeHash {
-				fmt.Printf("%sModified file: %s%s\n", colorBlue, path, colorReset)
-
-				// Read the old and new content from the object store.
-				oldContent, err := storage.ReadObject(treeHash)
-				if err != nil {
-					return err
-				}
-				newContent, err := storage.ReadObject(indexHash)
-				if err != nil {
-					return err
-				}
-
-				// Split file content into lines to prepare for the diff algorithm
-				oldLines := strings.Split(string(oldContent), "\n")
-				newLines := strings.Split(string(newContent), "\n")
-
-				// Using the Myers algorithm to compute the differences
-				myers := diff.NewMyersDiff(oldLines, newLines)
-				diffs := myers.Diffs()
-
-				// Display the computed differences with color
-				displayDiff(diffs)
-			}
+		// Only process regular files
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
 		}
 
-		// Next Loop: Iterate through files in the old tree to find deletions.
-		for path := range tree {
-			// If a file was in the old tree but is no longer in the index, it has been deleted.
-			if _, ok := index[path]; !ok {
-				fmt.Printf("%sDeleted file: %s%s\n", colorBlue, path, colorReset)
-			}
+		relPath, err := filepath.Rel(".", path)
+		if err != nil {
+			return err
+		}
+		if _, ok := index[relPath]; !ok {
+			untracked = append(untracked, relPath)
 		}
-	} else {
-		// Case B: unstaged diff (Index vs Working Directory)
-		// Equivalent to `git diff` (not `--cached`)
+		return nil
+	})
+	return untracked, err
+}
 
-		for path, indexHash := range index {
-			// Read current working directory file
-			fileContent, err := os.ReadFile(path)
-			if err != nil {
-				// File deleted from working directory (but still staged)
-				fmt.Printf("%sDeleted (unstaged): %s%s\n", colorRed, path, colorReset)
-				continue
-			}
+// printChanges renders a list of file changes in the requested summary format.
+// DiffPatch is handled by the callers because its headers differ per context.
+func printChanges(changes []fileChange, opts DiffOptions) {
+	writeChanges(os.Stdout, changes, opts, isTerminal(os.Stdout))
+}
 
-			// Read staged content from index
-			indexContent, err := storage.ReadObject(indexHash)
-			if err != nil {
-				return fmt.Errorf("failed to read index object %s: %w", indexHash, err)
+// writeChanges writes the summary format printChanges renders
+func writeChanges(w io.Writer, changes []fileChange, opts DiffOptions, color bool) {
+	switch opts.Format {
+	case DiffNameOnly:
+		for _, c := range changes {
+			fmt.Fprintln(w, c.Path)
+		}
+	case DiffNameStatus:
+		for _, c := range changes {
+			fmt.Fprintf(w, "%c\t%s\n", c.Status, c.Path)
+		}
+	case DiffNumstat:
+		for _, c := range changes {
+			// Line counts mean nothing for binary files
+			if isBinary(c.Old) || isBinary(c.New) {
+				fmt.Fprintf(w, "-\t-\t%s\n", c.Path)
+				continue
 			}
+			insertions, deletions := countLineChanges(c.Old, c.New, opts)
+			fmt.Fprintf(w, "%d\t%d\t%s\n", insertions, deletions, c.Path)
+		}
+	case DiffStat:
+		writeStat(w, changes, opts, color)
+	}
+}
 
-			// Compare: working directory vs index (staged)
-			if string(fileContent) != string(indexContent) {
-				fmt.Printf("%sChanged (unstaged): %s%s\n", colorBlue, path, colorReset)
+// isBinary reports whether content looks binary, which like git means it has
+// a NUL byte in its first 8000 bytes
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
 
-				// Index content = "old" (what's staged)
-				// Working dir content = "new" (current changes)
-				indexLines := strings.Split(string(indexContent), "\n")
-				contentStr := strings.TrimRight(string(fileContent), "\n")
-				workDirLines := strings.Split(contentStr, "\n")
+// writeStat writes the --stat histogram followed by a one-line summary
+func writeStat(w io.Writer, changes []fileChange, opts DiffOptions, color bool) {
+	if len(changes) == 0 {
+		return
+	}
 
-				// Myers diff: staged (old) → working dir (new)
-				myers := diff.NewMyersDiff(indexLines, workDirLines)
-				diffs := myers.Diffs()
-				displayDiff(diffs)
-			}
+	type statLine struct {
+		path       string
+		insertions int
+		deletions  int
+		binary     bool
+		oldSize    int
+		newSize    int
+	}
+	lines := make([]statLine, 0, len(changes))
+	nameWidth, maxTotal := 0, 0
+	totalInsertions, totalDeletions := 0, 0
+	for _, c := range changes {
+		nameWidth = max(nameWidth, len(c.Path))
+		if isBinary(c.Old) || isBinary(c.New) {
+			lines = append(lines, statLine{path: c.Path, binary: true, oldSize: len(c.Old), newSize: len(c.New)})
+			continue
 		}
+		insertions, deletions := countLineChanges(c.Old, c.New, opts)
+		lines = append(lines, statLine{path: c.Path, insertions: insertions, deletions: deletions})
+		maxTotal = max(maxTotal, insertions+deletions)
+		totalInsertions += insertions
+		totalDeletions += deletions
+	}
 
-		// Untracked files: exist in working directory but not staged (recursive walk)
-		var untracked []string
-		err := filepath.WalkDir(".", func(path string, d os.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-
-			name := filepath.Base(path)
+	for _, l := range lines {
+		if l.binary {
+			fmt.Fprintf(w, " %-*s | Bin %d -> %d bytes\n", nameWidth, l.path, l.oldSize, l.newSize)
+			continue
+		}
+		plus, minus := l.insertions, l.deletions
+		// Scale the bar down proportionally when the largest change does not fit
+		if maxTotal > statBarWidth {
+			plus = (plus*statBarWidth + maxTotal - 1) / maxTotal
+			minus = (minus*statBarWidth + maxTotal - 1) / maxTotal
+		}
+		bar := strings.Repeat("+", plus) + strings.Repeat("-", minus)
+		if color {
+			bar = colorGreen + strings.Repeat("+", plus) + colorRed + strings.Repeat("-", minus) + colorReset
+		}
+		fmt.Fprintf(w, " %-*s | %*d %s\n",
+			nameWidth, l.path,
+			len(fmt.Sprint(maxTotal)), l.insertions+l.deletions, bar)
+	}
 
-			// Skip .kitkat directory
-			if name == ".kitkat" {
-				if d.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
+	fmt.Fprintf(w, " %d file%s changed, %d insertion%s(+), %d deletion%s(-)\n",
+		len(changes), pluralize(len(changes)),
+		totalInsertions, pluralize(totalInsertions),
+		totalDeletions, pluralize(totalDeletions))
+}
 
-			// Skip directories (continue walking into subdirs)
-			if d.IsDir() {
-				return nil
-			}
+// Diff calculates and displays the differences between the last commit and the current staging area (index)
+// It identifies which files have been added, deleted, or modified.
+func Diff(staged bool, opts DiffOptions) error {
+	// Load the current staging area into a map. This represents what will be in the *next* commit
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+	index := storage.IndexHashes(entries)
 
-			// Only process regular files
-			if !d.Type().IsRegular() {
-				return nil
-			}
+	if staged {
+		// Retrieve the commit HEAD points to
+		headCommit, err := GetHeadCommit()
+		if err == storage.ErrNoCommits {
+			// If there are no commits yet, there's nothing to compare against.
+			fmt.Println("No commits yet. Nothing to diff against.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-			// Get relative path for comparison with index
-			relPath, err := filepath.Rel(".", path)
-			if err != nil {
-				return err
-			}
+		// From the commit, get the tree object which represents the state of the repository at that time
+		// This is a map of `filePath -> contentHash`
+		tree, err := storage.ParseTree(headCommit.TreeHash)
+		if err != nil {
+			return err
+		}
 
-			// File exists on disk but not in index = untracked/new
-			if _, ok := index[relPath]; !ok {
-				untracked = append(untracked, relPath)
-			}
-			return nil
-		})
+		changes, err := treeChanges(tree, index)
 		if err != nil {
 			return err
 		}
+		changes = effectiveChanges(changes, opts)
+		if opts.Format != DiffPatch {
+			printChanges(changes, opts)
+			return nil
+		}
 
-		// Show untracked file content (all lines are additions)
-		for _, path := range untracked {
-			content, err := os.ReadFile(path)
-			if err != nil {
+		for _, c := range changes {
+			switch c.Status {
+			case 'A':
+				fmt.Printf("%sAdded file: %s%s\n", colorBlue, c.Path, colorReset)
+			case 'M':
+				fmt.Printf("%sModified file: %s%s\n", colorBlue, c.Path, colorReset)
+			case 'D':
+				fmt.Printf("%sDeleted file: %s%s\n", colorBlue, c.Path, colorReset)
 				continue
 			}
+			printPatch(c.Old, c.New, opts)
+		}
+		return nil
+	}
 
-			fmt.Printf("%s%sUntracked:%s %s\n", colorGreen, colorBlue, colorReset, path)
+	// Case B: unstaged diff (Index vs Working Directory)
+	// Equivalent to `git diff` (not `--cached`)
+	changes, err := workdirChanges(entries)
+	if err != nil {
+		return err
+	}
+	changes = effectiveChanges(changes, opts)
+	if opts.Format != DiffPatch {
+		printChanges(changes, opts)
+		return nil
+	}
 
-			// Trim trailing newlines and split into lines
-			contentStr := strings.TrimRight(string(content), "\n")
-			fileLines := strings.Split(contentStr, "\n")
-			emptyLines := []string{}
+	for _, c := range changes {
+		if c.Status == 'D' {
+			// File deleted from working directory (but still staged)
+			fmt.Printf("%sDeleted (unstaged): %s%s\n", colorRed, c.Path, colorReset)
+			continue
+		}
+		fmt.Printf("%sChanged (unstaged): %s%s\n", colorBlue, c.Path, colorReset)
 
-			// Myers diff: empty (old) → file content (new)
-			// All lines will show as green additions
-			myers := diff.NewMyersDiff(emptyLines, fileLines)
-			diffs := myers.Diffs()
+		// Myers diff: staged (old) → working dir (new)
+		printPatch(c.Old, c.New, opts)
+	}
+
+	// Untracked files: exist in working directory but not staged (recursive walk)
+	untracked, err := untrackedFiles(index)
+	if err != nil {
+		return err
+	}
 
-			// Display the computed differences with color
-			displayDiff(diffs)
+	// Show untracked file content (all lines are additions)
+	for _, path := range untracked {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
 		}
+
+		fmt.Printf("%s%sUntracked:%s %s\n", colorGreen, colorBlue, colorReset, path)
+
+		// Myers diff: empty (old) → file content (new)
+		// All lines will show as green additions
+		printPatch(nil, content, opts)
 	}
 
 	return nil
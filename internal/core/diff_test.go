@@ -0,0 +1,139 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func() error) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return <-out
+}
+
+func TestWriteChangesSummaries(t *testing.T) {
+	changes := []fileChange{
+		{Path: "a.txt", Status: 'M', Old: []byte("one\ntwo\n"), New: []byte("one\n2\nthree\n")},
+		{Path: "dir/new.txt", Status: 'A', New: []byte("x\n")},
+		{Path: "gone.txt", Status: 'D', Old: []byte("a\nb\nc\n")},
+		{Path: "empty", Status: 'A', New: []byte{}},
+		{Path: "img.png", Status: 'M', Old: []byte("\x89PNG\x00\x01"), New: []byte("\x89PNG\x00\x02\x03")},
+	}
+	tests := []struct {
+		format DiffFormat
+		want   string
+	}{
+		{DiffNameOnly, "a.txt\ndir/new.txt\ngone.txt\nempty\nimg.png\n"},
+		{DiffNameStatus, "M\ta.txt\nA\tdir/new.txt\nD\tgone.txt\nA\tempty\nM\timg.png\n"},
+		{DiffNumstat, "2\t1\ta.txt\n1\t0\tdir/new.txt\n0\t3\tgone.txt\n0\t0\tempty\n-\t-\timg.png\n"},
+		{DiffStat, "" +
+			" a.txt       | 3 ++-\n" +
+			" dir/new.txt | 1 +\n" +
+			" gone.txt    | 3 ---\n" +
+			" empty       | 0 \n" +
+			" img.png     | Bin 6 -> 7 bytes\n" +
+			" 5 files changed, 3 insertions(+), 4 deletions(-)\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeChanges(&buf, changes, DiffOptions{Format: tt.format}, false)
+		if buf.String() != tt.want {
+			t.Errorf("format %v:\ngot\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestWriteStatScalesBars(t *testing.T) {
+	var big, small strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&big, "%d\n", i)
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&small, "%d\n", i)
+	}
+	changes := []fileChange{
+		{Path: "big", Status: 'A', New: []byte(big.String())},
+		{Path: "small", Status: 'D', Old: []byte(small.String())},
+	}
+	var buf bytes.Buffer
+	writeStat(&buf, changes, DiffOptions{}, false)
+	want := "" +
+		" big   | 100 " + strings.Repeat("+", statBarWidth) + "\n" +
+		" small |  10 ----\n" +
+		" 2 files changed, 100 insertions(+), 10 deletions(-)\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestLogShowsChanges(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("f.txt", []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("f.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("f.txt", []byte("one\n2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("f.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Commit("second"); err != nil {
+		t.Fatal(err)
+	}
+
+	stat := captureStdout(t, func() error {
+		return ShowLog(LogOptions{Limit: 1, ShowDiff: true, Diff: DiffOptions{Format: DiffStat}})
+	})
+	if !strings.Contains(stat, "second") || strings.Contains(stat, "first") {
+		t.Errorf("log --stat -1 shows the wrong commits:\n%s", stat)
+	}
+	if !strings.Contains(stat, " f.txt | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n") {
+		t.Errorf("log --stat is missing the stat:\n%s", stat)
+	}
+
+	patch := captureStdout(t, func() error {
+		return ShowLog(LogOptions{ShowDiff: true})
+	})
+	for _, want := range []string{"--- a/f.txt", "+++ b/f.txt", "-two\n+2\n", "+++ b/f.txt\n@@ -0,0 +1,2 @@\n+one\n+two\n"} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("log -p is missing %q:\n%s", want, patch)
+		}
+	}
+}
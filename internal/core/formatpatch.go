@@ -0,0 +1,153 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// mboxFromDate is the fixed date on the "From <hash>" separator line. Like git,
+// it marks the file as a patch rather than a real mailbox.
+const mboxFromDate = "Mon Sep 17 00:00:00 2001"
+
+// maxSlugLength caps the subject part of generated patch file names
+const maxSlugLength = 52
+
+// FormatPatchOptions controls which commits FormatPatch exports and where to
+type FormatPatchOptions struct {
+	Range     string // "A..B", or "A" for A..HEAD; empty means all of HEAD's history
+	Count     int    // Export only the last Count commits of the range (0 = all)
+	OutputDir string // Directory for the patch files; defaults to the current directory
+	Stdout    bool   // Write every patch to standard output instead of to files
+}
+
+// FormatPatch writes each commit in a range as an mbox-style email containing the
+// author, date, message and unified diff, one numbered .patch file per commit
+func FormatPatch(opts FormatPatchOptions) error {
+	// Guard: ensure we're inside a kitkat repo
+	if _, err := os.Stat(RepoDir); os.IsNotExist(err) {
+		return errors.New("not a kitkat repository (run `kitkat init`)")
+	}
+
+	var ids []string
+	var err error
+	if opts.Range != "" {
+		ids, err = resolveRange(opts.Range)
+	} else {
+		if opts.Count == 0 {
+			return fmt.Errorf("no revision range given")
+		}
+		var head string
+		head, err = ResolveRevision("HEAD")
+		if err == nil {
+			ids, err = getCommitsBetween("", head)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Count > 0 && len(ids) > opts.Count {
+		ids = ids[len(ids)-opts.Count:]
+	}
+
+	for i, id := range ids {
+		commit, err := storage.FindCommit(id)
+		if err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err := writePatchMail(&buf, commit, i+1, len(ids)); err != nil {
+			return err
+		}
+
+		if opts.Stdout {
+			if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		name := fmt.Sprintf("%04d-%s.patch", i+1, patchSlug(subject))
+		path := filepath.Join(opts.OutputDir, name)
+		if opts.OutputDir != "" {
+			if err := os.MkdirAll(opts.OutputDir, 0755); err != nil {
+				return err
+			}
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("could not write %s: %w", path, err)
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+// writePatchMail writes a commit as patch number n of total in mbox format
+func writePatchMail(w io.Writer, commit models.Commit, n, total int) error {
+	changes, err := commitChanges(commit)
+	if err != nil {
+		return err
+	}
+
+	subject, body, _ := strings.Cut(commit.Message, "\n")
+	prefix := "[PATCH]"
+	if total > 1 {
+		prefix = fmt.Sprintf("[PATCH %d/%d]", n, total)
+	}
+	author := mail.Address{Name: commit.AuthorName, Address: commit.AuthorEmail}
+
+	fmt.Fprintf(w, "From %s %s\n", commit.ID, mboxFromDate)
+	fmt.Fprintf(w, "From: %s\n", author.String())
+	fmt.Fprintf(w, "Date: %s\n", commit.Timestamp.Format(time.RFC1123Z))
+	fmt.Fprintf(w, "Subject: %s\n", mime.QEncoding.Encode("utf-8", prefix+" "+subject))
+	fmt.Fprintln(w)
+	if body = strings.TrimSpace(body); body != "" {
+		fmt.Fprintf(w, "%s\n\n", body)
+	}
+	fmt.Fprintln(w, "---")
+	writeStat(w, changes, DiffOptions{}, false)
+	fmt.Fprintln(w)
+	for _, c := range changes {
+		writeUnifiedDiff(w, c, DiffOptions{}, false)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// patchSlug turns a commit subject into a file name fragment, replacing every
+// run of characters other than letters, digits and dots with a single dash
+func patchSlug(subject string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range subject {
+		if r < 128 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.') {
+			sb.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && sb.Len() > 0 {
+			sb.WriteByte('-')
+		}
+		dash = true
+	}
+	slug := sb.String()
+	if len(slug) > maxSlugLength {
+		slug = slug[:maxSlugLength]
+	}
+	slug = strings.Trim(slug, "-.")
+	if slug == "" {
+		return "patch"
+	}
+	return slug
+}
@@ -14,47 +14,91 @@ var helpMessages = map[string]CommandHelp{
 	},
 	"add": {
 		Summary: "Add file contents to the index.",
-		Usage:   "Usage: kitkat add <file-path> | --all | -A\n\nThis command adds file contents to the staging area.\nUse '--all' or '-A' to stage all new, modified, and deleted files.",
+		Usage:   "Usage: kitkat add [-A] <pathspec>... | --all | -A | -p [<pathspec>...]\n\nThis command adds file contents to the staging area: new, modified and deleted files the\npathspec selects are staged. Ignored files are skipped unless named exactly.\nUse '--all' or '-A' to stage all new, modified, and deleted files.\nUse '-p' ('--patch') to pick the hunks of tracked files to stage one at a time. For each hunk,\nanswer y (stage), n (skip), s (split into smaller hunks), e (edit in your editor), q (quit),\na or d (stage or skip the rest of the file). reset -p and checkout -p work the same way.\nPathspecs (also used by rm, status, checkout, ls-files and log):\n  <path>          A file, or every file below a directory\n  <glob>          Shell-style pattern; * and ? also match '/' (quote it: '*.log')\n  :(exclude)<p>   Leave out what <p> matches (also :!<p> or :^<p>)\n  :(top)<p>       <p> is relative to the repository root, not the current directory (also :/<p>)",
 	},
 	"commit": {
 		Summary: "Record changes to the repository.",
-		Usage:   "Usage: kitkat commit <-m | -am | --amend> <message>\n\nCreates a new commit from the staging area.\nUse '-am' to automatically stage all tracked files before committing.\nUse '--amend' to modify the previous commit.",
+		Usage:   "Usage: kitkat commit [-a] [--amend [--no-edit] [--reset-author]] [--allow-empty] [--allow-empty-message] [--dry-run] [-e] [-s] [--trailer <key>=<value>] [--author=<author>] [--date=<date>] [-m <message> | -F <file> | -t <file>] [-- <message words>]\n\nCreates a new commit from the staging area.\nWithout -m or -F, the editor is opened to write the message, starting from the\ncommit template if there is one and followed by a commented summary of the status.\nLines starting with '#' are removed, and an empty message aborts the commit.\nFlags:\n  -m <message>         Use the given commit message; several -m give several paragraphs.\n                       Words after the message are added to it, so it need not be quoted;\n                       flags are still recognised anywhere, and words after -- are all message\n  -F, --file <file>    Take the commit message from a file ('-' for standard input)\n  -e, --edit           Open the editor on the message given with -m or -F\n  -t, --template <file>\n                       Start the message in the editor from a file (default: commit.template)\n  -s, --signoff        Add a Signed-off-by trailer for the committer\n  --trailer <key>=<value>\n                       Add a trailer such as 'Co-authored-by=Name <email>' (repeatable)\n  -a, --all            Stage all changes, including new untracked files, before committing\n                       ('-am' for short)\n  --amend              Replace the HEAD commit with one made from the index on top of its parent,\n                       keeping its author and date; the editor starts from its message\n  --no-edit            With --amend, keep the message without opening the editor\n  --reset-author       With --amend, take the author and date from the config and the current time\n  --allow-empty        Commit even if nothing changed, e.g. to trigger a deploy\n  --allow-empty-message\n                       Commit even if the message is empty\n  --dry-run            Show the status of what would be committed without committing;\n                       exits with 1 if there is nothing to commit\n  --author=<author>    Override the author, given as 'Name <email>'\n  --date=<date>        Override the author date (ISO 8601, RFC 2822 or @<unix-time> [+hhmm])\n\nThe author and committer come from user.name and user.email, and can be overridden\nwith the KITKAT_AUTHOR_NAME, KITKAT_AUTHOR_EMAIL, KITKAT_AUTHOR_DATE,\nKITKAT_COMMITTER_NAME, KITKAT_COMMITTER_EMAIL and KITKAT_COMMITTER_DATE environment variables.",
 	},
 	"diff": {
 		Summary: "Show changes between the last commit and staging area",
-		Usage:   "Usage: kitkat diff\n\nShows content differences between the HEAD commit and the index",
+		Usage:   "Usage: kitkat diff [--cached] [<output-options>] [<whitespace-options>]\n\nShows content differences between the index and the working directory.\nFlags:\n  --cached, --staged         Compare the HEAD commit against the index instead\n  --stat                     Show a per-file histogram of changed lines\n  --numstat                  Show added and deleted line counts in machine-readable form\n  --name-only                Show only the names of changed files\n  --name-status              Show the names and status (A, M, D) of changed files\n  --word-diff[=<mode>]       Highlight changed words inline (plain, color or none)\n  --color-words[=<regex>]    Highlight changed words using colors only\n  --word-diff-regex=<regex>  Define what a word is (use '.' for character-level diffs)\n  -w, --ignore-all-space     Ignore whitespace when comparing lines\n  -b, --ignore-space-change  Ignore changes in the amount of whitespace\n  --ignore-blank-lines       Ignore changes whose lines are all blank\n  --ignore-cr-at-eol         Ignore carriage returns at the end of lines",
 	},
 	"log": {
 		Summary: "Show the commit history",
-		Usage:   "Usage: kitkat log [--oneline] [-n <limit>]\n\nDisplays the commit history for the current branch.\nFlags:\n  --oneline   Compact, single-line view\n  -n <limit>  Limits output to N commits",
+		Usage:   "Usage: kitkat log [--oneline | --format=<format>] [--trailer <key>[=<value>]] [-n <limit>] [-p | --stat | --numstat | --name-only | --name-status] [-- <pathspec>...]\n\nDisplays the commit history for the current branch.\nWith a pathspec, only commits changing the selected paths are shown (see 'kitkat help add').\nFlags:\n  --oneline      Compact, single-line view\n  --format=<format>, --pretty=<format>\n                 Header format: oneline, short, medium (the default), full or fuller;\n                 full adds the committer and fuller adds the author and commit dates.\n                 A format string prints one line per commit with placeholders such as\n                 %H, %h, %s, %b, %an, %ae, %ad, %cn, %ce, %cd, %n and\n                 %(trailers[:key=<key>][,valueonly])\n  --trailer <key>[=<value>]\n                 Only show commits with that trailer, whose value contains <value> if given\n  -n <limit>     Limits output to N commits\n  -p, --patch    Show the changes introduced by each commit\n  --stat         Show a per-file histogram of changed lines for each commit\n  --numstat      Show added and deleted line counts for each commit\n  --name-only    Show the names of files changed by each commit\n  --name-status  Show the names and status of files changed by each commit",
 	},
 	"tag": {
 		Summary: "Create a new tag for a commit",
-		Usage:   "Usage: kitkat tag <tag-name> <commit-id>\n\nCreates a new lightweight tag that points to the specified commit",
+		Usage:   "Usage: kitkat tag <tag-name> <commit-id> | tag -a <tag-name> [<commit>] -m <message> | tag --list\n\nCreates a new lightweight tag that points to the specified commit.\nUse -a to create an annotated tag that records the tagger, date and a message.",
 	},
 	"merge": {
 		Summary: "Merge a branch into the current branch.",
 		Usage:   "Usage: kitkat merge <branch-name>\n\nJoins another branch's history into the current branch. Currently, only fast-forward merges are supported.",
 	},
+	"rm": {
+		Summary: "Remove files from the working tree and from the index",
+		Usage:   "Usage: kitkat rm [-r] <pathspec>...\n\nRemoves the tracked files the pathspec selects (see 'kitkat help add').\nFlags:\n  -r  Allow removing every file below a directory",
+	},
+	"status": {
+		Summary: "Show the working tree status",
+		Usage:   "Usage: kitkat status [<pathspec>...]\n\nShows staged, unstaged and untracked changes, limited to the selected paths if a\npathspec is given (see 'kitkat help add').",
+	},
 	"ls-files": {
 		Summary: "Show information about files in the index",
-		Usage:   "Usage: kitkat ls-files\n\nPrints a list of all files that are currently in the index (staging area)",
+		Usage:   "Usage: kitkat ls-files [<pathspec>...]\n\nPrints a list of all files that are currently in the index (staging area),\nor only those the pathspec selects (see 'kitkat help add')",
 	},
 	"clean": {
 		Summary: "Remove untracked files from the working directory",
-		Usage:   "Usage: kitkat clean [-f] [-x]\n\nRemoves untracked files.\nFlags:\n  -f  Force deletion (required)\n  -x  Also delete ignored files",
+		Usage:   "Usage: kitkat clean [-f | -n] [-d] [-x]\n\nRemoves untracked files. Directories left empty are removed too.\nFlags:\n  -f            Force deletion (required unless -n is given)\n  -n, --dry-run Only show what would be removed\n  -d            Also remove untracked directories\n  -x            Also delete ignored files",
 	},
 	"config": {
 		Summary: "Get and set repository or global options.",
-		Usage:   "Usage: kitkat config --global <key> <value>\n\nSets a global configuration value that will be used for all repositories.",
+		Usage:   "Usage: kitkat config --global <key> <value>\n\nSets a global configuration value that will be used for all repositories.\nKeys:\n  user.name, user.email  Identity recorded in commits\n  core.parallel          Files hashed or written at once (0 or unset: one per CPU, 1: no parallelism)",
 	},
 	"reset": {
 		Summary: "Reset current HEAD to the specified state",
-		Usage:   "Usage: kitkat reset --hard <commit>\n\nResets the index and working tree. Any changes to tracked files in the working tree since <commit> are discarded.",
+		Usage:   "Usage: kitkat reset [--soft | --mixed | --hard] [<commit>]\n       kitkat reset [<commit>] [--] <pathspec>...\n       kitkat reset -p [<commit>] [--] [<pathspec>...]\n\nMoves the current branch (or a detached HEAD) to <commit>, HEAD by default.\nRevisions such as HEAD~1 are accepted.\nFlags:\n  --soft   Only move the branch; the index and working tree are left alone\n  --mixed  Also reset the index to <commit>, keeping changes in the working tree (default)\n  --hard   Also reset the working tree. Any changes to tracked files since <commit> are discarded\nGiven a pathspec (see 'kitkat help add'), the branch is not moved: the selected index entries\nare reset to <commit>, unstaging them without touching the working tree.\nUse '-p' ('--patch') to pick hunks of the staged changes to unstage, reverting them in the index\nto their state in <commit>. See 'kitkat help add' for the answers.",
 	},
 	"checkout": {
 		Summary: "Switch branches or restore working tree files",
-		Usage:   "Usage: kitkat checkout <branch> or checkout -b <new-branch>\n\nSwitches to a branch. Use -b to create a new branch and switch to it.",
+		Usage:   "Usage: kitkat checkout [-f | -m] <branch> or checkout -b <new-branch> or checkout [-p] [--] <pathspec>...\n\nSwitches to a branch. Use -b to create a new branch and switch to it.\nGiven a pathspec (see 'kitkat help add'), restores the selected files from HEAD instead.\nWith -p (--patch), picks hunks of the unstaged changes to discard from the working tree.\nLocal changes to files the branch does not touch are kept; if switching would\noverwrite local changes or untracked files, nothing is changed and they are listed.\nFlags:\n  -f, --force  Discard local changes and overwrite untracked files\n  -m, --merge  Merge local changes into the branch's version, leaving conflict markers",
+	},
+	"switch": {
+		Summary: "Switch branches",
+		Usage:   "Usage: kitkat switch [-f | -m] <branch>\n       kitkat switch -c <new-branch> [<start-point>]\n       kitkat switch --detach <commit>\n\nSwitches to a branch, carrying local changes across like checkout does. Unlike checkout,\nswitch never restores files and only leaves a branch for a bare commit with --detach.\nFlags:\n  -c, --create <name>  Create a branch at <start-point> (HEAD by default) and switch to it\n  -d, --detach         Check out <commit> without a branch (detached HEAD)\n  -f, --force          Discard local changes and overwrite untracked files\n  -m, --merge          Merge local changes into the branch's version, leaving conflict markers",
+	},
+	"restore": {
+		Summary: "Restore working tree files or unstage them",
+		Usage:   "Usage: kitkat restore [--source=<commit>] [--staged] [--worktree] [--] <pathspec>...\n\nRestores the files the pathspec selects (see 'kitkat help add'), overwriting local changes.\nBy default the working tree is restored from the index. With --staged the index is\nrestored from HEAD instead, unstaging the files; give both flags to restore both.\nFiles that do not exist in the source are removed.\nFlags:\n  -s, --source <commit>  Restore from <commit> instead\n  -S, --staged           Restore the index\n  -W, --worktree         Restore the working tree (the default without --staged)",
+	},
+	"rebase": {
+		Summary: "Reapply commits on top of another base",
+		Usage:   "Usage: kitkat rebase [-i] [--autosquash] [--onto <newbase>] <upstream> [<branch>]\n       kitkat rebase --continue | --skip | --abort | --edit-todo\n\nReplays the commits of the current branch that <upstream> does not have, starting from\ntheir merge base, on top of <upstream>. With <branch>, switches to that branch first.\nFlags:\n  --onto <newbase>  Replay the commits on top of <newbase> instead of <upstream>\n  -i                Edit the todo list before starting. Besides pick, it accepts reword, edit\n                    (stop to amend), squash, fixup [-C | -c], exec <command> (stop if it fails),\n                    break, drop, label <name> and reset <name>; the list explains each one\n  --autosquash      Move commits whose subject starts with \"fixup! \", \"squash! \" or \"amend! \"\n                    right after the commit they name and meld them into it\n  --continue        Carry on after resolving a conflict or stopping at edit, exec or break\n  --skip            Drop the changes of the commit the rebase stopped at and carry on\n  --edit-todo       Edit the steps that have not run yet\n  --abort           Stop and put the branch back where it was",
+	},
+	"recover": {
+		Summary: "Finish or undo an interrupted checkout",
+		Usage:   "Usage: kitkat recover [--rollback]\n\nCheckouts, resets and merges record what they are about to do in .kitkat/checkout-journal\nbefore touching any file. If one is interrupted, the working tree, index and refs may be\nhalf updated; recover completes the operation from the journal.\nFlags:\n  --rollback  Restore the working tree, index and refs to how they were before",
+	},
+	"apply": {
+		Summary: "Apply a patch to files and/or to the index",
+		Usage:   "Usage: kitkat apply [--check] [--cached] [-R | --reverse] <patch>...\n\nApplies a unified diff (as produced by 'kitkat show' or 'git diff') to the working directory.\nHunks that moved are found nearby, and up to two context lines may differ (fuzz).\nUse '-' to read the patch from standard input.\nFlags:\n  --check        Only check that the patch applies; change nothing\n  --cached       Apply the patch to the index without touching the working directory\n  -R, --reverse  Apply the patch in reverse",
+	},
+	"format-patch": {
+		Summary: "Prepare patches for e-mail submission",
+		Usage:   "Usage: kitkat format-patch [-o <dir>] [--stdout] [-<n>] [<since> | <revision-range>]\n\nWrites each commit in the range as an mbox-style email (author, date, message and diff),\none numbered file per commit, and prints the file names.\n<since> means every commit after <since> up to HEAD; <a>..<b> every commit in b but not in a.\nFlags:\n  -o <dir>   Write the patch files to <dir> instead of the current directory\n  --stdout   Print all patches to standard output instead of writing files\n  -<n>       Only export the last <n> commits",
+	},
+	"am": {
+		Summary: "Apply a series of patches from a mailbox",
+		Usage:   "Usage: kitkat am <mbox>... | --continue | --skip | --abort\n\nApplies patches written by 'kitkat format-patch' and commits each one with its original\nauthor, date and message. Use '-' to read from standard input.\nIf a patch does not apply, am stops so the changes can be made by hand.\nFlags:\n  --continue  Commit the staged resolution of the failed patch and apply the rest\n  --skip      Drop the failed patch and apply the rest\n  --abort     Stop and restore the branch to its state before am started",
+	},
+	"interpret-trailers": {
+		Summary: "Add or parse trailers in commit messages",
+		Usage:   "Usage: kitkat interpret-trailers [--trailer <key>=<value>]... [--parse] [--in-place] [<file>...]\n\nReads a commit message from each file (or standard input), adds the given trailers to\nthe trailer block at its end and prints the result. Trailers the message already has are not repeated.\nFlags:\n  --trailer <key>=<value>  Add a trailer; 'key: value' is also accepted\n  --parse, --only-trailers Print only the trailers, one 'Key: value' per line\n  --in-place               Rewrite the files instead of printing",
+	},
+	"show": {
+		Summary: "Show commits, tags, trees and files",
+		Usage:   "Usage: kitkat show [<rev>...] | <rev>:<path> | :<path>\n\nShows a commit's author, date and message followed by its diff against its parent.\nAnnotated tags are shown with their message before the tagged commit, trees as a list of paths.\nUse <rev>:<path> to print a file as of a revision, or :<path> to print the staged version.\nAccepts the same output flags as 'kitkat diff' (e.g. --stat, --word-diff, -w).",
 	},
 	"show-object": {
 		Summary: "Provide content or type and size information for repository objects",
@@ -10,42 +10,66 @@ import (
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-// UpdateWorkspaceAndIndex resets the working directory and index to match a specific commit.
-// This is shared logic used by checkout, merge, and reset commands.
+// UpdateWorkspaceAndIndex resets the working directory and index to match a specific commit,
+// discarding local changes. Untracked files are left alone unless they are in the way.
+// This is shared logic used by reset, rebase and am.
 func UpdateWorkspaceAndIndex(commitHash string) error {
-	commit, err := storage.FindCommit(commitHash)
+	return checkoutTree(commitHash, CheckoutOptions{Force: true}, "reset")
+}
+
+// removeEmptyParents removes the directories above path that are left empty,
+// stopping at the first one that still has entries or at the repository root
+func removeEmptyParents(path string) {
+	for dir := filepath.Dir(path); dir != "." && dir != string(os.PathSeparator); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// writeWorkFile writes a blob to the working directory with the given mode,
+// creating a symbolic link for symlink entries
+func writeWorkFile(path string, entry storage.TreeEntry) error {
+	content, err := storage.ReadObject(entry.Hash)
 	if err != nil {
 		return err
 	}
-	targetTree, err := storage.ParseTree(commit.TreeHash)
-	if err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return err
 	}
-
-	// Delete files from the current index that are not in the target tree
-	currentIndex, _ := storage.LoadIndex()
-	for path := range currentIndex {
-		if _, existsInTarget := targetTree[path]; !existsInTarget {
-			os.Remove(path)
+	if entry.Mode == storage.ModeSymlink {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
 		}
+		return os.Symlink(string(content), path)
 	}
+	perm := os.FileMode(0644)
+	if entry.Mode == storage.ModeExecutable {
+		perm = 0755
+	}
+	return SafeWrite(path, content, perm)
+}
 
-	// Write/update files from the target tree
-	for path, hash := range targetTree {
-		content, err := storage.ReadObject(hash)
-		if err != nil {
-			return err
-		}
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			return err
-		}
-		if err := SafeWrite(path, content, 0644); err != nil {
-			return err
-		}
+// readWorkFile reads a file from the working directory the way it is stored:
+// the content of a regular file, or the target of a symbolic link
+func readWorkFile(path string) ([]byte, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		return []byte(target), err
 	}
+	return os.ReadFile(path)
+}
 
-	// Update the index to match the new tree
-	return storage.WriteIndex(targetTree)
+// modeChange describes a change of file mode for status output, or returns ""
+func modeChange(oldMode, newMode uint32) string {
+	if oldMode == newMode {
+		return ""
+	}
+	return fmt.Sprintf(" (mode %06o -> %06o)", oldMode, newMode)
 }
 
 // GetHeadState returns the current branch name or detached HEAD state.
@@ -77,11 +101,21 @@ func GetHeadState() (string, error) {
 // IsWorkDirDirty checks if there are uncommitted changes in the working directory or staging area.
 // Returns true if there are any staged or unstaged changes, false if the working tree is clean.
 func IsWorkDirDirty() (bool, error) {
+	return isWorkDirDirty(true)
+}
+
+// hasTrackedChanges is like IsWorkDirDirty but ignores untracked files
+func hasTrackedChanges() (bool, error) {
+	return isWorkDirDirty(false)
+}
+
+// isWorkDirDirty implements IsWorkDirDirty, optionally counting untracked files as changes
+func isWorkDirDirty(includeUntracked bool) (bool, error) {
 	// Load the tree from the last commit (HEAD)
-	headTree := make(map[string]string)
+	headTree := make(map[string]storage.TreeEntry)
 	lastCommit, err := GetHeadCommit() // Use GetHeadCommit, not storage.GetLastCommit
 	if err == nil {
-		tree, parseErr := storage.ParseTree(lastCommit.TreeHash)
+		tree, parseErr := storage.ParseTreeEntries(lastCommit.TreeHash)
 		if parseErr != nil {
 			return false, parseErr
 		}
@@ -92,10 +126,11 @@ func IsWorkDirDirty() (bool, error) {
 	}
 
 	// Load the current staging area
-	index, err := storage.LoadIndex()
+	entries, err := storage.LoadIndexEntries()
 	if err != nil {
 		return false, err
 	}
+	index := storage.IndexHashes(entries)
 
 	// Check for staged changes (Index vs. HEAD)
 	allPaths := make(map[string]bool)
@@ -107,16 +142,17 @@ func IsWorkDirDirty() (bool, error) {
 	}
 
 	for path := range allPaths {
-		headHash, inHead := headTree[path]
-		indexHash, inIndex := index[path]
+		headEntry, inHead := headTree[path]
+		indexEntry, inIndex := entries[path]
 
 		// If there's any difference between HEAD and index, working dir is dirty
-		if (inIndex && !inHead) || (!inIndex && inHead) || (inIndex && inHead && headHash != indexHash) {
+		if inIndex != inHead || headEntry.Hash != indexEntry.Hash || headEntry.Mode != indexEntry.Mode {
 			return true, nil
 		}
 	}
 
 	// Check for unstaged changes (Working Directory vs. Index)
+	var tracked []trackedFile
 	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -128,41 +164,121 @@ func IsWorkDirDirty() (bool, error) {
 			return nil
 		}
 
-		indexHash, isTracked := index[cleanPath]
+		entry, isTracked := entries[cleanPath]
 
 		// If the file is not in the index, it's untracked (dirty)
 		if !isTracked {
+			if !includeUntracked {
+				return nil
+			}
 			return fmt.Errorf("untracked") // Use error to signal dirty state
 		}
-
-		// If the file is tracked, hash it and compare with the index
-		currentHash, hashErr := storage.HashFile(cleanPath)
-		if hashErr != nil {
-			return hashErr
-		}
-		if currentHash != indexHash {
-			return fmt.Errorf("modified") // Use error to signal dirty state
-		}
+		tracked = append(tracked, trackedFile{Path: cleanPath, Info: info, Entry: entry})
 		return nil
 	})
 
-	// If we got an "untracked" or "modified" error, the working dir is dirty
+	// If we got an "untracked" error, the working dir is dirty
 	if err != nil {
-		if err.Error() == "untracked" || err.Error() == "modified" {
+		if err.Error() == "untracked" {
 			return true, nil
 		}
 		return false, err
 	}
 
+	// Compare tracked files with the index (hashing only those whose stat data changed)
+	changed, err := checkTrackedFiles(tracked)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range changed {
+		if c {
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
+// trackedFile is a file in the working tree together with its index entry.
+// Info must come from stat-ing the file before it is read.
+type trackedFile struct {
+	Path  string
+	Info  os.FileInfo
+	Entry storage.IndexEntry
+}
+
+// checkTrackedFiles reports, in order, whether each file differs from its index
+// entry. Files are hashed in parallel, and only if their stat data changed.
+// Files that had to be hashed and turned out unchanged get fresh stat data
+// recorded in the index so the next check can skip them.
+func checkTrackedFiles(files []trackedFile) ([]bool, error) {
+	changed := make([]bool, len(files))
+	fresh := make([]storage.IndexEntry, len(files))
+	err := forEachParallel(len(files), func(i int) error {
+		var err error
+		changed[i], fresh[i], err = trackedFileChanged(files[i].Path, files[i].Info, files[i].Entry)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	refreshed := make(map[string]storage.IndexEntry)
+	for _, entry := range fresh {
+		if entry.Path != "" {
+			refreshed[entry.Path] = entry
+		}
+	}
+	// Best effort: a stale stat cache only costs re-hashing next time
+	_ = storage.RefreshIndexStat(refreshed)
+	return changed, nil
+}
+
+// trackedFileChanged reports whether a tracked file differs from its index entry.
+// info must come from stat-ing the file before it is read. A file whose stat data
+// is unchanged is not read at all. When a file has to be hashed and turns out to be
+// unchanged, an entry with fresh stat data is returned so the caller can record it
+// with storage.RefreshIndexStat and skip the hashing next time; otherwise the
+// returned entry is empty.
+func trackedFileChanged(path string, info os.FileInfo, entry storage.IndexEntry) (bool, storage.IndexEntry, error) {
+	if entry.StatMatches(info) {
+		return false, storage.IndexEntry{}, nil
+	}
+	if storage.ModeFromFileInfo(info) != entry.Mode {
+		return true, storage.IndexEntry{}, nil
+	}
+	hash, err := storage.HashFile(path)
+	if err != nil {
+		return false, storage.IndexEntry{}, err
+	}
+	if hash != entry.Hash {
+		return true, storage.IndexEntry{}, nil
+	}
+	// Files modified too recently get no stat data and are not worth recording
+	if fresh := storage.NewIndexEntry(path, hash, info); fresh.HasStat() {
+		return false, fresh, nil
+	}
+	return false, storage.IndexEntry{}, nil
+}
+
 // UpdateBranchPointer updates the current branch pointer or HEAD to point to a specific commit.
 // Handles both branch mode (updates refs/heads/<branch>) and detached HEAD mode (updates HEAD directly).
 func UpdateBranchPointer(commitHash string) error {
+	update, err := branchPointerUpdate(commitHash)
+	if err != nil {
+		return err
+	}
+	if err := SafeWrite(update.Path, []byte(update.New), 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", update.Path, err)
+	}
+	return nil
+}
+
+// branchPointerUpdate works out the ref change that points the current branch,
+// or HEAD itself when detached, at commitHash
+func branchPointerUpdate(commitHash string) (refUpdate, error) {
 	headData, err := os.ReadFile(HeadPath)
 	if err != nil {
-		return fmt.Errorf("unable to read HEAD file: %w", err)
+		return refUpdate{}, fmt.Errorf("unable to read HEAD file: %w", err)
 	}
 	ref := strings.TrimSpace(string(headData))
 
@@ -172,23 +288,25 @@ func UpdateBranchPointer(commitHash string) error {
 		branchFile := filepath.Join(".kitkat", refPath)
 
 		// Verify branch file exists
-		if _, err := os.Stat(branchFile); err != nil {
+		old, err := os.ReadFile(branchFile)
+		if err != nil {
 			branchName := strings.TrimPrefix(refPath, "refs/heads/")
-			return fmt.Errorf("current branch %s not found", branchName)
+			return refUpdate{}, fmt.Errorf("current branch %s not found", branchName)
 		}
-
-		// Update the branch pointer
-		if err := SafeWrite(branchFile, []byte(commitHash), 0644); err != nil {
-			return fmt.Errorf("failed to update branch pointer: %w", err)
-		}
-		return nil
+		return refUpdate{Path: branchFile, Old: string(old), New: commitHash}, nil
 	}
 
 	// Case B: Detached HEAD (HEAD contains a commit hash directly)
-	if err := SafeWrite(HeadPath, []byte(commitHash), 0644); err != nil {
-		return fmt.Errorf("failed to update HEAD: %w", err)
+	return refUpdate{Path: HeadPath, Old: string(headData), New: commitHash}, nil
+}
+
+// headUpdate works out the change that rewrites HEAD itself
+func headUpdate(content string) (refUpdate, error) {
+	old, err := os.ReadFile(HeadPath)
+	if err != nil {
+		return refUpdate{}, fmt.Errorf("unable to read HEAD file: %w", err)
 	}
-	return nil
+	return refUpdate{Path: HeadPath, Old: string(old), New: content}, nil
 }
 
 // readHead returns the commit hash that HEAD currently points to.
@@ -243,6 +361,10 @@ func GetHeadCommit() (models.Commit, error) {
 	if err != nil {
 		return models.Commit{}, err
 	}
+	// A new repository's branch exists but points nowhere yet
+	if commitHash == "" {
+		return models.Commit{}, storage.ErrNoCommits
+	}
 
 	// Find and return that commit
 	return storage.FindCommit(commitHash)
@@ -255,15 +377,18 @@ func IsRepoInitialized() bool {
 	if err != nil {
 		return false
 	}
+	start := cwd
 
 	for {
 		if _, err := os.Stat(filepath.Join(cwd, RepoDir)); err == nil {
 			// Found the repository root
 			// Update the working directory to the repo root so that
 			// all relative paths (RepoDir, etc.) are valid.
+			// Remember where we started so pathspecs can be resolved from there.
 			if err := os.Chdir(cwd); err != nil {
 				return false
 			}
+			workPrefix, _ = filepath.Rel(cwd, start)
 			return true
 		}
 
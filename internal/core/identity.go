@@ -0,0 +1,113 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// identity is a name, email and time recorded in a commit
+type identity struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// dateFormats are the layouts ParseDate accepts, tried in order
+var dateFormats = []string{
+	time.RFC3339Nano,
+	"Mon Jan 2 15:04:05 2006 -0700",
+	time.RFC1123Z,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseDate parses a commit date. Besides the usual ISO 8601 and RFC 2822
+// forms it accepts "@<unix seconds> [+hhmm]", the raw form git uses. Dates
+// without a zone are taken as local time.
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if raw, ok := strings.CutPrefix(s, "@"); ok {
+		secs, zone, _ := strings.Cut(raw, " ")
+		n, err := strconv.ParseInt(secs, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+		}
+		t := time.Unix(n, 0)
+		if zone == "" {
+			return t, nil
+		}
+		z, err := time.Parse("-0700", zone)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+		}
+		return t.In(z.Location()), nil
+	}
+	for _, layout := range dateFormats {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date format: %s", s)
+}
+
+// ParseIdent splits an identity of the form "Name <email>" the way git does:
+// the email is what the last <...> holds and the name is everything before it,
+// so names may contain commas, quotes or parentheses but not angle brackets
+func ParseIdent(s string) (name, email string, err error) {
+	invalid := fmt.Errorf("--author '%s' is not 'Name <email>'", s)
+	rest, ok := strings.CutSuffix(strings.TrimSpace(s), ">")
+	if !ok {
+		return "", "", invalid
+	}
+	open := strings.LastIndex(rest, "<")
+	if open < 0 {
+		return "", "", invalid
+	}
+	name = strings.TrimSpace(rest[:open])
+	email = strings.TrimSpace(rest[open+1:])
+	if name == "" || email == "" || strings.ContainsAny(name, "<>") || strings.Contains(email, ">") {
+		return "", "", invalid
+	}
+	return name, email, nil
+}
+
+// authorIdent returns the author of a new commit: KITKAT_AUTHOR_NAME,
+// KITKAT_AUTHOR_EMAIL and KITKAT_AUTHOR_DATE, falling back to the config and
+// the current time
+func authorIdent() (identity, error) {
+	return envIdent("KITKAT_AUTHOR")
+}
+
+// committerIdent returns the committer of a new commit, like authorIdent with
+// the KITKAT_COMMITTER_* variables
+func committerIdent() (identity, error) {
+	return envIdent("KITKAT_COMMITTER")
+}
+
+// envIdent reads the <prefix>_NAME, <prefix>_EMAIL and <prefix>_DATE
+// environment variables, using the configured identity and the current time
+// for any that are unset
+func envIdent(prefix string) (identity, error) {
+	id := identity{When: time.Now()}
+	id.Name, id.Email = configIdentity()
+	if name := os.Getenv(prefix + "_NAME"); name != "" {
+		id.Name = name
+	}
+	if email := os.Getenv(prefix + "_EMAIL"); email != "" {
+		id.Email = email
+	}
+	if date := os.Getenv(prefix + "_DATE"); date != "" {
+		when, err := ParseDate(date)
+		if err != nil {
+			return identity{}, fmt.Errorf("%s_DATE: %w", prefix, err)
+		}
+		id.When = when
+	}
+	return id, nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDateKeepsZone(t *testing.T) {
+	tests := []struct {
+		in     string
+		unix   int64
+		offset int
+	}{
+		{"2020-02-03T04:05:06+05:30", 1580682906, 19800},
+		{"2020-02-03 04:05:06 +0530", 1580682906, 19800},
+		{"Mon, 3 Feb 2020 04:05:06 -0700", 1580727906, -25200},
+		{"Mon Feb 3 04:05:06 2020 -0700", 1580727906, -25200},
+		{"@1580682906 +0530", 1580682906, 19800},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if _, offset := got.Zone(); got.Unix() != tt.unix || offset != tt.offset {
+			t.Errorf("%q: got %v, want %v at offset %d", tt.in, got, time.Unix(tt.unix, 0).UTC(), tt.offset)
+		}
+	}
+	if _, err := ParseDate("yesterday-ish"); err == nil {
+		t.Error("invalid date was accepted")
+	}
+}
+
+func TestEnvIdentOverridesConfig(t *testing.T) {
+	t.Setenv("KITKAT_COMMITTER_NAME", "Build Bot")
+	t.Setenv("KITKAT_COMMITTER_EMAIL", "bot@example.com")
+	t.Setenv("KITKAT_COMMITTER_DATE", "@1600000000 +0000")
+	id, err := committerIdent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Name != "Build Bot" || id.Email != "bot@example.com" || id.When.Unix() != 1600000000 {
+		t.Errorf("got %+v", id)
+	}
+
+	t.Setenv("KITKAT_AUTHOR_DATE", "not a date")
+	if _, err := authorIdent(); err == nil {
+		t.Error("invalid KITKAT_AUTHOR_DATE was accepted")
+	}
+}
+
+func TestParseIdent(t *testing.T) {
+	tests := []struct {
+		in, name, email string
+	}{
+		{"Jane Doe <jane@example.com>", "Jane Doe", "jane@example.com"},
+		{"  Jane   <jane@example.com>  ", "Jane", "jane@example.com"},
+		{"Doe, John <j@x.com>", "Doe, John", "j@x.com"},
+		{"A (B) <a@b.c>", "A (B)", "a@b.c"},
+		{`"Quoted" Name <q@example.com>`, `"Quoted" Name`, "q@example.com"},
+		{"Ada <ada@localhost>", "Ada", "ada@localhost"},
+		{"Ada < ada@example.com >", "Ada", "ada@example.com"},
+	}
+	for _, tt := range tests {
+		name, email, err := ParseIdent(tt.in)
+		if err != nil || name != tt.name || email != tt.email {
+			t.Errorf("ParseIdent(%q) = %q, %q, %v; want %q, %q", tt.in, name, email, err, tt.name, tt.email)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"Jane",
+		"jane@example.com",
+		"<jane@example.com>",
+		"Jane <>",
+		"Jane < >",
+		"Jane <jane@example.com",
+		"Jane <jane@example.com> trailing",
+		"Ja<ne <jane@example.com>",
+		"Ja>ne <jane@example.com>",
+		"Jane <jane>@example.com>",
+	} {
+		if name, email, err := ParseIdent(in); err == nil {
+			t.Errorf("ParseIdent(%q) = %q, %q; want an error", in, name, email)
+		}
+	}
+}
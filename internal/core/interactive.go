@@ -0,0 +1,695 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// hunkEditPath is the file a hunk is written to for manual editing
+var hunkEditPath = filepath.Join(RepoDir, "addp-hunk-edit.diff")
+
+// patchMode describes one of the interactive commands. Every command takes the
+// hunks that turn a base version of each file (the index for add and reset,
+// the working file for checkout) towards another, so the hunks shown by reset
+// and checkout are reversed to read like 'kitkat diff'.
+type patchMode struct {
+	Verb    string // "Stage", "Unstage" or "Discard"
+	Suffix  string // Appended to the prompt, for example " from worktree"
+	Reverse bool   // Show hunks in the opposite direction to the one they are applied in
+}
+
+var (
+	patchStage   = patchMode{Verb: "Stage"}
+	patchUnstage = patchMode{Verb: "Unstage", Reverse: true}
+	patchDiscard = patchMode{Verb: "Discard", Suffix: " from worktree", Reverse: true}
+)
+
+// patchFile is a file whose hunks are offered one at a time
+type patchFile struct {
+	Path  string
+	Base  []byte // Content the selected hunks are applied to
+	Mode  uint32 // Mode the result is written with
+	Hunks []unifiedHunk
+	Take  []bool
+
+	// A file that only exists on one side is offered whole. Whole is
+	// "deletion" or "addition", and taking it restores Restore (or removes the
+	// file when Restore is nil).
+	Whole   string
+	Change  fileChange // Shown in place of the hunks
+	Restore *storage.TreeEntry
+}
+
+// taken reports whether any part of the file was selected
+func (f *patchFile) taken() bool {
+	for _, take := range f.Take {
+		if take {
+			return true
+		}
+	}
+	return false
+}
+
+// result returns the base content with the selected hunks applied
+func (f *patchFile) result() ([]byte, error) {
+	var hunks []unifiedHunk
+	for i, h := range f.Hunks {
+		if f.Take[i] {
+			hunks = append(hunks, h)
+		}
+	}
+	content, err := applySelected(f.Base, hunks)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Path, err)
+	}
+	return content, nil
+}
+
+// AddPatch interactively stages hunks of the changes between the index and the
+// working directory, in the files the pathspec selects
+func AddPatch(ps *Pathspec) error {
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+	files, err := worktreePatchFiles(entries, ps, false)
+	if err != nil {
+		return err
+	}
+	if !selectPatches(files, patchStage) {
+		return nil
+	}
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		return applyPatchesToIndex(files, entries)
+	})
+}
+
+// ResetPatch interactively unstages hunks of the changes between a commit and
+// the index, in the files the pathspec selects
+func ResetPatch(rev string, ps *Pathspec) error {
+	tree, err := revisionTree(rev)
+	if err != nil {
+		return err
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	treeHashes := make(map[string]string)
+	for path, entry := range tree {
+		paths = append(paths, path)
+		if ps.Matches(path) {
+			treeHashes[path] = entry.Hash
+		}
+	}
+	indexHashes := make(map[string]string)
+	for path, entry := range entries {
+		if _, ok := tree[path]; !ok {
+			paths = append(paths, path)
+		}
+		if ps.Matches(path) {
+			indexHashes[path] = entry.Hash
+		}
+	}
+	if err := ps.errUnmatched(paths); err != nil {
+		return err
+	}
+
+	changes, err := treeChanges(treeHashes, indexHashes)
+	if err != nil {
+		return err
+	}
+	var files []*patchFile
+	for _, c := range changes {
+		switch c.Status {
+		case 'A':
+			files = append(files, &patchFile{Path: c.Path, Whole: "addition", Change: c})
+		case 'D':
+			entry := tree[c.Path]
+			files = append(files, &patchFile{Path: c.Path, Whole: "deletion", Change: c, Restore: &entry})
+		default:
+			if entries[c.Path].Mode == storage.ModeSymlink || tree[c.Path].Mode == storage.ModeSymlink {
+				continue
+			}
+			files = append(files, &patchFile{
+				Path:  c.Path,
+				Base:  c.New,
+				Mode:  entries[c.Path].Mode,
+				Hunks: buildHunks(c.New, c.Old, DiffOptions{}, unifiedContext),
+			})
+		}
+	}
+	if !selectPatches(files, patchUnstage) {
+		return nil
+	}
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		return applyPatchesToIndex(files, entries)
+	})
+}
+
+// CheckoutPatch interactively discards hunks of the changes between the index
+// and the working directory, in the files the pathspec selects
+func CheckoutPatch(ps *Pathspec) error {
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+	files, err := worktreePatchFiles(entries, ps, true)
+	if err != nil {
+		return err
+	}
+	if !selectPatches(files, patchDiscard) {
+		return nil
+	}
+
+	for _, f := range files {
+		if !f.taken() {
+			continue
+		}
+		if f.Whole != "" {
+			if err := writeWorkFile(f.Path, *f.Restore); err != nil {
+				return err
+			}
+			continue
+		}
+		content, err := f.result()
+		if err != nil {
+			return err
+		}
+		hash, err := saveObject(content)
+		if err != nil {
+			return err
+		}
+		if err := writeWorkFile(f.Path, storage.TreeEntry{Hash: hash, Mode: f.Mode}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// worktreePatchFiles returns the tracked files that differ from the index, with
+// hunks that apply to the index version or, if discard is set, to the working file
+func worktreePatchFiles(entries map[string]storage.IndexEntry, ps *Pathspec, discard bool) ([]*patchFile, error) {
+	paths := make([]string, 0, len(entries))
+	selected := make(map[string]storage.IndexEntry)
+	for path, entry := range entries {
+		paths = append(paths, path)
+		if ps.Matches(path) && entry.Mode != storage.ModeSymlink {
+			selected[path] = entry
+		}
+	}
+	if err := ps.errUnmatched(paths); err != nil {
+		return nil, err
+	}
+
+	changes, err := workdirChanges(selected)
+	if err != nil {
+		return nil, err
+	}
+	var files []*patchFile
+	for _, c := range changes {
+		entry := entries[c.Path]
+		if c.Status == 'D' {
+			f := &patchFile{Path: c.Path, Whole: "deletion", Change: c}
+			if discard {
+				f.Restore = &storage.TreeEntry{Hash: entry.Hash, Mode: entry.Mode}
+			}
+			files = append(files, f)
+			continue
+		}
+
+		info, err := os.Lstat(c.Path)
+		if err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			continue
+		}
+		f := &patchFile{Path: c.Path, Base: c.Old, Mode: entry.Mode, Hunks: buildHunks(c.Old, c.New, DiffOptions{}, unifiedContext)}
+		if discard {
+			f.Base, f.Mode = c.New, storage.ModeFromFileInfo(info)
+			f.Hunks = buildHunks(c.New, c.Old, DiffOptions{}, unifiedContext)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// applyPatchesToIndex stores the selected parts of files in the index
+func applyPatchesToIndex(files []*patchFile, entries map[string]storage.IndexEntry) error {
+	for _, f := range files {
+		if !f.taken() {
+			continue
+		}
+		if f.Whole != "" {
+			if f.Restore == nil {
+				delete(entries, f.Path)
+			} else {
+				entries[f.Path] = storage.IndexEntry{Path: f.Path, Hash: f.Restore.Hash, Mode: f.Restore.Mode}
+			}
+			continue
+		}
+		content, err := f.result()
+		if err != nil {
+			return err
+		}
+		hash, err := saveObject(content)
+		if err != nil {
+			return err
+		}
+		entries[f.Path] = storage.IndexEntry{Path: f.Path, Hash: hash, Mode: f.Mode}
+	}
+	return nil
+}
+
+// selectPatches asks about every hunk of files on the terminal and reports
+// whether anything was selected
+func selectPatches(files []*patchFile, mode patchMode) bool {
+	if len(files) == 0 {
+		fmt.Println("No changes.")
+		return false
+	}
+	s := &hunkSelector{
+		in:    bufio.NewReader(os.Stdin),
+		out:   os.Stdout,
+		mode:  mode,
+		color: isTerminal(os.Stdout),
+		edit:  editHunkText,
+	}
+	s.run(files)
+	for _, f := range files {
+		if f.taken() {
+			return true
+		}
+	}
+	return false
+}
+
+// hunkSelector runs the prompts of an interactive command
+type hunkSelector struct {
+	in    *bufio.Reader
+	out   io.Writer
+	mode  patchMode
+	color bool
+	edit  func(text string) (string, error) // Lets the user edit text, returning the result
+}
+
+// run offers the hunks of each file in turn, recording the answers in Take.
+// Quitting, or running out of input, leaves the remaining hunks unselected.
+func (s *hunkSelector) run(files []*patchFile) {
+	for _, f := range files {
+		f.Take = make([]bool, max(len(f.Hunks), 1))
+		if f.Whole != "" {
+			writeUnifiedDiff(s.out, f.Change, DiffOptions{}, s.color)
+			if !s.askWhole(f) {
+				return
+			}
+			continue
+		}
+		s.writeHeader(f.Path)
+		if !s.askHunks(f) {
+			return
+		}
+	}
+}
+
+// askWhole offers a file that is added or deleted as a whole. It returns false
+// if the user quit.
+func (s *hunkSelector) askWhole(f *patchFile) bool {
+	verb := strings.ToLower(s.mode.Verb)
+	for {
+		fmt.Fprintf(s.out, "(1/1) %s %s%s [y,n,q,a,d,?]? ", s.mode.Verb, f.Whole, s.mode.Suffix)
+		switch s.readAnswer() {
+		case "y", "a":
+			f.Take[0] = true
+			return true
+		case "n", "d":
+			return true
+		case "q":
+			return false
+		default:
+			fmt.Fprintf(s.out, "y - %s this %s\nn - do not %s this %s\nq - quit; do not %s this %s or any of the remaining ones\n", verb, f.Whole, verb, f.Whole, verb, f.Whole)
+		}
+	}
+}
+
+// askHunks offers each hunk of a file. It returns false if the user quit.
+func (s *hunkSelector) askHunks(f *patchFile) bool {
+	for i := 0; i < len(f.Hunks); {
+		parts := splitHunk(f.Hunks[i])
+		options := "y,n,q,a,d"
+		if len(parts) > 1 {
+			options += ",s"
+		}
+		options += ",e,?"
+
+		s.writeHunk(f.Hunks[i])
+		fmt.Fprintf(s.out, "(%d/%d) %s this hunk%s [%s]? ", i+1, len(f.Hunks), s.mode.Verb, s.mode.Suffix, options)
+		switch answer := s.readAnswer(); answer {
+		case "y":
+			f.Take[i] = true
+			i++
+		case "n":
+			i++
+		case "a":
+			for ; i < len(f.Hunks); i++ {
+				f.Take[i] = true
+			}
+		case "d":
+			i = len(f.Hunks)
+		case "q":
+			return false
+		case "s":
+			if len(parts) < 2 {
+				fmt.Fprintln(s.out, "Sorry, cannot split this hunk")
+				continue
+			}
+			fmt.Fprintf(s.out, "Split into %d hunks.\n", len(parts))
+			f.Hunks = append(f.Hunks[:i], append(parts, f.Hunks[i+1:]...)...)
+			f.Take = append(f.Take[:i], append(make([]bool, len(parts)), f.Take[i+1:]...)...)
+		case "e":
+			edited, ok, err := s.editHunk(f.Hunks[i])
+			if err != nil {
+				fmt.Fprintln(s.out, "error:", err)
+				continue
+			}
+			if ok {
+				f.Hunks[i], f.Take[i] = edited, true
+				i++
+			}
+		default:
+			verb := strings.ToLower(s.mode.Verb)
+			fmt.Fprintf(s.out, "y - %s this hunk\n", verb)
+			fmt.Fprintf(s.out, "n - do not %s this hunk\n", verb)
+			fmt.Fprintf(s.out, "q - quit; do not %s this hunk or any of the remaining ones\n", verb)
+			fmt.Fprintf(s.out, "a - %s this hunk and all later hunks in the file\n", verb)
+			fmt.Fprintf(s.out, "d - do not %s this hunk or any of the later hunks in the file\n", verb)
+			fmt.Fprintln(s.out, "s - split the current hunk into smaller hunks")
+			fmt.Fprintln(s.out, "e - manually edit the current hunk")
+			fmt.Fprintln(s.out, "? - print help")
+		}
+	}
+	return true
+}
+
+// readAnswer reads one answer, lowercased to its first letter. The end of the
+// input counts as quitting.
+func (s *hunkSelector) readAnswer() string {
+	line, err := s.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if err != nil && line == "" {
+		fmt.Fprintln(s.out)
+		return "q"
+	}
+	if line == "" {
+		return ""
+	}
+	return strings.ToLower(line[:1])
+}
+
+// writeHeader prints the file header shown before its hunks
+func (s *hunkSelector) writeHeader(path string) {
+	header := fmt.Sprintf("diff --git a/%s b/%s\n--- a/%s\n+++ b/%s", path, path, path, path)
+	if s.color {
+		header = colorBlue + header + colorReset
+	}
+	fmt.Fprintln(s.out, header)
+}
+
+// writeHunk prints a hunk the way 'kitkat diff' would show it
+func (s *hunkSelector) writeHunk(h unifiedHunk) {
+	if s.mode.Reverse {
+		h = reverseHunk(h)
+	}
+	text := formatHunk(h)
+	if !s.color {
+		fmt.Fprint(s.out, text)
+		return
+	}
+	for _, line := range splitLinesKeepEnds([]byte(text)) {
+		switch line[0] {
+		case '@':
+			line = "\033[36m" + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+		case '-':
+			line = colorRed + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+		case '+':
+			line = colorGreen + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+		}
+		fmt.Fprint(s.out, line)
+	}
+}
+
+// editHunk lets the user edit the change a hunk makes, in the direction it is
+// applied. It returns false if the edit was abandoned.
+func (s *hunkSelector) editHunk(h unifiedHunk) (unifiedHunk, bool, error) {
+	var b strings.Builder
+	b.WriteString("# Manual hunk edit mode -- see bottom for a quick guide.\n")
+	b.WriteString(formatHunk(h))
+	b.WriteString("# ---\n")
+	b.WriteString("# To remove '-' lines, make them ' ' lines (context).\n")
+	b.WriteString("# To remove '+' lines, delete them.\n")
+	b.WriteString("# Lines starting with # will be removed.\n")
+	b.WriteString("#\n")
+	fmt.Fprintf(&b, "# If the patch applies cleanly, the edited hunk will immediately be marked for %s.\n", strings.ToLower(s.mode.Verb)+"ing")
+	b.WriteString("# If it does not apply cleanly, the hunk is offered again unchanged.\n")
+	b.WriteString("# If all lines of the hunk are removed, then the edit is aborted.\n")
+
+	text, err := s.edit(b.String())
+	if err != nil {
+		return unifiedHunk{}, false, err
+	}
+	edited, err := parseEditedHunk(text, h)
+	if err != nil {
+		return unifiedHunk{}, false, err
+	}
+	return edited, edited.Lines != nil, nil
+}
+
+// editHunkText opens the user's editor on text and returns what they saved
+func editHunkText(text string) (string, error) {
+	if err := os.WriteFile(hunkEditPath, []byte(text), 0644); err != nil {
+		return "", err
+	}
+	defer os.Remove(hunkEditPath)
+	if err := runEditor(hunkEditPath); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(hunkEditPath)
+	return string(data), err
+}
+
+// formatHunk renders a hunk with its @@ header as patch text
+func formatHunk(h unifiedHunk) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+	for _, l := range h.Lines {
+		switch l.Op {
+		case diff.EQUAL:
+			b.WriteString(" ")
+		case diff.DELETE:
+			b.WriteString("-")
+		case diff.INSERT:
+			b.WriteString("+")
+		}
+		b.WriteString(strings.TrimSuffix(l.Text, "\n") + "\n")
+		if !strings.HasSuffix(l.Text, "\n") {
+			b.WriteString(noNewlineMarker + "\n")
+		}
+	}
+	return b.String()
+}
+
+// reverseHunk returns the hunk that undoes h, with removed lines listed before
+// added ones in each run of changes as a diff would show them
+func reverseHunk(h unifiedHunk) unifiedHunk {
+	r := unifiedHunk{OldStart: h.NewStart, OldLines: h.NewLines, NewStart: h.OldStart, NewLines: h.OldLines}
+	var added []unifiedLine
+	for _, l := range h.Lines {
+		switch l.Op {
+		case diff.DELETE:
+			l.Op = diff.INSERT
+			added = append(added, l)
+			continue
+		case diff.INSERT:
+			l.Op = diff.DELETE
+		default:
+			r.Lines = append(r.Lines, added...)
+			added = nil
+		}
+		r.Lines = append(r.Lines, l)
+	}
+	r.Lines = append(r.Lines, added...)
+	return r
+}
+
+// parseEditedHunk reads back a hunk edited from orig. Comments and the @@
+// header are ignored. The edited hunk must still apply where orig did, so its
+// old side has to be unchanged. A hunk with no lines left has nil Lines.
+func parseEditedHunk(text string, orig unifiedHunk) (unifiedHunk, error) {
+	h := unifiedHunk{OldStart: orig.OldStart, OldLines: orig.OldLines, NewStart: orig.NewStart}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "@@") {
+			continue
+		}
+		if strings.HasPrefix(line, "\\") {
+			if len(h.Lines) > 0 {
+				last := &h.Lines[len(h.Lines)-1]
+				last.Text = strings.TrimSuffix(last.Text, "\n")
+			}
+			continue
+		}
+		op := diff.EQUAL
+		switch {
+		case line == "":
+			line = " "
+		case line[0] == '-':
+			op = diff.DELETE
+		case line[0] == '+':
+			op = diff.INSERT
+		case line[0] != ' ':
+			return unifiedHunk{}, fmt.Errorf("unrecognised line in edited hunk: %q", line)
+		}
+		h.Lines = append(h.Lines, unifiedLine{Op: op, Text: line[1:] + "\n"})
+		if op != diff.DELETE {
+			h.NewLines++
+		}
+	}
+	if h.Lines == nil {
+		return h, nil
+	}
+
+	oldSide, _ := hunkSides(orig.Lines)
+	editedOld, _ := hunkSides(h.Lines)
+	if strings.Join(oldSide, "") != strings.Join(editedOld, "") {
+		return unifiedHunk{}, errors.New("your edited hunk does not apply")
+	}
+	return h, nil
+}
+
+// splitHunk splits a hunk into one hunk per run of changed lines. The context
+// between two runs is shown with both, as it belongs to each of them.
+func splitHunk(h unifiedHunk) []unifiedHunk {
+	type run struct{ start, end int }
+	var runs []run
+	for i := 0; i < len(h.Lines); {
+		if h.Lines[i].Op == diff.EQUAL {
+			i++
+			continue
+		}
+		j := i
+		for j < len(h.Lines) && h.Lines[j].Op != diff.EQUAL {
+			j++
+		}
+		runs = append(runs, run{i, j})
+		i = j
+	}
+	if len(runs) < 2 {
+		return []unifiedHunk{h}
+	}
+
+	// 0-based line numbers on each side before each line of the hunk
+	oldNo, newNo := make([]int, len(h.Lines)), make([]int, len(h.Lines))
+	o, n := h.OldStart-1, h.NewStart-1
+	if h.OldLines == 0 {
+		o++
+	}
+	if h.NewLines == 0 {
+		n++
+	}
+	for i, l := range h.Lines {
+		oldNo[i], newNo[i] = o, n
+		if l.Op != diff.INSERT {
+			o++
+		}
+		if l.Op != diff.DELETE {
+			n++
+		}
+	}
+
+	parts := make([]unifiedHunk, len(runs))
+	for k := range runs {
+		from, to := 0, len(h.Lines)
+		if k > 0 {
+			from = runs[k-1].end
+		}
+		if k+1 < len(runs) {
+			to = runs[k+1].start
+		}
+		p := unifiedHunk{OldStart: oldNo[from] + 1, NewStart: newNo[from] + 1, Lines: h.Lines[from:to:to]}
+		for _, l := range p.Lines {
+			if l.Op != diff.INSERT {
+				p.OldLines++
+			}
+			if l.Op != diff.DELETE {
+				p.NewLines++
+			}
+		}
+		if p.OldLines == 0 {
+			p.OldStart--
+		}
+		if p.NewLines == 0 {
+			p.NewStart--
+		}
+		parts[k] = p
+	}
+	return parts
+}
+
+// applySelected applies hunks, in order and all taken from the same diff of
+// base, to base. Hunks split from one another may share context lines.
+func applySelected(base []byte, hunks []unifiedHunk) ([]byte, error) {
+	sort.SliceStable(hunks, func(i, j int) bool { return hunks[i].OldStart < hunks[j].OldStart })
+	lines := splitLinesKeepEnds(base)
+	var out strings.Builder
+	pos := 0
+	for _, h := range hunks {
+		start := h.OldStart - 1
+		if h.OldLines == 0 {
+			start = h.OldStart
+		}
+		if start > len(lines) {
+			return nil, errors.New("hunk does not apply")
+		}
+		for _, line := range lines[min(pos, start):start] {
+			out.WriteString(line)
+		}
+
+		// Context lines before pos were already written by the previous hunk
+		skip := max(0, pos-start)
+		at := start
+		for _, l := range h.Lines {
+			if l.Op != diff.INSERT {
+				if at >= len(lines) || lines[at] != l.Text {
+					return nil, errors.New("hunk does not apply")
+				}
+				at++
+			}
+			if skip > 0 {
+				if l.Op != diff.EQUAL {
+					return nil, errors.New("overlapping hunks change the same lines")
+				}
+				skip--
+				continue
+			}
+			if l.Op != diff.DELETE {
+				out.WriteString(l.Text)
+			}
+		}
+		pos = at
+	}
+	for _, line := range lines[pos:] {
+		out.WriteString(line)
+	}
+	return []byte(out.String()), nil
+}
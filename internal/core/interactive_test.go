@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestSplitAndApplyHunks(t *testing.T) {
+	base := []byte("a\nb\nc\nd\ne\nf\ng\nh\n")
+	target := []byte("a\nB\nc\nd\ne\nF\ng\nh\n")
+	hunks := buildHunks(base, target, DiffOptions{}, unifiedContext)
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(hunks))
+	}
+	parts := splitHunk(hunks[0])
+	if len(parts) != 2 {
+		t.Fatalf("split into %d hunks, want 2", len(parts))
+	}
+
+	tests := []struct {
+		take []bool
+		want string
+	}{
+		{[]bool{true, false}, "a\nB\nc\nd\ne\nf\ng\nh\n"},
+		{[]bool{false, true}, "a\nb\nc\nd\ne\nF\ng\nh\n"},
+		{[]bool{true, true}, string(target)},
+		{[]bool{false, false}, string(base)},
+	}
+	for _, tt := range tests {
+		var selected []unifiedHunk
+		for i, take := range tt.take {
+			if take {
+				selected = append(selected, parts[i])
+			}
+		}
+		got, err := applySelected(base, selected)
+		if err != nil {
+			t.Fatalf("take %v: %v", tt.take, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("take %v: got %q, want %q", tt.take, got, tt.want)
+		}
+	}
+}
+
+func TestHunkSelectorAnswers(t *testing.T) {
+	base := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	target := []byte("one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve\n")
+	file := &patchFile{Path: "f", Base: base, Hunks: buildHunks(base, target, DiffOptions{}, unifiedContext)}
+	if len(file.Hunks) != 2 {
+		t.Fatalf("got %d hunks, want 2", len(file.Hunks))
+	}
+
+	// Edit the first hunk to add a different line, skip the second
+	s := &hunkSelector{
+		in:   bufio.NewReader(strings.NewReader("e\nn\n")),
+		out:  io.Discard,
+		mode: patchStage,
+		edit: func(text string) (string, error) {
+			return strings.Replace(text, "+one\n", "+uno\n", 1), nil
+		},
+	}
+	s.run([]*patchFile{file})
+	got, err := file.result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "uno\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"; string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// An edit that changes the old side does not apply
+	if _, err := parseEditedHunk("@@ -1,4 +1,4 @@\n-x\n+one\n 2\n 3\n 4\n", file.Hunks[1]); err == nil {
+		t.Error("edited hunk with a changed old side was accepted")
+	}
+}
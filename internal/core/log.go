@@ -2,15 +2,28 @@ package core
 
 import (
 	"fmt"
+	"os"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/models"
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-// ShowLog prints the commit log. It accepts a boolean for oneline format
-// and an optional limit to restrict the number of commits shown (use -1 or 0 for no limit)
-func ShowLog(oneline bool, limit int) error {
+// LogOptions controls the output of ShowLog
+type LogOptions struct {
+	Oneline  bool            // Compact, single-line view
+	Format   string          // Header format, one of LogFormats or a format string with % placeholders; "" for medium
+	Limit    int             // Maximum number of commits to show (use -1 or 0 for no limit)
+	ShowDiff bool            // Print the changes introduced by each commit
+	Diff     DiffOptions     // How the changes are rendered when ShowDiff is set
+	Paths    *Pathspec       // Only show commits (and changes) touching these paths; nil for all
+	Trailers []TrailerFilter // Only show commits with all of these trailers
+}
+
+// ShowLog prints the commit log starting at HEAD according to the given options
+func ShowLog(opts LogOptions) error {
 	// 1Start from HEAD (Architecture from reset-hard branch)
 	// We must walk backwards from HEAD, otherwise 'reset' changes won't be reflected
 	currentCommit, err := GetHeadCommit()
@@ -25,7 +38,7 @@ func ShowLog(oneline bool, limit int) error {
 	// Walk the graph (Architecture from reset-hard branch)
 	for commitHash != "" {
 		// Apply the Limit Check (Feature from main branch)
-		if limit > 0 && count >= limit {
+		if opts.Limit > 0 && count >= opts.Limit {
 			break
 		}
 
@@ -34,14 +47,37 @@ func ShowLog(oneline bool, limit int) error {
 			return err
 		}
 
+		// Skip commits that leave the selected paths alone
+		if !opts.Paths.IsEmpty() {
+			touches, err := commitTouches(commit, opts.Paths)
+			if err != nil {
+				return err
+			}
+			if !touches {
+				commitHash = commit.Parent
+				continue
+			}
+		}
+
+		// Skip commits missing a selected trailer
+		if !matchesTrailers(commit.Message, opts.Trailers) {
+			commitHash = commit.Parent
+			continue
+		}
+
 		// Print Logic
-		if oneline {
-			fmt.Printf("%s %s\n", commit.ID[:7], commit.Message)
+		if opts.Oneline {
+			fmt.Printf("%s %s\n", commit.ID[:7], CommitSubject(commit.Message))
+		} else if IsFormatString(opts.Format) {
+			fmt.Println(formatCommit(opts.Format, commit))
 		} else {
-			fmt.Printf("commit %s\n", commit.ID)
-			fmt.Printf("Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
-			fmt.Printf("Date:   %s\n", commit.Timestamp.Local().Format("Mon Jan 02 15:04:05 2006 -0700"))
-			fmt.Printf("\n    %s\n\n", commit.Message)
+			printCommitHeader(commit, opts.Format)
+		}
+
+		if opts.ShowDiff {
+			if err := printCommitChanges(commit, opts.Diff, opts.Paths); err != nil {
+				return err
+			}
 		}
 
 		// Move to parent pointer
@@ -88,10 +124,233 @@ func ShowShortLog() error {
 	for _, log := range logs {
 		fmt.Printf("%s (%d):\n", log.name, len(log.commits))
 		for _, commit := range log.commits {
-			fmt.Printf("\t%s\n", commit.Message)
+			fmt.Printf("\t%s\n", CommitSubject(commit.Message))
 		}
 		fmt.Println()
 	}
 
 	return nil
 }
+
+// logDateFormat is how dates are shown in commit headers
+const logDateFormat = "Mon Jan 02 15:04:05 2006 -0700"
+
+// LogFormats are the header formats --format accepts besides oneline
+var LogFormats = []string{"short", "medium", "full", "fuller"}
+
+// printCommitHeader prints the commit ID, author, date and indented message.
+// format is one of LogFormats and picks which identities and dates are shown.
+// Dates are shown in the time zone they were recorded in.
+func printCommitHeader(commit models.Commit, format string) {
+	committer := commitCommitter(commit)
+	fmt.Printf("commit %s\n", commit.ID)
+	switch format {
+	case "short":
+		fmt.Printf("Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+	case "full":
+		fmt.Printf("Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+		fmt.Printf("Commit: %s <%s>\n", committer.Name, committer.Email)
+	case "fuller":
+		fmt.Printf("Author:     %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+		fmt.Printf("AuthorDate: %s\n", commit.Timestamp.Format(logDateFormat))
+		fmt.Printf("Commit:     %s <%s>\n", committer.Name, committer.Email)
+		fmt.Printf("CommitDate: %s\n", committer.When.Format(logDateFormat))
+	default:
+		fmt.Printf("Author: %s <%s>\n", commit.AuthorName, commit.AuthorEmail)
+		fmt.Printf("Date:   %s\n", commit.Timestamp.Format(logDateFormat))
+	}
+	fmt.Println()
+	for _, line := range strings.Split(commit.Message, "\n") {
+		fmt.Printf("    %s\n", line)
+	}
+	fmt.Println()
+}
+
+// IsFormatString reports whether a --format value is a format string with
+// placeholders rather than the name of a format
+func IsFormatString(format string) bool {
+	return strings.Contains(format, "%")
+}
+
+// formatCommit expands the placeholders of a format string for a commit:
+// %H and %h (hash), %T (tree), %s (subject), %b (body), %B (message),
+// %an, %ae, %ad (author), %cn, %ce, %cd (committer), %n (newline), %% and
+// %(trailers[:key=<key>,...][,valueonly])
+func formatCommit(format string, commit models.Commit) string {
+	committer := commitCommitter(commit)
+	_, body, _ := strings.Cut(commit.Message, "\n")
+	fields := map[string]string{
+		"H": commit.ID, "h": commit.ID[:7], "T": commit.TreeHash,
+		"s": CommitSubject(commit.Message), "b": strings.TrimLeft(body, "\n"), "B": commit.Message,
+		"an": commit.AuthorName, "ae": commit.AuthorEmail, "ad": commit.Timestamp.Format(logDateFormat),
+		"cn": committer.Name, "ce": committer.Email, "cd": committer.When.Format(logDateFormat),
+		"n": "\n", "%": "%",
+	}
+
+	var out strings.Builder
+	for {
+		i := strings.IndexByte(format, '%')
+		if i < 0 {
+			out.WriteString(format)
+			return out.String()
+		}
+		out.WriteString(format[:i])
+		format = format[i+1:]
+		if rest, ok := strings.CutPrefix(format, "(trailers"); ok {
+			if end := strings.IndexByte(rest, ')'); end >= 0 {
+				out.WriteString(formatTrailers(commit.Message, strings.TrimPrefix(rest[:end], ":")))
+				format = rest[end+1:]
+				continue
+			}
+		}
+		// Two letter placeholders first, so %an is not read as %a followed by n
+		matched := false
+		for _, n := range []int{2, 1} {
+			if len(format) >= n {
+				if value, ok := fields[format[:n]]; ok {
+					out.WriteString(value)
+					format = format[n:]
+					matched = true
+					break
+				}
+			}
+		}
+		if !matched {
+			out.WriteByte('%')
+		}
+	}
+}
+
+// formatTrailers renders the trailers of a message for %(trailers), one per
+// line. options is a comma separated list of key=<key> (show only those keys)
+// and valueonly (leave out the keys).
+func formatTrailers(message, options string) string {
+	var keys []string
+	valueOnly := false
+	for _, opt := range strings.Split(options, ",") {
+		if key, ok := strings.CutPrefix(opt, "key="); ok {
+			keys = append(keys, key)
+		} else if opt == "valueonly" {
+			valueOnly = true
+		}
+	}
+	var out strings.Builder
+	for _, t := range ParseTrailers(message) {
+		if len(keys) > 0 && !slices.ContainsFunc(keys, func(k string) bool { return strings.EqualFold(k, t.Key) }) {
+			continue
+		}
+		if valueOnly {
+			out.WriteString(t.Value + "\n")
+		} else {
+			out.WriteString(t.String() + "\n")
+		}
+	}
+	return out.String()
+}
+
+// matchesTrailers reports whether a message has a trailer for every filter
+func matchesTrailers(message string, filters []TrailerFilter) bool {
+	for _, f := range filters {
+		if !f.Matches(message) {
+			return false
+		}
+	}
+	return true
+}
+
+// commitCommitter returns who committed a commit and when. Commits recorded
+// before committers were tracked count the author as the committer.
+func commitCommitter(commit models.Commit) identity {
+	if commit.CommitterName == "" {
+		return identity{Name: commit.AuthorName, Email: commit.AuthorEmail, When: commit.Timestamp}
+	}
+	return identity{Name: commit.CommitterName, Email: commit.CommitterEmail, When: commit.CommitTime}
+}
+
+// commitChanges returns the changes a commit introduced relative to its parent
+func commitChanges(commit models.Commit) ([]fileChange, error) {
+	parentTree := make(map[string]string)
+	if commit.Parent != "" {
+		parent, err := storage.FindCommit(commit.Parent)
+		if err != nil {
+			return nil, err
+		}
+		parentTree, err = storage.ParseTree(parent.TreeHash)
+		if err != nil {
+			return nil, err
+		}
+	}
+	tree, err := storage.ParseTree(commit.TreeHash)
+	if err != nil {
+		return nil, err
+	}
+	return treeChanges(parentTree, tree)
+}
+
+// commitTouches reports whether a commit changed any path a pathspec selects
+func commitTouches(commit models.Commit, ps *Pathspec) (bool, error) {
+	parentTree := make(map[string]storage.TreeEntry)
+	if commit.Parent != "" {
+		parent, err := storage.FindCommit(commit.Parent)
+		if err != nil {
+			return false, err
+		}
+		parentTree, err = storage.ParseTreeEntries(parent.TreeHash)
+		if err != nil {
+			return false, err
+		}
+	}
+	tree, err := storage.ParseTreeEntries(commit.TreeHash)
+	if err != nil {
+		return false, err
+	}
+
+	for path, entry := range tree {
+		if old, ok := parentTree[path]; (!ok || old != entry) && ps.Matches(path) {
+			return true, nil
+		}
+	}
+	for path := range parentTree {
+		if _, ok := tree[path]; !ok && ps.Matches(path) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// printCommitChanges prints the changes a commit introduced relative to its parent
+// to the paths a pathspec selects (nil for all).
+// Patches are printed as unified diffs unless word highlighting is requested.
+func printCommitChanges(commit models.Commit, opts DiffOptions, paths *Pathspec) error {
+	changes, err := commitChanges(commit)
+	if err != nil {
+		return err
+	}
+	changes = effectiveChanges(changes, opts)
+	if !paths.IsEmpty() {
+		var selected []fileChange
+		for _, c := range changes {
+			if paths.Matches(c.Path) {
+				selected = append(selected, c)
+			}
+		}
+		changes = selected
+	}
+
+	switch {
+	case opts.Format != DiffPatch:
+		printChanges(changes, opts)
+	case opts.WordDiff != WordDiffNone:
+		for _, c := range changes {
+			fmt.Printf("%sdiff --git a/%s b/%s%s\n", colorBlue, c.Path, c.Path, colorReset)
+			printPatch(c.Old, c.New, opts)
+		}
+	default:
+		color := isTerminal(os.Stdout)
+		for _, c := range changes {
+			writeUnifiedDiff(os.Stdout, c, opts, color)
+		}
+	}
+	fmt.Println()
+	return nil
+}
@@ -2,18 +2,27 @@ package core
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-// ListFiles prints all tracked file paths from the index
-func ListFiles() error {
+// ListFiles prints the tracked file paths a pathspec selects from the index.
+// A nil pathspec selects every file.
+func ListFiles(ps *Pathspec) error {
 	index, err := storage.LoadIndex()
 	if err != nil {
 		return err
 	}
 
+	paths := make([]string, 0, len(index))
 	for path := range index {
+		if ps.Matches(path) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
 		fmt.Println(path)
 	}
 	return nil
@@ -19,15 +19,6 @@ func Merge(branchToMerge string) error {
 		return errors.New("not a kitkat repository (run `kitkat init`)")
 	}
 
-	//Safety Check: Verify working directory is clean
-	dirty, err := IsWorkDirDirty()
-	if err != nil {
-		return fmt.Errorf("failed to check working directory status: %w", err)
-	}
-	if dirty {
-		return fmt.Errorf("error: your local changes would be overwritten by merge. Please commit or stash them")
-	}
-
 	// Getting the commit hash of the branch to merge
 	branchPath := filepath.Join(HeadsDir, branchToMerge)
 	featureHeadHashBytes, err := os.ReadFile(branchPath)
@@ -64,25 +55,21 @@ func Merge(branchToMerge string) error {
 		// diverged
 		return fmt.Errorf(
 			"fatal: Not possible to fast-forward, aborting.\n"+
-				"Merge commits are not supported. Please rebase '%s' onto the current branch",
-			branchToMerge,
+				"Merge commits are not supported. Rebase '%s' onto the current branch with\n"+
+				"'kitkat rebase %s %s', then merge it again",
+			branchToMerge, currentHeadHash[:7], branchToMerge,
 		)
 	}
 
 	// Fast-Forward Execution
-	if err := UpdateBranchPointer(featureHeadHash); err != nil {
+	// The working directory, index and branch pointer move together; local
+	// changes that would be overwritten abort the merge before anything moves
+	update, err := branchPointerUpdate(featureHeadHash)
+	if err != nil {
 		return fmt.Errorf("failed to update branch pointer: %w", err)
 	}
-
-	// Update the working directory and index to match the new HEAD state
-	err = UpdateWorkspaceAndIndex(featureHeadHash)
-	if err != nil {
-		// Attempt to roll back the branch pointer on failure
-		fmt.Printf("UpdateWorkspaceAndIndex failed: %v. Rolling back branch pointer...\n", err)
-		if rollbackErr := UpdateBranchPointer(currentHeadHash); rollbackErr != nil {
-			return fmt.Errorf("failed to update workspace: %w; additionally failed to rollback branch pointer: %v", err, rollbackErr)
-		}
-		return fmt.Errorf("failed to update workspace: %w; branch pointer rolled back to %s", err, currentHeadHash)
+	if err := checkoutTree(featureHeadHash, CheckoutOptions{}, "merge", update); err != nil {
+		return fmt.Errorf("failed to update workspace: %w", err)
 	}
 
 	return nil
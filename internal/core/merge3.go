@@ -0,0 +1,129 @@
+package core
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+// mergeHunk is a change one side made to the common base: base lines
+// [Start, End) are replaced with Lines
+type mergeHunk struct {
+	Start, End int
+	Lines      []string
+	Ours       bool
+}
+
+// splitRawLines splits content into lines that keep their line endings, so a
+// missing newline at the end of the file survives a merge
+func splitRawLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// lineHunks returns the changes that turn base into other, in base order
+func lineHunks(base, other []string, ours bool) []mergeHunk {
+	var hunks []mergeHunk
+	var cur *mergeHunk
+	pos := 0
+	for _, d := range diff.NewMyersDiff(base, other).Diffs() {
+		if d.Operation == diff.EQUAL {
+			if cur != nil {
+				hunks = append(hunks, *cur)
+				cur = nil
+			}
+			pos += len(d.Text)
+			continue
+		}
+		if cur == nil {
+			cur = &mergeHunk{Start: pos, End: pos, Ours: ours}
+		}
+		if d.Operation == diff.DELETE {
+			pos += len(d.Text)
+			cur.End = pos
+		} else {
+			cur.Lines = append(cur.Lines, d.Text...)
+		}
+	}
+	if cur != nil {
+		hunks = append(hunks, *cur)
+	}
+	return hunks
+}
+
+// applySide returns base lines [start, end) with one side's hunks applied
+func applySide(base []string, start, end int, hunks []mergeHunk, ours bool) []string {
+	var lines []string
+	pos := start
+	for _, h := range hunks {
+		if h.Ours != ours {
+			continue
+		}
+		lines = append(lines, base[pos:h.Start]...)
+		lines = append(lines, h.Lines...)
+		pos = h.End
+	}
+	return append(lines, base[pos:end]...)
+}
+
+// merge3 combines the changes made from base to ours and from base to theirs.
+// Changes that overlap or touch are taken once if both sides agree; otherwise
+// both versions are written between conflict markers labelled oursLabel and
+// theirsLabel, and conflict is true.
+func merge3(base, ours, theirs []byte, oursLabel, theirsLabel string) (merged []byte, conflict bool) {
+	baseLines := splitRawLines(base)
+	hunks := append(lineHunks(baseLines, splitRawLines(ours), true), lineHunks(baseLines, splitRawLines(theirs), false)...)
+	sort.SliceStable(hunks, func(i, j int) bool { return hunks[i].Start < hunks[j].Start })
+
+	var out strings.Builder
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			out.WriteString(line)
+		}
+	}
+	// Markers must start on a line of their own
+	writeSide := func(lines []string) {
+		writeLines(lines)
+		if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+			out.WriteString("\n")
+		}
+	}
+
+	pos := 0
+	for i := 0; i < len(hunks); {
+		// Group every hunk that overlaps or touches the region started by hunks[i]
+		start, end := hunks[i].Start, hunks[i].End
+		j := i + 1
+		hasOurs, hasTheirs := hunks[i].Ours, !hunks[i].Ours
+		for ; j < len(hunks) && hunks[j].Start <= end; j++ {
+			end = max(end, hunks[j].End)
+			hasOurs = hasOurs || hunks[j].Ours
+			hasTheirs = hasTheirs || !hunks[j].Ours
+		}
+		group := hunks[i:j]
+
+		writeLines(baseLines[pos:start])
+		oursLines := applySide(baseLines, start, end, group, true)
+		theirsLines := applySide(baseLines, start, end, group, false)
+		switch {
+		case !hasTheirs:
+			writeLines(oursLines)
+		case !hasOurs || strings.Join(oursLines, "") == strings.Join(theirsLines, ""):
+			writeLines(theirsLines)
+		default:
+			conflict = true
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeSide(oursLines)
+			out.WriteString("=======\n")
+			writeSide(theirsLines)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+		pos, i = end, j
+	}
+	writeLines(baseLines[pos:])
+	return []byte(out.String()), conflict
+}
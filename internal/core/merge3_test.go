@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	tests := []struct {
+		name, ours, theirs, want string
+		conflict                 bool
+	}{
+		{"separate changes", "A\nb\nc\nd\ne\n", "a\nb\nc\nd\nE\n", "A\nb\nc\nd\nE\n", false},
+		{"same change", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", "a\nB\nc\nd\ne\n", false},
+		{"one side only", base, "a\nc\nd\ne\nf\n", "a\nc\nd\ne\nf\n", false},
+		{"overlap", "a\nb\nX\nd\ne\n", "a\nb\nY\nd\ne\n", "a\nb\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nd\ne\n", true},
+		{"no final newline", "a\nb\nc\nd\ne\nf", base, "a\nb\nc\nd\ne\nf", false},
+	}
+	for _, tt := range tests {
+		merged, conflict := merge3([]byte(base), []byte(tt.ours), []byte(tt.theirs), "ours", "theirs")
+		if string(merged) != tt.want || conflict != tt.conflict {
+			t.Errorf("%s: got %q (conflict %v), want %q (conflict %v)", tt.name, merged, conflict, tt.want, tt.conflict)
+		}
+	}
+}
@@ -36,19 +36,9 @@ func MoveFile(oldPath, newPath string, force bool) error {
 		return err
 	}
 
-	// Load index
-	idx, err := storage.LoadIndex()
-	if err != nil {
-		return err
-	}
-
 	// Remove old file from index
-	delete(idx, oldPath)
-
-	// Write index
-	if err := storage.WriteIndex(idx); err != nil {
-		return err
-	}
-
-	return nil
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		delete(entries, oldPath)
+		return nil
+	})
 }
@@ -1,10 +1,11 @@
 package core
 
 import (
-	"encoding/json"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 func TestMoveFile(t *testing.T) {
@@ -172,15 +173,8 @@ func TestMoveFile_SamePath(t *testing.T) {
 }
 
 func loadIndexForTest(path string) (map[string]string, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	var idx map[string]string
-	if err := json.Unmarshal(data, &idx); err != nil {
+	if _, err := os.Stat(path); err != nil {
 		return nil, err
 	}
-
-	return idx, nil
+	return storage.LoadIndex()
 }
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// parallelism returns how many files are hashed or written at once: the
+// core.parallel setting, or one per CPU when it is unset, 0 or invalid.
+// Setting it to 1 does all the work on a single goroutine.
+func parallelism() int {
+	if value, ok, _ := GetConfig("core.parallel"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return runtime.NumCPU()
+}
+
+// forEachParallel calls fn for every index in [0, n) on a bounded pool of
+// workers. fn must store its results by index so that callers can report them
+// in a fixed order whatever the scheduling. The error returned is the one with
+// the lowest index.
+func forEachParallel(n int, fn func(i int) error) error {
+	workers := min(parallelism(), n)
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			if err := fn(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
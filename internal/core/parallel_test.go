@@ -0,0 +1,59 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestForEachParallelReportsFirstError(t *testing.T) {
+	err := forEachParallel(100, func(i int) error {
+		if i == 40 || i == 70 {
+			return fmt.Errorf("failed %d", i)
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "failed 40" {
+		t.Errorf("expected the lowest failing index to be reported, got %v", err)
+	}
+}
+
+func TestAddAllIdenticalFiles(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files with the same content are stored as the same blob at the same time
+	for i := 0; i < 50; i++ {
+		if err := os.WriteFile(fmt.Sprintf("file%02d.txt", i), []byte("same\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AddAll(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := storage.LoadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		hash, ok := index[fmt.Sprintf("file%02d.txt", i)]
+		if !ok {
+			t.Fatalf("file%02d.txt was not staged", i)
+		}
+		if _, err := storage.ReadObject(hash); errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("blob %s was not stored", hash)
+		}
+	}
+}
@@ -0,0 +1,355 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// maxFuzz is how many context lines at either end of a hunk may be ignored
+// when a hunk does not apply exactly, like patch(1)'s default fuzz factor
+const maxFuzz = 2
+
+// hunkHeaderPattern matches "@@ -l[,s] +l[,s] @@"
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// filePatch is the part of a unified diff that changes a single file.
+// OldPath is empty for new files and NewPath is empty for deleted files.
+type filePatch struct {
+	OldPath string
+	NewPath string
+	OldMode uint32 // Mode before the patch, 0 if the patch does not say
+	NewMode uint32 // Mode after the patch, 0 if the patch does not say
+	IsNew   bool
+	IsDel   bool
+	Hunks   []unifiedHunk
+}
+
+// isRename reports whether the patch moves a file to a different path
+func (p filePatch) isRename() bool {
+	return p.OldPath != "" && p.NewPath != "" && p.OldPath != p.NewPath
+}
+
+// reverse returns the patch that undoes p
+func (p filePatch) reverse() filePatch {
+	r := filePatch{OldPath: p.NewPath, NewPath: p.OldPath, OldMode: p.NewMode, NewMode: p.OldMode, IsNew: p.IsDel, IsDel: p.IsNew}
+	for _, h := range p.Hunks {
+		rh := unifiedHunk{OldStart: h.NewStart, OldLines: h.NewLines, NewStart: h.OldStart, NewLines: h.OldLines}
+		for _, l := range h.Lines {
+			switch l.Op {
+			case diff.DELETE:
+				l.Op = diff.INSERT
+			case diff.INSERT:
+				l.Op = diff.DELETE
+			}
+			rh.Lines = append(rh.Lines, l)
+		}
+		r.Hunks = append(r.Hunks, rh)
+	}
+	return r
+}
+
+// patchPath strips the a/ or b/ prefix and any trailing timestamp from a
+// ---/+++ file name. /dev/null becomes the empty string.
+func patchPath(name string) string {
+	if i := strings.IndexByte(name, '\t'); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSpace(name)
+	if name == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(name, "a/") || strings.HasPrefix(name, "b/") {
+		name = name[2:]
+	}
+	return name
+}
+
+// parseFileMode parses the octal file mode of an extended header line, returning
+// 0 for anything but a regular file, an executable or a symbolic link
+func parseFileMode(s string) uint32 {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0
+	}
+	switch m := uint32(mode); m {
+	case storage.ModeRegular, storage.ModeExecutable, storage.ModeSymlink:
+		return m
+	}
+	return 0
+}
+
+// parsePatch parses a unified diff as produced by kitkat show, git diff or diff -u.
+// Anything before the first file header (such as email headers and a commit
+// message) is ignored, so mbox-style patches can be parsed directly.
+func parsePatch(data string) ([]filePatch, error) {
+	lines := strings.SplitAfter(data, "\n")
+	var patches []filePatch
+	var cur *filePatch
+	// inGitHeader is true between "diff --git" and the first hunk, where the
+	// extended header lines (new file mode, rename from, ...) live
+	inGitHeader := false
+
+	startFile := func() {
+		patches = append(patches, filePatch{})
+		cur = &patches[len(patches)-1]
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(strings.TrimSuffix(lines[i], "\n"), "\r")
+
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			startFile()
+			inGitHeader = true
+			// Default the paths from the header; ---/+++ or rename lines refine them
+			if fields := strings.Fields(strings.TrimPrefix(line, "diff --git ")); len(fields) == 2 {
+				cur.OldPath, cur.NewPath = patchPath(fields[0]), patchPath(fields[1])
+			}
+
+		case inGitHeader && strings.HasPrefix(line, "new file mode"):
+			cur.IsNew = true
+			cur.OldPath = ""
+			cur.NewMode = parseFileMode(strings.TrimPrefix(line, "new file mode"))
+
+		case inGitHeader && strings.HasPrefix(line, "deleted file mode"):
+			cur.IsDel = true
+			cur.NewPath = ""
+			cur.OldMode = parseFileMode(strings.TrimPrefix(line, "deleted file mode"))
+
+		case inGitHeader && strings.HasPrefix(line, "old mode "):
+			cur.OldMode = parseFileMode(strings.TrimPrefix(line, "old mode "))
+
+		case inGitHeader && strings.HasPrefix(line, "new mode "):
+			cur.NewMode = parseFileMode(strings.TrimPrefix(line, "new mode "))
+
+		case inGitHeader && strings.HasPrefix(line, "index "):
+			// "index <old>..<new> <mode>" gives the mode of a file the patch keeps
+			if fields := strings.Fields(line); len(fields) == 3 && cur.OldMode == 0 && cur.NewMode == 0 {
+				cur.OldMode = parseFileMode(fields[2])
+				cur.NewMode = cur.OldMode
+			}
+
+		case inGitHeader && strings.HasPrefix(line, "rename from "):
+			cur.OldPath = strings.TrimPrefix(line, "rename from ")
+
+		case inGitHeader && strings.HasPrefix(line, "rename to "):
+			cur.NewPath = strings.TrimPrefix(line, "rename to ")
+
+		case strings.HasPrefix(line, "Binary files ") || strings.HasPrefix(line, "GIT binary patch"):
+			return nil, fmt.Errorf("binary patches are not supported")
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if !inGitHeader {
+				startFile()
+			}
+			inGitHeader = false
+			oldPath := patchPath(strings.TrimPrefix(line, "--- "))
+			newPath := patchPath(strings.TrimPrefix(strings.TrimSuffix(lines[i+1], "\n"), "+++ "))
+			cur.OldPath, cur.NewPath = oldPath, newPath
+			cur.IsNew = oldPath == ""
+			cur.IsDel = newPath == ""
+			i++
+
+		case strings.HasPrefix(line, "@@ "):
+			if cur == nil {
+				return nil, fmt.Errorf("hunk without a file header")
+			}
+			inGitHeader = false
+			hunk, consumed, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, err
+			}
+			cur.Hunks = append(cur.Hunks, hunk)
+			i += consumed - 1
+		}
+	}
+
+	for _, p := range patches {
+		if p.OldPath == "" && p.NewPath == "" {
+			return nil, fmt.Errorf("patch with no file name")
+		}
+	}
+	return patches, nil
+}
+
+// parseHunk parses one hunk starting at its @@ header and reports how many
+// input lines it used
+func parseHunk(lines []string) (unifiedHunk, int, error) {
+	header := strings.TrimSuffix(lines[0], "\n")
+	m := hunkHeaderPattern.FindStringSubmatch(header)
+	if m == nil {
+		return unifiedHunk{}, 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+	count := func(s string) int {
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := unifiedHunk{}
+	h.OldStart, _ = strconv.Atoi(m[1])
+	h.OldLines = count(m[2])
+	h.NewStart, _ = strconv.Atoi(m[3])
+	h.NewLines = count(m[4])
+
+	oldSeen, newSeen := 0, 0
+	i := 1
+	for ; i < len(lines) && (oldSeen < h.OldLines || newSeen < h.NewLines); i++ {
+		raw := lines[i]
+		text := strings.TrimSuffix(raw, "\n")
+		if text == "" {
+			// Some mail clients strip the single space of an empty context line
+			h.Lines = append(h.Lines, unifiedLine{diff.EQUAL, "\n"})
+			oldSeen++
+			newSeen++
+			continue
+		}
+		body := raw[1:]
+		if !strings.HasSuffix(body, "\n") {
+			body += "\n"
+		}
+		switch text[0] {
+		case ' ':
+			h.Lines = append(h.Lines, unifiedLine{diff.EQUAL, body})
+			oldSeen++
+			newSeen++
+		case '-':
+			h.Lines = append(h.Lines, unifiedLine{diff.DELETE, body})
+			oldSeen++
+		case '+':
+			h.Lines = append(h.Lines, unifiedLine{diff.INSERT, body})
+			newSeen++
+		case '\\':
+			markNoNewline(&h)
+		default:
+			return unifiedHunk{}, 0, fmt.Errorf("corrupt patch line: %s", text)
+		}
+	}
+	if oldSeen != h.OldLines || newSeen != h.NewLines {
+		return unifiedHunk{}, 0, fmt.Errorf("truncated hunk: %s", header)
+	}
+
+	// A "\ No newline at end of file" marker may follow the last line
+	if i < len(lines) && strings.HasPrefix(lines[i], "\\") {
+		markNoNewline(&h)
+		i++
+	}
+	return h, i, nil
+}
+
+// markNoNewline removes the line terminator from the last line of a hunk
+func markNoNewline(h *unifiedHunk) {
+	if n := len(h.Lines); n > 0 {
+		h.Lines[n-1].Text = strings.TrimSuffix(h.Lines[n-1].Text, "\n")
+	}
+}
+
+// hunkSides returns the lines a hunk expects to find and the lines it leaves behind
+func hunkSides(lines []unifiedLine) (preimage, postimage []string) {
+	for _, l := range lines {
+		if l.Op != diff.INSERT {
+			preimage = append(preimage, l.Text)
+		}
+		if l.Op != diff.DELETE {
+			postimage = append(postimage, l.Text)
+		}
+	}
+	return preimage, postimage
+}
+
+// matchesAt reports whether want appears in lines starting at pos
+func matchesAt(lines, want []string, pos int) bool {
+	if pos < 0 || pos+len(want) > len(lines) {
+		return false
+	}
+	for i, w := range want {
+		if lines[pos+i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk searches for want at or after from, trying the expected position
+// first and then moving outwards one line at a time
+func findHunk(lines, want []string, expected, from int) (int, bool) {
+	expected = max(expected, from)
+	for delta := 0; delta <= len(lines); delta++ {
+		if matchesAt(lines, want, expected+delta) {
+			return expected + delta, true
+		}
+		if delta > 0 && expected-delta >= from && matchesAt(lines, want, expected-delta) {
+			return expected - delta, true
+		}
+	}
+	return 0, false
+}
+
+// trimContext drops up to fuzz context lines from each end of a hunk and
+// reports how many were dropped from the start
+func trimContext(lines []unifiedLine, fuzz int) ([]unifiedLine, int) {
+	leading := 0
+	for leading < fuzz && len(lines) > 0 && lines[0].Op == diff.EQUAL {
+		lines = lines[1:]
+		leading++
+	}
+	for n := 0; n < fuzz && len(lines) > 0 && lines[len(lines)-1].Op == diff.EQUAL; n++ {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, leading
+}
+
+// applyHunks applies hunks in order to content. A hunk that does not match at
+// its recorded line is searched for nearby (offset), and failing that, again with
+// up to maxFuzz context lines ignored at each end (fuzz). The notes describe every
+// hunk that did not apply exactly where it said it would.
+func applyHunks(content []byte, hunks []unifiedHunk) ([]byte, []string, error) {
+	lines := splitLinesKeepEnds(content)
+	var out []string
+	var notes []string
+	cursor := 0 // first line of the original not yet copied to out
+	offset := 0 // how far previous hunks were displaced from their recorded position
+
+	for n, h := range hunks {
+		applied := false
+		for fuzz := 0; fuzz <= maxFuzz && !applied; fuzz++ {
+			hunkLines, leading := trimContext(h.Lines, fuzz)
+			if fuzz > 0 && len(hunkLines) == len(h.Lines) {
+				// Nothing left to trim, so more fuzz cannot help
+				break
+			}
+			preimage, postimage := hunkSides(hunkLines)
+
+			expected := h.OldStart - 1 + leading + offset
+			if h.OldLines == 0 {
+				// Pure insertions are addressed by the line they follow
+				expected = h.OldStart + offset
+			}
+			pos, ok := findHunk(lines, preimage, expected, cursor)
+			if !ok {
+				continue
+			}
+
+			out = append(out, lines[cursor:pos]...)
+			out = append(out, postimage...)
+			cursor = pos + len(preimage)
+			if shift := pos - expected; shift != 0 || fuzz > 0 {
+				notes = append(notes, fmt.Sprintf("Hunk #%d succeeded at %d (offset %d lines, fuzz %d).", n+1, pos+1, shift, fuzz))
+			}
+			offset += pos - expected
+			applied = true
+		}
+		if !applied {
+			return nil, nil, fmt.Errorf("hunk #%d (@@ -%s +%s @@) does not apply", n+1,
+				hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		}
+	}
+	out = append(out, lines[cursor:]...)
+	return []byte(strings.Join(out, "")), notes, nil
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"bytes"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+const samplePatch = `From 1234 Mon Sep 17 00:00:00 2001
+Subject: [PATCH] Example
+
+diff --git a/hello.txt b/hello.txt
+--- a/hello.txt
++++ b/hello.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++fresh
+\ No newline at end of file
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/old.txt b/moved.txt
+similarity index 100%
+rename from old.txt
+rename to moved.txt
+`
+
+func TestParsePatch(t *testing.T) {
+	patches, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatalf("parsePatch() error = %v", err)
+	}
+	if len(patches) != 4 {
+		t.Fatalf("expected 4 file patches, got %d", len(patches))
+	}
+
+	if p := patches[0]; p.OldPath != "hello.txt" || p.NewPath != "hello.txt" || len(p.Hunks) != 1 || len(p.Hunks[0].Lines) != 4 {
+		t.Errorf("unexpected modification patch: %+v", p)
+	}
+	if p := patches[1]; !p.IsNew || p.OldPath != "" || p.NewPath != "new.txt" || p.Hunks[0].Lines[0].Text != "fresh" {
+		t.Errorf("unexpected new file patch: %+v", p)
+	}
+	if p := patches[2]; !p.IsDel || p.OldPath != "gone.txt" || p.NewPath != "" {
+		t.Errorf("unexpected deletion patch: %+v", p)
+	}
+	if p := patches[3]; !p.isRename() || p.OldPath != "old.txt" || p.NewPath != "moved.txt" || len(p.Hunks) != 0 {
+		t.Errorf("unexpected rename patch: %+v", p)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	patches, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := patches[0].Hunks
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Exact",
+			content: "one\ntwo\nthree\n",
+			want:    "one\nTWO\nthree\n",
+		},
+		{
+			name:    "Offset",
+			content: "zero\nzero\none\ntwo\nthree\nfour\n",
+			want:    "zero\nzero\none\nTWO\nthree\nfour\n",
+		},
+		{
+			name:    "Fuzz",
+			content: "uno\ntwo\nthree\n",
+			want:    "uno\nTWO\nthree\n",
+		},
+		{
+			name:    "Conflict",
+			content: "one\nzwei\nthree\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := applyHunks([]byte(tt.content), hunks)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyHunks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("applyHunks() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyHunksReverse(t *testing.T) {
+	patches, err := parsePatch(samplePatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, _, err := applyHunks(nil, patches[1].Hunks)
+	if err != nil || string(created) != "fresh" {
+		t.Fatalf("applying new file = %q, %v", created, err)
+	}
+
+	reversed := patches[1].reverse()
+	if !reversed.IsDel || reversed.OldPath != "new.txt" {
+		t.Errorf("reverse of a new file should delete it: %+v", reversed)
+	}
+	removed, _, err := applyHunks(created, reversed.Hunks)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("reverse apply = %q, %v", removed, err)
+	}
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	oldContent := []byte("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n")
+	newContent := []byte("a\nB\nc\nd\ne\nf\ng\nh\nI\nj\nk")
+
+	var buf bytes.Buffer
+	writeUnifiedDiff(&buf, fileChange{Path: "x", Status: 'M', Old: oldContent, New: newContent}, DiffOptions{}, false)
+
+	patches, err := parsePatch(buf.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := applyHunks(oldContent, patches[0].Hunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(newContent) {
+		t.Errorf("round trip = %q, want %q", got, newContent)
+	}
+}
+
+func TestApplyKeepsModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not kept on Windows")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	for path, perm := range map[string]os.FileMode{"tool.sh": 0755, "plain.txt": 0644} {
+		if err := os.WriteFile(path, []byte("x\n"), perm); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	patch := `diff --git a/run.sh b/run.sh
+new file mode 100755
+--- /dev/null
++++ b/run.sh
+@@ -0,0 +1 @@
++echo hi
+diff --git a/tool.sh b/bin/tool.sh
+similarity index 100%
+rename from tool.sh
+rename to bin/tool.sh
+diff --git a/plain.txt b/plain.txt
+old mode 100644
+new mode 100755
+`
+	if err := os.WriteFile("modes.patch", []byte(patch), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The working tree gets the new file's mode, the renamed file's own mode
+	// and the changed mode
+	if err := Apply("modes.patch", ApplyOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"run.sh", "bin/tool.sh", "plain.txt"} {
+		if info, err := os.Stat(path); err != nil {
+			t.Fatal(err)
+		} else if info.Mode().Perm()&0111 == 0 {
+			t.Errorf("%s is not executable: %v", path, info.Mode())
+		}
+	}
+
+	// The index is still as it was, so the patch applies to it again
+	if err := Apply("modes.patch", ApplyOptions{Cached: true}); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"run.sh", "bin/tool.sh", "plain.txt"} {
+		if entries[path].Mode != storage.ModeExecutable {
+			t.Errorf("%s is staged with mode %o", path, entries[path].Mode)
+		}
+	}
+
+	// Undoing the patch puts the old mode back
+	if err := Apply("modes.patch", ApplyOptions{Cached: true, Reverse: true}); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ = storage.LoadIndexEntries(); entries["plain.txt"].Mode != storage.ModeRegular || entries["tool.sh"].Mode != storage.ModeExecutable {
+		t.Errorf("reverse patch left plain.txt at %o and tool.sh at %o", entries["plain.txt"].Mode, entries["tool.sh"].Mode)
+	}
+}
@@ -0,0 +1,246 @@
+package core
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// workPrefix is the directory the command was started in, relative to the
+// repository root ("" at the root). It is set by IsRepoInitialized.
+var workPrefix string
+
+// Pathspec selects paths in the repository. Each pattern is one of:
+//   - a path, matching that file or everything below that directory
+//   - a glob, where * and ? also match across directories ('*.log' matches
+//     'logs/a.log') and a match on a directory selects everything below it
+//   - ":(exclude)pattern" (or ":!pattern", ":^pattern"), excluding what the
+//     pattern matches
+//   - ":(top)pattern" (or ":/pattern"), a pattern relative to the repository
+//     root rather than the current directory
+//
+// A pathspec with no patterns other than exclusions matches every path.
+type Pathspec struct {
+	include []pathPattern
+	exclude []pathPattern
+}
+
+// pathPattern is a single pattern, relative to the repository root
+type pathPattern struct {
+	arg     string         // As given on the command line
+	path    string         // Slash-separated, cleaned; "" for the whole tree
+	pattern *regexp.Regexp // Set for globs
+}
+
+// ParsePathspec builds a pathspec from command-line arguments, resolving
+// patterns against the current directory
+func ParsePathspec(args []string) (*Pathspec, error) {
+	ps := &Pathspec{}
+	for _, arg := range args {
+		spec, exclude, top, err := parsePathMagic(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		clean := filepath.ToSlash(spec)
+		if !top {
+			clean = path.Join(filepath.ToSlash(workPrefix), clean)
+		}
+		clean = path.Clean(clean)
+		if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("'%s' is outside repository", arg)
+		}
+		if clean == "." {
+			clean = ""
+		}
+		if strings.HasPrefix(clean, RepoDir+"/") || clean == RepoDir {
+			return nil, fmt.Errorf("'%s' is inside the repository database", arg)
+		}
+
+		p := pathPattern{arg: arg, path: clean}
+		if strings.ContainsAny(clean, "*?[") {
+			re, err := globToRegexp(clean)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pathspec '%s': %w", arg, err)
+			}
+			p.pattern = re
+		}
+		if exclude {
+			ps.exclude = append(ps.exclude, p)
+		} else {
+			ps.include = append(ps.include, p)
+		}
+	}
+	return ps, nil
+}
+
+// parsePathMagic splits the magic prefix off a pathspec argument
+func parsePathMagic(arg string) (spec string, exclude, top bool, err error) {
+	if !strings.HasPrefix(arg, ":") {
+		return arg, false, false, nil
+	}
+	rest := arg[1:]
+
+	// Long form: ":(exclude,top)pattern"
+	if strings.HasPrefix(rest, "(") {
+		end := strings.Index(rest, ")")
+		if end < 0 {
+			return "", false, false, fmt.Errorf("missing ')' at the end of pathspec magic in '%s'", arg)
+		}
+		for _, word := range strings.Split(rest[1:end], ",") {
+			switch strings.TrimSpace(word) {
+			case "exclude":
+				exclude = true
+			case "top":
+				top = true
+			case "":
+			default:
+				return "", false, false, fmt.Errorf("invalid pathspec magic '%s' in '%s'", word, arg)
+			}
+		}
+		return rest[end+1:], exclude, top, nil
+	}
+
+	// Short form: ":/pattern", ":!pattern", ":^pattern", optionally ended by ':'
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '/':
+			top = true
+		case '!', '^':
+			exclude = true
+		case ':':
+			return rest[1:], exclude, top, nil
+		default:
+			return rest, exclude, top, nil
+		}
+		rest = rest[1:]
+	}
+	return rest, exclude, top, nil
+}
+
+// globToRegexp compiles a glob into a regexp matching a path or any path below it
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("(/.*)?$")
+	return regexp.Compile(b.String())
+}
+
+// matches reports whether p selects the given slash-separated path
+func (p pathPattern) matches(file string) bool {
+	if p.pattern != nil {
+		return p.pattern.MatchString(file)
+	}
+	return p.path == "" || file == p.path || strings.HasPrefix(file, p.path+"/")
+}
+
+// Matches reports whether the pathspec selects path. A nil pathspec matches everything.
+func (ps *Pathspec) Matches(file string) bool {
+	if ps == nil {
+		return true
+	}
+	file = filepath.ToSlash(file)
+	for _, p := range ps.exclude {
+		if p.matches(file) {
+			return false
+		}
+	}
+	if len(ps.include) == 0 {
+		return true
+	}
+	for _, p := range ps.include {
+		if p.matches(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEmpty reports whether the pathspec has no patterns at all
+func (ps *Pathspec) IsEmpty() bool {
+	return ps == nil || len(ps.include)+len(ps.exclude) == 0
+}
+
+// names reports whether a literal pattern names path exactly, as opposed to
+// selecting it through a directory or glob
+func (ps *Pathspec) names(file string) bool {
+	if ps == nil {
+		return false
+	}
+	file = filepath.ToSlash(file)
+	for _, p := range ps.include {
+		if p.pattern == nil && p.path == file {
+			return true
+		}
+	}
+	return false
+}
+
+// directoryMatch returns the pattern, as given, through which a directory
+// selects path, or "" if path is also selected by a glob or by its own name
+func (ps *Pathspec) directoryMatch(file string) string {
+	file = filepath.ToSlash(file)
+	dir := ""
+	for _, p := range ps.include {
+		if !p.matches(file) {
+			continue
+		}
+		if p.pattern != nil || p.path == file {
+			return ""
+		}
+		dir = p.arg
+	}
+	return dir
+}
+
+// unmatched returns the include patterns, as given, that select none of paths
+func (ps *Pathspec) unmatched(paths []string) []string {
+	if ps == nil {
+		return nil
+	}
+	var missing []string
+	for _, p := range ps.include {
+		found := false
+		for _, file := range paths {
+			if p.matches(filepath.ToSlash(file)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, p.arg)
+		}
+	}
+	return missing
+}
+
+// errUnmatched returns the error for patterns that matched no files, or nil
+func (ps *Pathspec) errUnmatched(paths []string) error {
+	if missing := ps.unmatched(paths); len(missing) > 0 {
+		return fmt.Errorf("pathspec '%s' did not match any files", missing[0])
+	}
+	return nil
+}
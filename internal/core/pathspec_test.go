@@ -0,0 +1,47 @@
+package core
+
+import "testing"
+
+func TestPathspecMatches(t *testing.T) {
+	tests := []struct {
+		prefix string
+		args   []string
+		path   string
+		want   bool
+	}{
+		{"", []string{"src"}, "src/a.go", true},
+		{"", []string{"src/"}, "src/sub/b.go", true},
+		{"", []string{"src"}, "srcfile", false},
+		{"", []string{"*.log"}, "logs/x.log", true},
+		{"", []string{"*.log"}, "x.txt", false},
+		{"", []string{"logs/[a-c].log"}, "logs/b.log", true},
+		{"", []string{"*.log", ":(exclude)logs"}, "logs/x.log", false},
+		{"", []string{":!*.log"}, "README", true},
+		{"", []string{":^*.log"}, "top.log", false},
+		{"src", []string{"a.go"}, "src/a.go", true},
+		{"src", []string{"a.go"}, "a.go", false},
+		{"src", []string{":/a.go"}, "a.go", true},
+		{"src", []string{":(top)cmd"}, "cmd/main.go", true},
+		{"src", []string{"."}, "src/sub/b.go", true},
+		{"src", []string{"."}, "cmd/main.go", false},
+		{"src/sub", []string{".."}, "src/a.go", true},
+	}
+	defer func() { workPrefix = "" }()
+	for _, tt := range tests {
+		workPrefix = tt.prefix
+		ps, err := ParsePathspec(tt.args)
+		if err != nil {
+			t.Fatalf("%v: %v", tt.args, err)
+		}
+		if got := ps.Matches(tt.path); got != tt.want {
+			t.Errorf("%v in %q matching %s = %v, want %v", tt.args, tt.prefix, tt.path, got, tt.want)
+		}
+	}
+
+	workPrefix = ""
+	for _, bad := range []string{"../x", ":(nonsense)x", ".kitkat/index"} {
+		if _, err := ParsePathspec([]string{bad}); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
@@ -41,24 +41,79 @@ func getEditor() (string, []string, error) {
 	return "", nil, fmt.Errorf("no suitable editor found (checked code, nano, micro, vim)")
 }
 
+// runEditor opens path in the user's editor and waits for it to close
+func runEditor(path string) error {
+	editor, editorArgs, err := getEditor()
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(editor, append(editorArgs, path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to run editor: %w", err)
+	}
+	return nil
+}
+
+// RebaseOptions selects the commits a rebase replays and where they go
+type RebaseOptions struct {
+	Upstream    string // Commits reachable from Upstream are not replayed
+	Onto        string // Commit to replay onto; Upstream if empty
+	Branch      string // Branch to switch to first; the current HEAD if empty
+	Interactive bool   // Let the user edit the todo list before starting
+	Autosquash  bool   // Move "fixup! " and "squash! " commits after their targets
+}
+
 // RebaseInteractive starts an interactive rebase onto the specified commit
 // returns an error if any operation fails
 func RebaseInteractive(commitHash string) error {
+	return Rebase(RebaseOptions{Upstream: commitHash, Interactive: true})
+}
+
+// Rebase replays the commits of the current branch that are not reachable from
+// opts.Upstream, starting from their merge base, on top of opts.Onto
+// returns an error if any operation fails
+func Rebase(opts RebaseOptions) error {
 	if !IsRepoInitialized() {
 		return fmt.Errorf("not a kitkat repository")
 	}
+	if IsRebaseInProgress() {
+		return fmt.Errorf("a rebase is already in progress; use 'kitkat rebase --continue' or 'kitkat rebase --abort'")
+	}
 
-	isDirty, err := IsWorkDirDirty()
+	// Untracked files only matter if a replayed commit would overwrite them
+	isDirty, err := hasTrackedChanges()
 	if err != nil {
 		return fmt.Errorf("failed to check working directory status: %w", err)
 	}
 	if isDirty {
-		return fmt.Errorf("cannot rebase: you have unstaged changes")
+		return fmt.Errorf("cannot rebase: you have uncommitted changes")
 	}
 
-	ontoCommit, err := storage.FindCommit(commitHash)
+	upstream, err := ResolveRevision(opts.Upstream)
+	if err != nil {
+		return fmt.Errorf("invalid upstream '%s': %w", opts.Upstream, err)
+	}
+	onto := upstream
+	if opts.Onto != "" {
+		if onto, err = ResolveRevision(opts.Onto); err != nil {
+			return fmt.Errorf("invalid onto '%s': %w", opts.Onto, err)
+		}
+	}
+	ontoCommit, err := storage.FindCommit(onto)
 	if err != nil {
-		return fmt.Errorf("invalid base commit '%s': %w", commitHash, err)
+		return fmt.Errorf("invalid base commit '%s': %w", onto, err)
+	}
+
+	if opts.Branch != "" {
+		if !IsBranch(opts.Branch) {
+			return fmt.Errorf("no such branch: %s", opts.Branch)
+		}
+		if err := CheckoutBranch(opts.Branch, CheckoutOptions{}); err != nil {
+			return err
+		}
 	}
 
 	headState, err := GetHeadState()
@@ -74,44 +129,37 @@ func RebaseInteractive(commitHash string) error {
 		rebaseHeadNameVal = "refs/heads/" + headState
 	}
 
-	commitsToRebase, err := getCommitsBetween(ontoCommit.ID, headHash)
+	base, err := storage.FindMergeBase(upstream, headHash)
 	if err != nil {
-		return err
-	}
-	if len(commitsToRebase) == 0 {
-		fmt.Println("No commits to rebase.")
-		return nil
-	}
-
-	todoPath := filepath.Join(RepoDir, "rebase-todo")
-	todoContent := generateTodo(commitsToRebase)
-	if err := os.WriteFile(todoPath, []byte(todoContent), 0644); err != nil {
-		return err
+		return fmt.Errorf("failed to find merge base: %w", err)
 	}
-
-	editor, editorArgs, err := getEditor()
+	commitsToRebase, err := getCommitsBetween(base, headHash)
 	if err != nil {
 		return err
 	}
 
-	cmdArgs := append(editorArgs, todoPath)
-	cmd := exec.Command(editor, cmdArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	fmt.Printf("Opening editor (%s) to modify rebase todo list...\n", editor)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to run editor: %w", err)
+	// Nothing to replay and nowhere to move: the branch already sits on onto
+	if !opts.Interactive && !opts.Autosquash && (base == ontoCommit.ID || headHash == ontoCommit.ID) {
+		fmt.Printf("Current branch %s is up to date.\n", headState)
+		return nil
 	}
-
-	newTodoContent, err := os.ReadFile(todoPath)
+	steps, err := todoSteps(commitsToRebase, opts.Autosquash)
 	if err != nil {
 		return err
 	}
-	steps := parseTodo(string(newTodoContent))
-	if len(steps) == 0 {
-		fmt.Println("Nothing to do.")
-		return nil
+	if opts.Interactive {
+		if len(steps) == 0 {
+			fmt.Println("No commits to rebase.")
+			return nil
+		}
+		fmt.Println("Opening editor to modify rebase todo list...")
+		if steps, err = editTodo(steps, false); err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			fmt.Println("Nothing to do.")
+			return nil
+		}
 	}
 
 	state := RebaseState{
@@ -146,7 +194,8 @@ func RebaseInteractive(commitHash string) error {
 	return RunRebaseLoop()
 }
 
-// RebaseContinue continues the ongoing rebase process after conflicts are resolved
+// RebaseContinue continues the ongoing rebase process after conflicts are resolved,
+// or after stopping at an edit, exec or break step
 // returns an error if no rebase is in progress or if any operation fails
 func RebaseContinue() error {
 	if !IsRebaseInProgress() {
@@ -158,53 +207,164 @@ func RebaseContinue() error {
 		return err
 	}
 
-	if state.CurrentStep >= len(state.TodoSteps) {
-		return fmt.Errorf("no steps remaining")
+	switch {
+	case state.Pending != "":
+		if err := finishPendingStep(state.Pending); err != nil {
+			return err
+		}
+	case state.Amend != "":
+		if err := finishEdit(state.Amend); err != nil {
+			return err
+		}
 	}
-
-	currentCmdLine := state.TodoSteps[state.CurrentStep]
-	parts := strings.Fields(currentCmdLine)
-	cmd := parts[0]
-
-	if len(parts) < 2 {
-		return AdvanceRebaseStep(state)
+	state.Pending, state.Amend = "", ""
+	if err := SaveRebaseState(*state); err != nil {
+		return err
 	}
-	originalHash := parts[1]
-	originalCommit, _ := storage.FindCommit(originalHash)
+	return RunRebaseLoop()
+}
 
-	switch cmd {
-	case "pick", "reword":
-		msg := originalCommit.Message
-		_, _, err := Commit(msg)
+// RebaseSkip drops the changes of the step the rebase stopped at and carries on.
+// At an edit stop the commit already picked is dropped as well, unless more
+// commits have been made on top of it.
+func RebaseSkip() error {
+	if !IsRebaseInProgress() {
+		return fmt.Errorf("no rebase in progress")
+	}
+	state, err := LoadRebaseState()
+	if err != nil {
+		return err
+	}
+	head, err := readHead()
+	if err != nil {
+		return err
+	}
+	if state.Amend != "" && head == state.Amend {
+		commit, err := storage.FindCommit(head)
 		if err != nil {
-			if strings.Contains(err.Error(), "nothing to commit") {
-				fmt.Println("Nothing to commit. Skipping step.")
-			} else {
-				return err
-			}
+			return err
+		}
+		if err := Reset(commit.Parent, ResetHard); err != nil {
+			return err
 		}
+	} else if err := UpdateWorkspaceAndIndex(head); err != nil {
+		return err
+	}
+	state.Pending, state.Amend = "", ""
+	if err := SaveRebaseState(*state); err != nil {
+		return err
+	}
+	return RunRebaseLoop()
+}
 
-		if cmd == "reword" {
-			head, _ := readHead()
-			newMsg := promptForMessage(msg)
-			if newMsg != msg {
-				amendCommitMessage(head, newMsg)
-			}
+// RebaseEditTodo lets the user edit the steps of the ongoing rebase that have not run yet
+func RebaseEditTodo() error {
+	if !IsRebaseInProgress() {
+		return fmt.Errorf("no rebase in progress")
+	}
+	state, err := LoadRebaseState()
+	if err != nil {
+		return err
+	}
+	done := state.TodoSteps[:min(state.CurrentStep, len(state.TodoSteps))]
+	var remaining []string
+	for _, step := range state.TodoSteps[len(done):] {
+		if step != "" {
+			remaining = append(remaining, step)
 		}
+	}
+	steps, err := editTodo(remaining, todoPicked(done))
+	if err != nil {
+		return err
+	}
+	state.TodoSteps = append(done, steps...)
+	return SaveRebaseState(*state)
+}
 
-	case "squash":
-		prevHead, _ := GetHeadCommit()
-		newMsg := prevHead.Message + "\n\n" + originalCommit.Message
-		err := amendCommit(prevHead, newMsg)
-		if err != nil {
-			return err
+// editTodo opens the todo list in the user's editor and returns the steps it
+// holds afterwards, refusing lists with invalid steps. picked tells whether
+// steps that already ran picked a commit.
+func editTodo(steps []string, picked bool) ([]string, error) {
+	todoPath := filepath.Join(RepoDir, "rebase-todo")
+	content := strings.Join(steps, "\n") + "\n" + todoHelp
+	if err := os.WriteFile(todoPath, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+	if err := runEditor(todoPath); err != nil {
+		return nil, err
+	}
+	newTodoContent, err := os.ReadFile(todoPath)
+	if err != nil {
+		return nil, err
+	}
+	steps = parseTodo(string(newTodoContent))
+	if err := validateTodo(steps, picked); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// finishPendingStep commits the resolved changes of a step that stopped on a conflict
+func finishPendingStep(line string) error {
+	fields := strings.Fields(line)
+	flag, hash := todoCommitArgs(fields[1:])
+	originalCommit, err := storage.FindCommit(hash)
+	if err != nil {
+		return err
+	}
+
+	switch fields[0] {
+	case "pick", "p", "reword", "r", "edit", "e":
+		msg := originalCommit.Message
+		if fields[0] == "reword" || fields[0] == "r" {
+			if msg, err = promptForMessage(msg); err != nil {
+				return err
+			}
 		}
+		return commitPicked(originalCommit, msg)
+	case "squash", "s":
+		return amendSquash(hash)
+	case "fixup", "f":
+		return amendFixup(hash, flag)
 	}
+	return nil
+}
 
-	if err := AdvanceRebaseStep(state); err != nil {
+// finishEdit amends the commit an edit step stopped at with any staged changes
+func finishEdit(amend string) error {
+	staged, err := hasStagedChanges()
+	if err != nil || !staged {
 		return err
 	}
-	return RunRebaseLoop()
+	head, err := GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	if head.ID != amend {
+		return fmt.Errorf("you have staged changes; commit them, then run 'kitkat rebase --continue' again")
+	}
+	return amendCommit(head, head.Message)
+}
+
+// hasStagedChanges reports whether the index differs from the HEAD commit
+func hasStagedChanges() (bool, error) {
+	headTree, err := loadHeadTree()
+	if err != nil {
+		return false, err
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return false, err
+	}
+	if len(entries) != len(headTree) {
+		return true, nil
+	}
+	for path, entry := range entries {
+		if t, ok := headTree[path]; !ok || t.Hash != entry.Hash || t.Mode != entry.Mode {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // RebaseAbort aborts the ongoing rebase and restores the original HEAD and working directory
@@ -227,20 +387,19 @@ func RebaseAbort() error {
 		if err := os.WriteFile(filepath.Join(".kitkat", state.HeadName), []byte(state.OrigHead), 0644); err != nil {
 			return err
 		}
-		if err := UpdateWorkspaceAndIndex(state.OrigHead); err != nil {
-			return err
-		}
-	} else {
-		if err := ResetHard(state.OrigHead); err != nil {
-			return err
-		}
+	} else if err := os.WriteFile(".kitkat/HEAD", []byte(state.OrigHead), 0644); err != nil {
+		return err
+	}
+	if err := UpdateWorkspaceAndIndex(state.OrigHead); err != nil {
+		return err
 	}
 
 	os.Remove(filepath.Join(".kitkat", "refs", "heads", "kitkat-rebase-tmp"))
 	return ClearRebaseState()
 }
 
-// RunRebaseLoop processes the rebase steps in a loop until completion or conflict
+// RunRebaseLoop processes the rebase steps in a loop until completion, conflict
+// or a step that stops the rebase
 // returns an error if any operation fails
 func RunRebaseLoop() error {
 	for {
@@ -252,43 +411,137 @@ func RunRebaseLoop() error {
 			fmt.Println("Rebase completed successfully.")
 			return finishRebase(state)
 		}
-
-		parts := strings.Fields(cmdLine)
-		if len(parts) < 2 {
+		if strings.TrimSpace(cmdLine) == "" {
 			AdvanceRebaseStep(state)
 			continue
 		}
-		action := parts[0]
-		commitHash := parts[1]
 
 		fmt.Printf("Rebase (%d/%d): %s\n", state.CurrentStep+1, len(state.TodoSteps), cmdLine)
 
-		var stepErr error
-		switch action {
-		case "pick", "p":
-			stepErr = executePick(commitHash)
-		case "reword", "r":
-			stepErr = executeReword(commitHash)
-		case "squash", "s":
-			stepErr = executeSquash(commitHash)
-		case "drop", "d":
-			fmt.Printf("Dropping commit %s\n", commitHash)
-			stepErr = nil
-		default:
-			fmt.Printf("Unknown command '%s'. Skipping.\n", action)
+		// A step is done once it has started; one that stops on a conflict is
+		// kept as pending and finished by --continue
+		if err := AdvanceRebaseStep(state); err != nil {
+			return err
 		}
-
+		stop, stepErr := executeTodoStep(state, cmdLine)
 		if stepErr != nil {
-			fmt.Printf("Conflict or error at step %d: %v\n", state.CurrentStep+1, stepErr)
+			state.Pending = cmdLine
+			if err := SaveRebaseState(*state); err != nil {
+				return err
+			}
+			fmt.Printf("Conflict or error at step %d: %v\n", state.CurrentStep, stepErr)
 			fmt.Println("Resolve conflicts, then run 'kitkat rebase --continue'.")
+			fmt.Println("To skip this commit, run 'kitkat rebase --skip'.")
 			fmt.Println("To stop, run 'kitkat rebase --abort'.")
 			return nil
 		}
+		if stop {
+			return nil
+		}
+	}
+}
 
-		if err := AdvanceRebaseStep(state); err != nil {
-			return err
+// executeTodoStep runs a single step of the todo list and reports whether the
+// rebase should stop after it
+func executeTodoStep(state *RebaseState, line string) (bool, error) {
+	fields := strings.Fields(line)
+	action, args := fields[0], fields[1:]
+	flag, commitHash := todoCommitArgs(args)
+
+	switch action {
+	case "pick", "p":
+		return false, executePick(commitHash)
+	case "reword", "r":
+		return false, executeReword(commitHash)
+	case "edit", "e":
+		if err := executePick(commitHash); err != nil {
+			return false, err
 		}
+		return true, stopForEdit(state)
+	case "squash", "s":
+		return false, executeSquash(commitHash)
+	case "fixup", "f":
+		return false, executeFixup(commitHash, flag)
+	case "exec", "x":
+		command := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), action))
+		return !executeExec(command), nil
+	case "break", "b":
+		fmt.Println("Stopped. Run 'kitkat rebase --continue' to resume.")
+		return true, nil
+	case "label", "l":
+		return false, saveRebaseLabel(args[0])
+	case "reset", "t":
+		return false, resetToRebaseLabel(args[0])
+	case "drop", "d":
+		fmt.Printf("Dropping commit %s\n", commitHash)
+	default:
+		fmt.Printf("Unknown command '%s'. Skipping.\n", action)
+	}
+	return false, nil
+}
+
+// stopForEdit stops the rebase at the commit just picked so it can be amended
+func stopForEdit(state *RebaseState) error {
+	head, err := readHead()
+	if err != nil {
+		return err
+	}
+	state.Amend = head
+	if err := SaveRebaseState(*state); err != nil {
+		return err
+	}
+	fmt.Printf("Stopped at %s\n", head[:7])
+	fmt.Print("You can amend the commit now, with\n\n  kitkat commit --amend\n\n")
+	fmt.Println("Once you are satisfied with your changes, run\n\n  kitkat rebase --continue")
+	return nil
+}
+
+// executeExec runs a shell command from the todo list and reports whether it succeeded
+func executeExec(command string) bool {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, command)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("Execution failed: %s\n", command)
+		fmt.Println("You can fix the problem, and then run\n\n  kitkat rebase --continue")
+		return false
+	}
+	return true
+}
+
+// rebaseLabelPath is where a label step records a commit
+func rebaseLabelPath(name string) string {
+	return filepath.Join(RepoDir, "rebase-merge", "labels", name)
+}
+
+// saveRebaseLabel records the current HEAD under name for later reset steps
+func saveRebaseLabel(name string) error {
+	head, err := readHead()
+	if err != nil {
+		return err
 	}
+	path := rebaseLabelPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(head), 0644)
+}
+
+// resetToRebaseLabel moves HEAD, the index and working tree to a label, or to
+// a commit if no label has that name
+func resetToRebaseLabel(name string) error {
+	target := name
+	if data, err := os.ReadFile(rebaseLabelPath(name)); err == nil {
+		target = strings.TrimSpace(string(data))
+	} else if _, err := ResolveRevision(name); err != nil {
+		return fmt.Errorf("unknown label '%s'", name)
+	}
+	return Reset(target, ResetHard)
 }
 
 // finishRebase finalizes the rebase by updating HEAD and cleaning up temporary state
@@ -307,6 +560,9 @@ func finishRebase(state *RebaseState) error {
 		if err := os.WriteFile(refPath, []byte(headHash), 0644); err != nil {
 			return err
 		}
+	} else if err := os.WriteFile(".kitkat/HEAD", []byte(headHash), 0644); err != nil {
+		// A detached rebase ends detached at the new tip
+		return err
 	}
 
 	os.Remove(filepath.Join(".kitkat", "refs", "heads", "kitkat-rebase-tmp"))
@@ -322,12 +578,18 @@ func executePick(hash string) error {
 // executeReword applies the changes from the commit with the given hash onto the current HEAD
 // and prompts the user to edit the commit message
 func executeReword(hash string) error {
-	if err := cherryPick(hash, false); err != nil {
+	if err := cherryPick(hash, true); err != nil {
+		return err
+	}
+	commit, err := storage.FindCommit(hash)
+	if err != nil {
+		return err
+	}
+	message, err := promptForMessage(commit.Message)
+	if err != nil {
 		return err
 	}
-	head, _ := GetHeadCommit()
-	newMsg := promptForMessage(head.Message)
-	return amendCommitMessage(head.ID, newMsg)
+	return commitPicked(commit, message)
 }
 
 // executeSquash applies the changes from the commit with the given hash onto the current HEAD
@@ -336,12 +598,55 @@ func executeSquash(hash string) error {
 	if err := cherryPick(hash, true); err != nil {
 		return err
 	}
-	prevHead, _ := GetHeadCommit()
-	targetCommit, _ := storage.FindCommit(hash)
+	return amendSquash(hash)
+}
+
+// amendSquash amends the previous commit with the staged changes and both messages
+func amendSquash(hash string) error {
+	prevHead, err := GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	targetCommit, err := storage.FindCommit(hash)
+	if err != nil {
+		return err
+	}
 	newMsg := prevHead.Message + "\n\n" + targetCommit.Message
 	return amendCommit(prevHead, newMsg)
 }
 
+// executeFixup applies the changes from the commit with the given hash onto the current HEAD
+// and amends the previous commit, keeping its message unless flag is -C or -c
+func executeFixup(hash, flag string) error {
+	if err := cherryPick(hash, true); err != nil {
+		return err
+	}
+	return amendFixup(hash, flag)
+}
+
+// amendFixup amends the previous commit with the staged changes. With -C the
+// message of the fixup commit replaces the previous one; -c also opens the editor.
+func amendFixup(hash, flag string) error {
+	prevHead, err := GetHeadCommit()
+	if err != nil {
+		return err
+	}
+	newMsg := prevHead.Message
+	if flag != "" {
+		targetCommit, err := storage.FindCommit(hash)
+		if err != nil {
+			return err
+		}
+		newMsg = targetCommit.Message
+		if flag == "-c" {
+			if newMsg, err = promptForMessage(newMsg); err != nil {
+				return err
+			}
+		}
+	}
+	return amendCommit(prevHead, newMsg)
+}
+
 // cherryPick applies the changes from the commit with the given hash onto the current HEAD
 // if noCommit is true, it applies the changes without creating a new commit
 // returns an error if any conflicts are detected
@@ -361,26 +666,47 @@ func cherryPick(hash string, noCommit bool) error {
 	if noCommit {
 		return nil
 	}
-	_, _, err = Commit(commit.Message)
+	return commitPicked(commit, commit.Message)
+}
+
+// commitPicked commits the index on top of HEAD as a copy of original with the
+// given message, keeping the original author and date. A step that turns out
+// to change nothing is skipped.
+func commitPicked(original models.Commit, message string) error {
+	_, _, err := createCommit(rewriteOptions(original, message, false))
 	if err != nil && strings.Contains(err.Error(), "nothing to commit") {
+		fmt.Println("Nothing to commit. Skipping step.")
 		return nil
 	}
 	return err
 }
 
+// rewriteOptions returns the options that recreate original with a new
+// message. The author is kept, while the committer is whoever rewrites it.
+func rewriteOptions(original models.Commit, message string, amend bool) commitOptions {
+	return commitOptions{
+		Message:     message,
+		AuthorName:  original.AuthorName,
+		AuthorEmail: original.AuthorEmail,
+		Timestamp:   original.Timestamp,
+		Amend:       amend,
+	}
+}
+
 type Change struct {
 	OldHash string
 	NewHash string
+	NewMode uint32
 }
 
 // getChanges computes the changes between parentHash and childHash
 // returns a map of file paths to their old and new hashes
 func getChanges(parentHash, childHash string) (map[string]Change, error) {
-	parentTree := make(map[string]string)
+	parentTree := make(map[string]storage.TreeEntry)
 	if parentHash != "" {
 		pC, err := storage.FindCommit(parentHash)
 		if err == nil {
-			parentTree, _ = storage.ParseTree(pC.TreeHash)
+			parentTree, _ = storage.ParseTreeEntries(pC.TreeHash)
 		}
 	}
 
@@ -388,20 +714,20 @@ func getChanges(parentHash, childHash string) (map[string]Change, error) {
 	if err != nil {
 		return nil, err
 	}
-	childTree, err := storage.ParseTree(childCommit.TreeHash)
+	childTree, err := storage.ParseTreeEntries(childCommit.TreeHash)
 	if err != nil {
 		return nil, err
 	}
 
 	changes := make(map[string]Change)
-	for path, hash := range childTree {
-		if pHash, ok := parentTree[path]; !ok || pHash != hash {
-			changes[path] = Change{OldHash: parentTree[path], NewHash: hash}
+	for path, entry := range childTree {
+		if pEntry, ok := parentTree[path]; !ok || pEntry != entry {
+			changes[path] = Change{OldHash: parentTree[path].Hash, NewHash: entry.Hash, NewMode: entry.Mode}
 		}
 	}
 	for path := range parentTree {
 		if _, ok := childTree[path]; !ok {
-			changes[path] = Change{OldHash: parentTree[path], NewHash: ""}
+			changes[path] = Change{OldHash: parentTree[path].Hash, NewHash: ""}
 		}
 	}
 	return changes, nil
@@ -424,10 +750,6 @@ func applyChanges(changes map[string]Change) error {
 				return err
 			}
 		} else {
-			content, err := storage.ReadObject(targetHash)
-			if err != nil {
-				return err
-			}
 			headFileHash, existsInHead := headTree[path]
 			if existsInHead {
 				if headFileHash != change.OldHash {
@@ -437,10 +759,7 @@ func applyChanges(changes map[string]Change) error {
 				return fmt.Errorf("conflict in %s: modified in incoming commit, but deleted in HEAD", path)
 			}
 
-			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-				return err
-			}
-			if err := os.WriteFile(path, content, 0644); err != nil {
+			if err := writeWorkFile(path, storage.TreeEntry{Hash: targetHash, Mode: change.NewMode}); err != nil {
 				return err
 			}
 			if err := AddFile(path); err != nil {
@@ -451,21 +770,6 @@ func applyChanges(changes map[string]Change) error {
 	return nil
 }
 
-// generateTodo generates the initial todo content for the given commit hashes
-func generateTodo(hashes []string) string {
-	var sb strings.Builder
-	for _, h := range hashes {
-		c, _ := storage.FindCommit(h)
-		sb.WriteString(fmt.Sprintf("pick %s %s\n", h, c.Message))
-	}
-	sb.WriteString("\n# Commands:\n")
-	sb.WriteString("# p, pick <commit> = use commit\n")
-	sb.WriteString("# r, reword <commit> = use commit, but edit the commit message\n")
-	sb.WriteString("# s, squash <commit> = use commit, but meld into previous commit\n")
-	sb.WriteString("# d, drop <commit> = remove commit\n")
-	return sb.String()
-}
-
 // parseTodo parses the todo content and returns a list of steps
 // ignores comments and empty lines
 func parseTodo(content string) []string {
@@ -495,12 +799,6 @@ func getCommitsBetween(start, end string) ([]string, error) {
 		if err != nil {
 			return nil, err
 		}
-		if c.Parent == "" {
-			if start == "" {
-				return chain, nil
-			}
-			break
-		}
 		curr = c.Parent
 	}
 	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
@@ -509,65 +807,25 @@ func getCommitsBetween(start, end string) ([]string, error) {
 	return chain, nil
 }
 
-// promptForMessage opens the user's editor to edit the commit message, starting with defaultMsg
-// and returns the edited message
-func promptForMessage(defaultMsg string) string {
-	tmp := ".kitkat/COMMIT_EDITMSG"
-	os.WriteFile(tmp, []byte(defaultMsg), 0644)
-
-	editor, editorArgs, err := getEditor()
+// promptForMessage lets the user edit a commit message in their editor,
+// starting with defaultMsg, the way commit does: comment lines are removed and
+// a failed editor or an empty message stops the step
+func promptForMessage(defaultMsg string) (string, error) {
+	message, err := editCommitMessage(defaultMsg)
 	if err != nil {
-		fmt.Printf("Warning: %v. Using default message.\n", err)
-		return defaultMsg
-	}
-
-	cmdArgs := append(editorArgs, tmp)
-	cmd := exec.Command(editor, cmdArgs...)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Run()
-
-	out, _ := os.ReadFile(tmp)
-	return strings.TrimSpace(string(out))
-}
-
-// amendCommitMessage creates a new commit with the same tree and parent as commitID but with newVal
-// and updates the current branch to point to it
-func amendCommitMessage(commitID, newVal string) error {
-	c, err := storage.FindCommit(commitID)
-	if err != nil {
-		return err
-	}
-	parentBlock := ""
-	if c.Parent != "" {
-		parentBlock = "parent " + c.Parent + "\n"
+		return "", err
 	}
-	content := fmt.Sprintf("tree %s\n%s\n%s", c.TreeHash, parentBlock, newVal)
-	newHash, err := saveObject([]byte(content))
-	if err != nil {
-		return err
+	if message == "" {
+		return "", errEmptyMessage
 	}
-	return UpdateBranchPointer(newHash)
+	return message, nil
 }
 
-// amendCommit creates a new commit with the same tree and parent as prevHead but with newMsg
-// and updates the current branch to point to it
+// amendCommit replaces prevHead, the current HEAD, with a commit of the index
+// and newMsg that keeps the author of prevHead
 func amendCommit(prevHead models.Commit, newMsg string) error {
-	treeHash, err := storage.CreateTree()
-	if err != nil {
-		return err
-	}
-	parentBlock := ""
-	if prevHead.Parent != "" {
-		parentBlock = "parent " + prevHead.Parent + "\n"
-	}
-	content := fmt.Sprintf("tree %s\n%s\n%s", treeHash, parentBlock, newMsg)
-	newHash, err := saveObject([]byte(content))
-	if err != nil {
-		return err
-	}
-	return UpdateBranchPointer(newHash)
+	_, _, err := createCommit(rewriteOptions(prevHead, newMsg, true))
+	return err
 }
 
 // saveObject saves the given content as an object and returns its hash
@@ -16,6 +16,8 @@ type RebaseState struct {
 	TodoSteps   []string // List of commands
 	CurrentStep int      // Index in TodoSteps (0-based)
 	Message     string   // For squash/reword message accumulation
+	Pending     string   // Step stopped by a conflict, finished by --continue
+	Amend       string   // Commit an edit step stopped at
 }
 
 func EnsureRebaseDir() error {
@@ -35,6 +37,8 @@ func SaveRebaseState(state RebaseState) error {
 	os.WriteFile(filepath.Join(base, "git-rebase-todo"), []byte(strings.Join(state.TodoSteps, "\n")), 0644)
 	os.WriteFile(filepath.Join(base, "msgnum"), []byte(fmt.Sprintf("%d", state.CurrentStep+1)), 0644)
 	os.WriteFile(filepath.Join(base, "message"), []byte(state.Message), 0644) // Optional
+	os.WriteFile(filepath.Join(base, "pending"), []byte(state.Pending), 0644)
+	os.WriteFile(filepath.Join(base, "amend"), []byte(state.Amend), 0644)
 
 	return nil
 }
@@ -51,6 +55,8 @@ func LoadRebaseState() (*RebaseState, error) {
 	todoData, _ := os.ReadFile(filepath.Join(base, "git-rebase-todo"))
 	msgNumData, _ := os.ReadFile(filepath.Join(base, "msgnum"))
 	message, _ := os.ReadFile(filepath.Join(base, "message"))
+	pending, _ := os.ReadFile(filepath.Join(base, "pending"))
+	amend, _ := os.ReadFile(filepath.Join(base, "amend"))
 
 	step, _ := strconv.Atoi(strings.TrimSpace(string(msgNumData)))
 	// step is 1-based in file, 0-based in struct
@@ -65,6 +71,8 @@ func LoadRebaseState() (*RebaseState, error) {
 		TodoSteps:   strings.Split(strings.TrimSpace(string(todoData)), "\n"),
 		CurrentStep: step,
 		Message:     string(message),
+		Pending:     strings.TrimSpace(string(pending)),
+		Amend:       strings.TrimSpace(string(amend)),
 	}, nil
 }
 
@@ -0,0 +1,424 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestRebaseOntoUpstream(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile := func(path, content, message string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	messages := func() []string {
+		t.Helper()
+		head, err := readHead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain, err := getCommitsBetween("", head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, id := range chain {
+			c, err := ResolveCommit(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result = append(result, c.Message)
+		}
+		return result
+	}
+	assertMessages := func(want ...string) {
+		t.Helper()
+		got := messages()
+		if len(got) != len(want) {
+			t.Fatalf("history is %q, want %q", got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("history is %q, want %q", got, want)
+			}
+		}
+	}
+
+	commitFile("a.txt", "base\n", "base")
+	if err := SwitchNewBranch("feature", "", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("f.txt", "f\n", "add f")
+	commitFile("g.txt", "g\n", "add g")
+	if err := SwitchBranch("main", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	commitFile("a.txt", "main\n", "main change")
+
+	// rebase <upstream> <branch> switches to the branch and replays it
+	if err := Rebase(RebaseOptions{Upstream: "main", Branch: "feature"}); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := GetHeadState(); state != "feature" {
+		t.Fatalf("HEAD is %s, want feature", state)
+	}
+	assertMessages("base", "main change", "add f", "add g")
+	if content, _ := os.ReadFile("a.txt"); string(content) != "main\n" {
+		t.Errorf("a.txt is %q after rebase", content)
+	}
+
+	// --onto moves only the commits after upstream
+	if err := Rebase(RebaseOptions{Upstream: "HEAD~1", Onto: "HEAD~3"}); err != nil {
+		t.Fatal(err)
+	}
+	assertMessages("base", "add g")
+	if _, err := os.Stat("f.txt"); !os.IsNotExist(err) {
+		t.Error("f.txt survived a rebase that dropped its commit")
+	}
+}
+
+func TestRebaseFixupKeepsAuthor(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	commitAs := func(author, content, message string) models.Commit {
+		t.Helper()
+		if err := os.WriteFile("f.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		c, _, err := createCommit(commitOptions{
+			Message:     message,
+			AuthorName:  author,
+			AuthorEmail: author + "@example.com",
+			Timestamp:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	base := commitAs("Ada", "base\n", "base")
+	commitAs("Ada", "one\n", "change f")
+	commitAs("Bob", "two\n", "fixup! change f")
+
+	if err := Rebase(RebaseOptions{Upstream: base.ID, Autosquash: true}); err != nil {
+		t.Fatal(err)
+	}
+	head, err := GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The result must be a real commit that can be looked up again
+	found, err := storage.FindCommit(head.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found.Parent != base.ID || found.Message != "change f" {
+		t.Errorf("got %q on %s, want %q on %s", found.Message, found.Parent, "change f", base.ID)
+	}
+	if found.AuthorName != "Ada" || !found.Timestamp.Equal(base.Timestamp) {
+		t.Errorf("author is %s at %v, want Ada at %v", found.AuthorName, found.Timestamp, base.Timestamp)
+	}
+	if found.CommitterName == "" || found.CommitTime.IsZero() {
+		t.Error("rewritten commit has no committer")
+	}
+	if tree, _ := storage.ParseTree(found.TreeHash); tree["f.txt"] == "" {
+		t.Error("fixed up commit lost f.txt")
+	}
+	if content, _ := os.ReadFile("f.txt"); string(content) != "two\n" {
+		t.Errorf("f.txt is %q after fixup", content)
+	}
+}
+
+func TestRebaseTodoCommands(t *testing.T) {
+	// None of these steps may need an editor
+	t.Setenv("EDITOR", "")
+	os.Unsetenv("EDITOR")
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+
+	var base, a, b, c string
+	setup := func() {
+		t.Helper()
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if err := InitRepo(); err != nil {
+			t.Fatal(err)
+		}
+		commitFile := func(path, content, message string) string {
+			t.Helper()
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := AddFile(path); err != nil {
+				t.Fatal(err)
+			}
+			commit, _, err := Commit(message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return commit.ID
+		}
+		base = commitFile("f.txt", "base\n", "base")
+		a = commitFile("f.txt", "a\n", "change f")
+		b = commitFile("g.txt", "b\n", "add g")
+		c = commitFile("f.txt", "c\n", "change f again")
+	}
+	// run replays steps onto base the way Rebase does once the todo is known
+	run := func(steps ...string) {
+		t.Helper()
+		head, err := readHead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Reset(base, ResetHard); err != nil {
+			t.Fatal(err)
+		}
+		state := RebaseState{HeadName: "refs/heads/main", Onto: base, OrigHead: head, TodoSteps: steps}
+		if err := SaveRebaseState(state); err != nil {
+			t.Fatal(err)
+		}
+		if err := RunRebaseLoop(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history := func() string {
+		t.Helper()
+		head, err := readHead()
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain, err := getCommitsBetween(base, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var messages []string
+		for _, id := range chain {
+			commit, err := storage.FindCommit(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages = append(messages, commit.Message)
+		}
+		return strings.Join(messages, ", ")
+	}
+	expect := func(stopped bool, want string) {
+		t.Helper()
+		if IsRebaseInProgress() != stopped {
+			t.Fatalf("rebase in progress is %v, want %v", !stopped, stopped)
+		}
+		if got := history(); got != want {
+			t.Fatalf("history is %q, want %q", got, want)
+		}
+	}
+	expectFile := func(path, want string) {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		if want == "" {
+			if !os.IsNotExist(err) {
+				t.Fatalf("%s exists with %q", path, content)
+			}
+			return
+		}
+		if string(content) != want {
+			t.Fatalf("%s is %q, want %q", path, content, want)
+		}
+	}
+
+	t.Run("edit stops and continue amends", func(t *testing.T) {
+		setup()
+		run("edit "+a, "pick "+b)
+		expect(true, "change f")
+		if err := os.WriteFile("f.txt", []byte("edited\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err := RebaseContinue(); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, "change f, add g")
+		head, _ := GetHeadCommit()
+		edited, _ := storage.FindCommit(head.Parent)
+		if tree, _ := storage.ParseTree(edited.TreeHash); tree["f.txt"] == "" {
+			t.Fatal("edited commit lost f.txt")
+		} else if content, _ := storage.ReadObject(tree["f.txt"]); string(content) != "edited\n" {
+			t.Errorf("edited commit has f.txt %q", content)
+		}
+	})
+
+	t.Run("exec stops on failure and resumes", func(t *testing.T) {
+		setup()
+		run("pick "+a, "exec true", "exec false", "pick "+b)
+		expect(true, "change f")
+		if err := RebaseContinue(); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, "change f, add g")
+	})
+
+	t.Run("break stops", func(t *testing.T) {
+		setup()
+		run("pick "+a, "break", "pick "+b)
+		expect(true, "change f")
+		expectFile("g.txt", "")
+		if err := RebaseContinue(); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, "change f, add g")
+		expectFile("g.txt", "b\n")
+	})
+
+	t.Run("fixup -C takes the message", func(t *testing.T) {
+		setup()
+		run("pick "+a, "fixup -C "+b)
+		expect(false, "add g")
+		expectFile("f.txt", "a\n")
+		expectFile("g.txt", "b\n")
+	})
+
+	t.Run("label and reset", func(t *testing.T) {
+		setup()
+		run("label start", "pick "+a, "label changed", "reset start", "pick "+b, "reset changed")
+		expect(false, "change f")
+		expectFile("f.txt", "a\n")
+		expectFile("g.txt", "")
+	})
+
+	t.Run("skip drops a conflicted step", func(t *testing.T) {
+		setup()
+		run("pick "+c, "pick "+b)
+		expect(true, "")
+		if err := RebaseSkip(); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, "add g")
+		expectFile("f.txt", "base\n")
+	})
+
+	t.Run("skip at an edit drops the commit", func(t *testing.T) {
+		setup()
+		run("edit "+a, "pick "+b)
+		expect(true, "change f")
+		if err := RebaseSkip(); err != nil {
+			t.Fatal(err)
+		}
+		expect(false, "add g")
+		expectFile("f.txt", "base\n")
+	})
+}
+
+func TestRebaseRewordUsesCommitEditor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("editor scripts need a POSIX shell")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	scripts := t.TempDir()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	editor := func(name, body string) {
+		t.Helper()
+		path := filepath.Join(scripts, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("EDITOR", path)
+	}
+
+	var ids []string
+	for _, message := range []string{"base", "change f"} {
+		if err := os.WriteFile("f.txt", []byte(message+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		commit, _, err := Commit(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, commit.ID)
+	}
+	if err := Reset(ids[0], ResetHard); err != nil {
+		t.Fatal(err)
+	}
+	state := RebaseState{HeadName: "refs/heads/main", Onto: ids[0], OrigHead: ids[1], TodoSteps: []string{"reword " + ids[1]}}
+	if err := SaveRebaseState(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// An empty message stops the step rather than committing
+	editor("empty", `: > "$1"`)
+	if err := RunRebaseLoop(); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := readHead(); !IsRebaseInProgress() || head != ids[0] {
+		t.Fatalf("empty reword message was committed; HEAD is %s", head)
+	}
+
+	// Comments are stripped from the message when the step is continued
+	editor("reword", `printf 'reworded\n# a comment\n' > "$1"`)
+	if err := RebaseContinue(); err != nil {
+		t.Fatal(err)
+	}
+	head, err := GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsRebaseInProgress() || head.Parent != ids[0] || head.Message != "reworded" {
+		t.Errorf("got %q on %s, want %q on %s", head.Message, head.Parent, "reworded", ids[0])
+	}
+}
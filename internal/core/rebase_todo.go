@@ -0,0 +1,193 @@
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// todoHelp is appended to the todo list the user edits
+const todoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup [-C | -c] <commit> = like "squash" but keep only the previous
+#                    commit's message, unless -C is used, in which case
+#                    keep only this commit's message; -c is the same as -C
+#                    but opens the editor
+# x, exec <command> = run command (the rest of the line) using shell
+# b, break = stop here (continue rebase later with 'kitkat rebase --continue')
+# d, drop <commit> = remove commit
+# l, label <label> = label current HEAD with a name
+# t, reset <label> = reset HEAD to a label
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+# If you remove everything, the rebase will do nothing.
+`
+
+// autosquashPrefixes are the subject prefixes --autosquash recognises, with
+// the command each one turns into
+var autosquashPrefixes = []struct{ prefix, action string }{
+	{"fixup! ", "fixup"},
+	{"squash! ", "squash"},
+	{"amend! ", "fixup -C"},
+}
+
+// todoSteps returns a pick step for each commit. With autosquash, commits whose
+// subject starts with "fixup! ", "squash! " or "amend! " are moved right after
+// the commit they name, by subject or hash prefix, and fixed up into it.
+func todoSteps(hashes []string, autosquash bool) ([]string, error) {
+	type todoCommit struct{ id, subject string }
+	commits := make([]todoCommit, len(hashes))
+	for i, h := range hashes {
+		c, err := storage.FindCommit(h)
+		if err != nil {
+			return nil, err
+		}
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		commits[i] = todoCommit{c.ID, subject}
+	}
+
+	attached := make(map[int][]string)
+	moved := make([]bool, len(commits))
+	if autosquash {
+		for j, c := range commits {
+			action, target, ok := autosquashTarget(c.subject)
+			if !ok {
+				continue
+			}
+			for i := 0; i < j; i++ {
+				if moved[i] {
+					continue
+				}
+				if commits[i].subject == target || (len(target) >= 4 && strings.HasPrefix(commits[i].id, target)) {
+					attached[i] = append(attached[i], fmt.Sprintf("%s %s %s", action, c.id, c.subject))
+					moved[j] = true
+					break
+				}
+			}
+		}
+	}
+
+	var steps []string
+	for i, c := range commits {
+		if moved[i] {
+			continue
+		}
+		steps = append(steps, fmt.Sprintf("pick %s %s", c.id, c.subject))
+		steps = append(steps, attached[i]...)
+	}
+	return steps, nil
+}
+
+// autosquashTarget returns the command for a "fixup! " style subject and the
+// subject it refers to, after any further prefixes
+func autosquashTarget(subject string) (action, target string, ok bool) {
+	for {
+		found := false
+		for _, p := range autosquashPrefixes {
+			if strings.HasPrefix(subject, p.prefix) {
+				if action == "" {
+					action = p.action
+				}
+				subject = strings.TrimPrefix(subject, p.prefix)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return action, subject, action != ""
+		}
+	}
+}
+
+// todoCommitArgs splits the arguments of a commit step into its fixup flag
+// ("-C", "-c" or "") and the commit
+func todoCommitArgs(args []string) (flag, commit string) {
+	if len(args) > 0 && (args[0] == "-C" || args[0] == "-c") {
+		flag, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		commit = args[0]
+	}
+	return flag, commit
+}
+
+// validateTodo checks every step of a todo list before any of it runs. picked
+// tells whether steps of the rebase that already ran picked a commit, which a
+// squash or fixup needs to fold into.
+func validateTodo(steps []string, picked bool) error {
+	for _, line := range steps {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		action, args := fields[0], fields[1:]
+		switch action {
+		case "pick", "p", "reword", "r", "edit", "e", "squash", "s", "drop", "d", "fixup", "f":
+			flag, commit := todoCommitArgs(args)
+			if flag != "" && action != "fixup" && action != "f" {
+				return fmt.Errorf("invalid todo line %q: %s is only valid with fixup", line, flag)
+			}
+			if commit == "" {
+				return fmt.Errorf("invalid todo line %q: missing commit", line)
+			}
+			if _, err := storage.FindCommit(commit); err != nil {
+				return fmt.Errorf("invalid todo line %q: %w", line, err)
+			}
+			if isFoldStep(action) && !picked {
+				return fmt.Errorf("cannot '%s' without a previous commit", todoActionName(action))
+			}
+			picked = picked || (action != "drop" && action != "d")
+		case "exec", "x":
+			if len(args) == 0 {
+				return fmt.Errorf("invalid todo line %q: missing command", line)
+			}
+		case "label", "l", "reset", "t":
+			if len(args) != 1 || args[0] != filepath.Base(args[0]) || strings.HasPrefix(args[0], ".") {
+				return fmt.Errorf("invalid todo line %q: expected a single label name", line)
+			}
+		case "break", "b":
+		default:
+			return fmt.Errorf("invalid todo line %q: unknown command '%s'", line, action)
+		}
+	}
+	return nil
+}
+
+// isFoldStep reports whether a todo action folds its commit into the previous one
+func isFoldStep(action string) bool {
+	switch action {
+	case "squash", "s", "fixup", "f":
+		return true
+	}
+	return false
+}
+
+// todoActionName returns the full name of a todo action that may be abbreviated
+func todoActionName(action string) string {
+	switch action {
+	case "s":
+		return "squash"
+	case "f":
+		return "fixup"
+	}
+	return action
+}
+
+// todoPicked reports whether any of steps picks a commit
+func todoPicked(steps []string) bool {
+	for _, line := range steps {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			switch fields[0] {
+			case "pick", "p", "reword", "r", "edit", "e", "squash", "s", "fixup", "f":
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,86 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTodoStepsAutosquash(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for i, message := range []string{"add a", "add b", "fixup! add a", "squash! add b", "amend! fixup! add a"} {
+		if err := os.WriteFile("file.txt", []byte{byte('0' + i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("file.txt"); err != nil {
+			t.Fatal(err)
+		}
+		commit, _, err := Commit(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, commit.ID)
+	}
+
+	steps, err := todoSteps(ids, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, step := range steps {
+		fields := strings.Fields(step)
+		action, id := fields[0], fields[1]
+		if action == "fixup" && id == "-C" {
+			action, id = "fixup -C", fields[2]
+		}
+		for i := range ids {
+			if ids[i] == id {
+				got = append(got, action+" "+string(rune('0'+i)))
+			}
+		}
+	}
+	want := []string{"pick 0", "fixup 2", "fixup -C 4", "pick 1", "squash 3"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("todo is %q, want %q", got, want)
+	}
+	if err := validateTodo(steps, false); err != nil {
+		t.Errorf("generated todo is invalid: %v", err)
+	}
+
+	for _, line := range []string{"pick", "frobnicate " + ids[0], "squash -C " + ids[0], "label a/b", "exec",
+		"squash " + ids[0], "fixup " + ids[0], "f -C " + ids[0]} {
+		if err := validateTodo([]string{line}, false); err == nil {
+			t.Errorf("todo line %q was accepted", line)
+		}
+	}
+	for _, line := range []string{"break", "exec make test", "label onto", "reset onto", "fixup -c " + ids[1]} {
+		if err := validateTodo([]string{line}, true); err != nil {
+			t.Errorf("todo line %q was rejected: %v", line, err)
+		}
+	}
+
+	// A squash or fixup needs a commit picked before it, in the list or
+	// by the steps that already ran
+	err = validateTodo([]string{"drop " + ids[0], "squash " + ids[1]}, false)
+	if err == nil || err.Error() != "cannot 'squash' without a previous commit" {
+		t.Errorf("squash after a drop gave %v", err)
+	}
+	if err := validateTodo([]string{"reword " + ids[0], "squash " + ids[1], "fixup " + ids[2]}, false); err != nil {
+		t.Errorf("squash after a pick was rejected: %v", err)
+	}
+	if err := validateTodo([]string{"exec true", "fixup " + ids[1]}, true); err != nil {
+		t.Errorf("fixup after earlier picks was rejected: %v", err)
+	}
+}
@@ -3,30 +3,21 @@ package core
 import (
 	"fmt"
 	"os"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
 func RemoveFile(filename string) error {
-	index, err := LoadIndex()
-	if err != nil {
-		return fmt.Errorf("failed to load index: %w", err)
-	}
-
-	found := false
-	newIndex := []IndexEntry{}
-	for _, entry := range index {
-		if entry.Path == filename {
-			found = true
-			continue
+	err := storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		if _, found := entries[filename]; !found {
+			return fmt.Errorf("pathspec '%s' did not match any files", filename)
 		}
-		newIndex = append(newIndex, entry)
-	}
-
-	if !found {
-		return fmt.Errorf("pathspec '%s' did not match any files", filename)
-	}
-
-	if err := SaveIndex(newIndex); err != nil {
-		return fmt.Errorf("failed to save index: %w", err)
+		delete(entries, filename)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
 	if err := os.Remove(filename); err != nil {
@@ -35,6 +26,52 @@ func RemoveFile(filename string) error {
 			return err
 		}
 	}
+	removeEmptyParents(filename)
 
 	return nil
 }
+
+// RemovePaths removes every tracked file a pathspec selects from the index and
+// the working directory, and returns their paths. Files are only removed through
+// a directory pattern if recursive is set. Nothing is removed if a pattern
+// matches no tracked file.
+func RemovePaths(ps *Pathspec, recursive bool) ([]string, error) {
+	var removed []string
+	err := storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		paths := make([]string, 0, len(entries))
+		for path := range entries {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		if err := ps.errUnmatched(paths); err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			if !ps.Matches(path) {
+				continue
+			}
+			if !recursive {
+				if dir := ps.directoryMatch(path); dir != "" {
+					return fmt.Errorf("not removing '%s' recursively without -r", dir)
+				}
+			}
+			removed = append(removed, path)
+		}
+		for _, path := range removed {
+			delete(entries, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range removed {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removeEmptyParents(path)
+	}
+	return removed, nil
+}
@@ -6,39 +6,140 @@ import (
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
-// ResetHard moves the current branch (or HEAD in detached state) to the specified commit
-// and forcibly updates the working directory and index to match that commit.
-// WARNING: This is a destructive operation that discards all uncommitted changes.
-func ResetHard(commitHash string) error {
-	// Step 1: Validate that the commit exists
-	commit, err := storage.FindCommit(commitHash)
+// ResetMode selects how much of the repository a reset moves
+type ResetMode int
+
+const (
+	ResetSoft  ResetMode = iota // Move the branch only
+	ResetMixed                  // Move the branch and reset the index (the default)
+	ResetHard                   // Move the branch and reset the index and working tree
+)
+
+// Reset moves the current branch (or HEAD in detached state) to the commit rev
+// names, and resets the index and working tree as mode asks
+func Reset(rev string, mode ResetMode) error {
+	if IsCheckoutInterrupted() {
+		return errInterruptedCheckout
+	}
+	commit, err := ResolveCommit(rev)
+	if err != nil {
+		return fmt.Errorf("fatal: invalid commit: %s", rev)
+	}
+	update, err := branchPointerUpdate(commit.ID)
 	if err != nil {
-		if err == storage.ErrNoCommits {
-			return fmt.Errorf("fatal: invalid commit: %s", commitHash)
+		return fmt.Errorf("fatal: %w", err)
+	}
+
+	switch mode {
+	case ResetHard:
+		// Workspace, index and branch pointer are updated together.
+		// If any of it fails, all of it is rolled back.
+		if err := checkoutTree(commit.ID, CheckoutOptions{Force: true}, "reset", update); err != nil {
+			return fmt.Errorf("failed to update workspace: %w", err)
+		}
+		fmt.Printf("HEAD is now at %s %s\n", commit.ID[:7], CommitSubject(commit.Message))
+		return nil
+	case ResetMixed:
+		tree, err := storage.ParseTreeEntries(commit.TreeHash)
+		if err != nil {
+			return err
+		}
+		if err := resetIndex(tree, nil); err != nil {
+			return err
 		}
-		return fmt.Errorf("fatal: invalid commit: %s", commitHash)
 	}
 
-	// Step 2: Save current HEAD for potential rollback
-	oldHeadCommit, err := readHead()
-	if err != nil {
-		return fmt.Errorf("fatal: unable to read HEAD file: %w", err)
+	if err := SafeWrite(update.Path, []byte(update.New), 0644); err != nil {
+		return fmt.Errorf("failed to update %s: %w", update.Path, err)
 	}
+	if mode == ResetMixed {
+		return printUnstaged()
+	}
+	return nil
+}
 
-	// Step 3: Update the branch pointer or HEAD
-	if err := UpdateBranchPointer(commitHash); err != nil {
+// ResetPaths resets the index entries of the paths a pathspec selects to their
+// state in the commit rev names (HEAD if empty), leaving the branch and the
+// working tree alone. Paths missing from the commit are removed from the index.
+func ResetPaths(rev string, ps *Pathspec) error {
+	tree, err := revisionTree(rev)
+	if err != nil {
+		return err
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
 		return err
 	}
+	var paths []string
+	for path := range tree {
+		paths = append(paths, path)
+	}
+	for path := range entries {
+		if _, ok := tree[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	if err := ps.errUnmatched(paths); err != nil {
+		return err
+	}
+	if err := resetIndex(tree, ps); err != nil {
+		return err
+	}
+	return printUnstaged()
+}
 
-	// Step 4: Update workspace and index to match the target commit
-	// If this fails, attempt to roll back the branch pointer
-	if err := UpdateWorkspaceAndIndex(commitHash); err != nil {
-		// Attempt rollback
-		_ = UpdateBranchPointer(oldHeadCommit)
-		return fmt.Errorf("failed to update workspace: %w", err)
+// revisionTree returns the tree of the commit rev names, or of HEAD if rev is
+// empty. An unborn HEAD has an empty tree.
+func revisionTree(rev string) (map[string]storage.TreeEntry, error) {
+	if rev == "" || rev == "HEAD" {
+		return loadHeadTree()
 	}
+	commit, err := ResolveCommit(rev)
+	if err != nil {
+		return nil, err
+	}
+	return storage.ParseTreeEntries(commit.TreeHash)
+}
+
+// resetIndex makes the index entries the pathspec selects match tree. Entries
+// that do not change keep their stat data so the files are not re-hashed.
+func resetIndex(tree map[string]storage.TreeEntry, ps *Pathspec) error {
+	return storage.UpdateIndex(func(entries map[string]storage.IndexEntry) error {
+		for path := range entries {
+			if _, ok := tree[path]; !ok && ps.Matches(path) {
+				delete(entries, path)
+			}
+		}
+		for path, t := range tree {
+			if !ps.Matches(path) {
+				continue
+			}
+			if e, ok := entries[path]; ok && e.Hash == t.Hash && e.Mode == t.Mode {
+				continue
+			}
+			entries[path] = storage.IndexEntry{Path: path, Hash: t.Hash, Mode: t.Mode}
+		}
+		return nil
+	})
+}
 
-	// Step 5: Success - print confirmation message
-	fmt.Printf("HEAD is now at %s %s\n", commitHash[:7], commit.Message)
+// printUnstaged lists the tracked files that differ from the index, the way
+// git does after a reset
+func printUnstaged() error {
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+	changes, err := workdirChanges(entries)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	fmt.Println("Unstaged changes after reset:")
+	for _, c := range changes {
+		fmt.Printf("%c\t%s\n", c.Status, c.Path)
+	}
 	return nil
 }
@@ -0,0 +1,95 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestResetModes(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	commitFile := func(content, message string) {
+		t.Helper()
+		if err := os.WriteFile("a.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexHash := func(path string) string {
+		t.Helper()
+		index, err := storage.LoadIndex()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index[path]
+	}
+
+	commitFile("one\n", "one")
+	first, err := GetHeadCommit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstHash := indexHash("a.txt")
+	commitFile("two\n", "two")
+	secondHash := indexHash("a.txt")
+
+	// --soft moves the branch only
+	if err := Reset("HEAD~1", ResetSoft); err != nil {
+		t.Fatal(err)
+	}
+	if head, _ := GetHeadCommit(); head.ID != first.ID {
+		t.Fatalf("HEAD is %s, want %s", head.ID, first.ID)
+	}
+	if indexHash("a.txt") != secondHash {
+		t.Error("soft reset changed the index")
+	}
+
+	// --mixed resets the index but keeps the working file
+	if err := Reset("HEAD", ResetMixed); err != nil {
+		t.Fatal(err)
+	}
+	if indexHash("a.txt") != firstHash {
+		t.Error("mixed reset did not reset the index")
+	}
+	if content, _ := os.ReadFile("a.txt"); string(content) != "two\n" {
+		t.Errorf("mixed reset changed the working file to %q", content)
+	}
+
+	// A path reset unstages a new file without touching it
+	if err := os.WriteFile("b.txt", []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	ps, err := ParsePathspec([]string{"b.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ResetPaths("", ps); err != nil {
+		t.Fatal(err)
+	}
+	if indexHash("b.txt") != "" {
+		t.Error("b.txt is still staged")
+	}
+	if _, err := os.Stat("b.txt"); err != nil {
+		t.Errorf("b.txt was removed: %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// RestoreOptions selects where restored files come from and what is updated
+type RestoreOptions struct {
+	Source   string // Commit to restore from; the index for the working tree, HEAD for the index
+	Staged   bool   // Restore the index
+	Worktree bool   // Restore the working tree (the default when Staged is not set)
+}
+
+// Restore puts the files a pathspec selects back to their state in a source,
+// overwriting local changes. Tracked files the source does not have are
+// removed (from the index with Staged, from the working tree with Worktree).
+func Restore(ps *Pathspec, opts RestoreOptions) error {
+	if IsCheckoutInterrupted() {
+		return errInterruptedCheckout
+	}
+	if !opts.Staged {
+		opts.Worktree = true
+	}
+	entries, err := storage.LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+
+	var source map[string]storage.TreeEntry
+	if opts.Source == "" && !opts.Staged {
+		source = make(map[string]storage.TreeEntry, len(entries))
+		for path, entry := range entries {
+			source[path] = storage.TreeEntry{Hash: entry.Hash, Mode: entry.Mode}
+		}
+	} else {
+		source, err = revisionTree(opts.Source)
+		if err != nil {
+			return fmt.Errorf("invalid source: %s", opts.Source)
+		}
+	}
+
+	// Every path in the source or the index may be restored
+	var paths []string
+	for path := range source {
+		paths = append(paths, path)
+	}
+	for path := range entries {
+		if _, ok := source[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	if err := ps.errUnmatched(paths); err != nil {
+		return err
+	}
+
+	if opts.Staged {
+		if err := resetIndex(source, ps); err != nil {
+			return err
+		}
+	}
+	if !opts.Worktree {
+		return nil
+	}
+	for _, path := range paths {
+		if !ps.Matches(path) {
+			continue
+		}
+		entry, ok := source[path]
+		if !ok {
+			if err := os.Remove(path); err == nil {
+				removeEmptyParents(path)
+			} else if !isMissing(err) {
+				return err
+			}
+			continue
+		}
+		var indexEntry *storage.IndexEntry
+		if e, ok := entries[path]; ok {
+			indexEntry = &e
+		}
+		same, err := worktreeMatches(path, entry, true, indexEntry)
+		if err != nil {
+			return err
+		}
+		if same {
+			continue
+		}
+		if err := writeWorkFile(path, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
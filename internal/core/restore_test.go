@@ -0,0 +1,96 @@
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+func TestRestoreAndSwitch(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile("a.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	commit := func(content, message string) {
+		t.Helper()
+		write(content)
+		if err := AddFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := Commit(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assertFile := func(want string) {
+		t.Helper()
+		if content, _ := os.ReadFile("a.txt"); string(content) != want {
+			t.Errorf("a.txt is %q, want %q", content, want)
+		}
+	}
+	ps, err := ParsePathspec([]string{"a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commit("one\n", "one")
+	commit("two\n", "two")
+
+	// From an older commit, into the working tree only
+	if err := Restore(ps, RestoreOptions{Source: "HEAD~1"}); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("one\n")
+
+	// Staged changes are unstaged without touching the file
+	if err := AddFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(ps, RestoreOptions{Staged: true}); err != nil {
+		t.Fatal(err)
+	}
+	head, _ := GetHeadCommit()
+	tree, _ := storage.ParseTreeEntries(head.TreeHash)
+	if index, _ := storage.LoadIndex(); index["a.txt"] != tree["a.txt"].Hash {
+		t.Error("restore --staged did not reset the index entry")
+	}
+	assertFile("one\n")
+
+	// And the working tree comes back from the index
+	if err := Restore(ps, RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("two\n")
+
+	// switch -c creates the branch at the start point and checks it out
+	if err := SwitchNewBranch("old", "HEAD~1", CheckoutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	assertFile("one\n")
+	if err := SwitchBranch("HEAD~1", CheckoutOptions{}); err == nil {
+		t.Error("switching to a commit without --detach succeeded")
+	}
+
+	// A failed switch does not leave the new branch behind
+	write("local\n")
+	if err := SwitchNewBranch("blocked", "main", CheckoutOptions{}); err == nil {
+		t.Fatal("switch over local changes succeeded")
+	}
+	if IsBranch("blocked") {
+		t.Error("branch was created by a failed switch")
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+	"github.com/LeeFred3042U/kitcat/internal/storage"
+)
+
+// ResolveRevision turns a revision expression into a full commit ID.
+// Supported forms are HEAD (or @), branch names, tag names (annotated tags are
+// peeled to their commit), full refs such as refs/heads/main, full or short
+// commit hashes, and any of these followed by ^ (parent), ~<n> (n-th ancestor)
+// or ^{} (the commit a tag points to).
+func ResolveRevision(rev string) (string, error) {
+	if rev == "" {
+		return "", fmt.Errorf("empty revision")
+	}
+
+	base, suffix := rev, ""
+	if i := strings.IndexAny(rev, "^~"); i >= 0 {
+		base, suffix = rev[:i], rev[i:]
+	}
+	if base == "" {
+		return "", fmt.Errorf("invalid revision '%s'", rev)
+	}
+
+	id, err := resolveRevisionBase(base)
+	if err != nil {
+		return "", err
+	}
+
+	// Walk the ^, ~<n> and ^{} suffixes from left to right
+	for suffix != "" {
+		// Tags are peeled when the base is resolved, so ^{} has nothing left to do
+		if rest, ok := strings.CutPrefix(suffix, "^{}"); ok {
+			suffix = rest
+			continue
+		}
+		op := suffix[0]
+		if op != '^' && op != '~' {
+			return "", fmt.Errorf("invalid revision '%s'", rev)
+		}
+		suffix = suffix[1:]
+		digits := 0
+		for digits < len(suffix) && suffix[digits] >= '0' && suffix[digits] <= '9' {
+			digits++
+		}
+		count := 1
+		if digits > 0 {
+			count, _ = strconv.Atoi(suffix[:digits])
+			suffix = suffix[digits:]
+		}
+		// Commits have a single parent, so ^<n> only makes sense for n <= 1
+		if op == '^' && count > 1 {
+			return "", fmt.Errorf("revision '%s' has no parent %d", rev, count)
+		}
+		for ; count > 0; count-- {
+			commit, err := storage.FindCommit(id)
+			if err != nil {
+				return "", err
+			}
+			if commit.Parent == "" {
+				return "", fmt.Errorf("revision '%s' goes past the root commit", rev)
+			}
+			id = commit.Parent
+		}
+	}
+	return id, nil
+}
+
+// ResolveCommit resolves a revision expression and loads the commit it names
+func ResolveCommit(rev string) (models.Commit, error) {
+	id, err := ResolveRevision(rev)
+	if err != nil {
+		return models.Commit{}, err
+	}
+	return storage.FindCommit(id)
+}
+
+// resolveRevisionBase resolves a revision without ^ or ~ suffixes
+func resolveRevisionBase(name string) (string, error) {
+	if name == "HEAD" || name == "@" {
+		id, err := readHead()
+		if err != nil || id == "" {
+			return "", fmt.Errorf("HEAD does not point to a commit yet")
+		}
+		return id, nil
+	}
+
+	// Refs are looked up before hashes so that a branch named like a hash prefix wins
+	refCandidates := []string{
+		filepath.Join(HeadsDir, name),
+		filepath.Join(TagsDir, name),
+	}
+	if strings.HasPrefix(name, "refs/") {
+		refCandidates = []string{filepath.Join(RepoDir, name)}
+	}
+	for _, refPath := range refCandidates {
+		data, err := os.ReadFile(refPath)
+		if err != nil {
+			continue
+		}
+		id := strings.TrimSpace(string(data))
+		if id == "" {
+			return "", fmt.Errorf("ref '%s' does not point to a commit yet", name)
+		}
+		return peelTag(id)
+	}
+
+	commit, err := storage.FindCommit(name)
+	if err != nil {
+		if err == storage.ErrNoCommits {
+			return "", fmt.Errorf("unknown revision '%s'", name)
+		}
+		return "", fmt.Errorf("unknown revision '%s': %w", name, err)
+	}
+	return commit.ID, nil
+}
+
+// peelTag follows annotated tag objects until it reaches a commit ID.
+// IDs that are not tag objects are returned unchanged.
+func peelTag(id string) (string, error) {
+	for {
+		data, err := storage.ReadObject(id)
+		if err != nil {
+			return id, nil
+		}
+		tag, ok := parseTagObject(data)
+		if !ok {
+			return id, nil
+		}
+		id = tag.Object
+	}
+}
+
+// resolveRange turns "A..B", or "A" meaning "A..HEAD", into the commits reachable
+// from B but not from A, oldest first. An empty side of ".." means HEAD.
+func resolveRange(spec string) ([]string, error) {
+	from, to := spec, "HEAD"
+	if i := strings.Index(spec, ".."); i >= 0 {
+		from, to = spec[:i], spec[i+2:]
+		if from == "" {
+			from = "HEAD"
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+	}
+
+	fromID, err := ResolveRevision(from)
+	if err != nil {
+		return nil, err
+	}
+	toID, err := ResolveRevision(to)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commits on both sides are excluded, so walk back only to the merge base
+	base, err := storage.FindMergeBase(fromID, toID)
+	if err != nil {
+		base = ""
+	}
+	return getCommitsBetween(base, toID)
+}
@@ -0,0 +1,146 @@
+package core
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// revisionHistory creates three commits of f.txt in a new repository, with an
+// annotated tag v1 on the second and f.txt changed again in the index. It
+// returns the commit IDs, oldest first.
+func revisionHistory(t *testing.T) []string {
+	t.Helper()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitRepo(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir("d", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("d/g.txt", []byte("g\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddFile("d/g.txt"); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, content := range []string{"1\n", "2\n", "3\n", "4\n"} {
+		if err := os.WriteFile("f.txt", []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := AddFile("f.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if content == "4\n" {
+			break
+		}
+		commit, _, err := Commit("commit " + strings.TrimSpace(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, commit.ID)
+	}
+	if err := CreateAnnotatedTag("v1", ids[1], "release one"); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestResolveRevision(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	ids := revisionHistory(t)
+
+	tests := []struct {
+		rev  string
+		want string // "" for an error
+	}{
+		{"HEAD", ids[2]},
+		{"@", ids[2]},
+		{"main", ids[2]},
+		{"refs/heads/main", ids[2]},
+		{"HEAD^", ids[1]},
+		{"HEAD^^", ids[0]},
+		{"HEAD~2", ids[0]},
+		{"HEAD~1^", ids[0]},
+		{"HEAD~0", ids[2]},
+		{"v1", ids[1]},
+		{"refs/tags/v1", ids[1]},
+		{"v1^{}", ids[1]},
+		{"v1^{}~1", ids[0]},
+		{"v1^", ids[0]},
+		{ids[2][:7], ids[2]},
+		{ids[1][:10] + "^", ids[0]},
+		{ids[0], ids[0]},
+		{"HEAD~3", ""},
+		{"HEAD^2", ""},
+		{"HEAD^{tree}", ""},
+		{"^", ""},
+		{"", ""},
+		{"nope", ""},
+	}
+	for _, tt := range tests {
+		got, err := ResolveRevision(tt.rev)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ResolveRevision(%q) = %s, want an error", tt.rev, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveRevision(%q) = %s, %v; want %s", tt.rev, got, err, tt.want)
+		}
+	}
+}
+
+func TestShow(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	ids := revisionHistory(t)
+
+	tests := []struct {
+		arg     string
+		want    []string // Parts of the output, in order
+		notWant string
+	}{
+		{arg: "HEAD:f.txt", want: []string{"3\n"}},
+		{arg: "v1:f.txt", want: []string{"2\n"}},
+		{arg: ids[0][:7] + ":f.txt", want: []string{"1\n"}},
+		{arg: ":f.txt", want: []string{"4\n"}},
+		{arg: "HEAD~2:d", want: []string{"tree HEAD~2:d\n\ng.txt\n"}},
+		{arg: "HEAD:.", want: []string{"d/\nf.txt\n"}},
+		{arg: "HEAD", want: []string{"commit " + ids[2], "commit 3", "-2\n+3\n"}},
+		{arg: "v1", want: []string{"tag v1\n", "release one", "commit " + ids[1], "-1\n+2\n"}},
+		{arg: "v1^{}", want: []string{"commit " + ids[1]}, notWant: "tag v1"},
+	}
+	for _, tt := range tests {
+		out := captureStdout(t, func() error { return Show(tt.arg, DiffOptions{}) })
+		rest := out
+		for _, want := range tt.want {
+			i := strings.Index(rest, want)
+			if i < 0 {
+				t.Errorf("show %s is missing %q:\n%s", tt.arg, want, out)
+				break
+			}
+			rest = rest[i+len(want):]
+		}
+		if tt.notWant != "" && strings.Contains(out, tt.notWant) {
+			t.Errorf("show %s has %q:\n%s", tt.arg, tt.notWant, out)
+		}
+	}
+
+	for _, arg := range []string{"HEAD:missing.txt", "v2", "HEAD~5:f.txt"} {
+		if err := Show(arg, DiffOptions{}); err == nil {
+			t.Errorf("show %s succeeded", arg)
+		}
+	}
+}
@@ -2,10 +2,22 @@ package core
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+var (
+	// objectHashPattern matches a full object hash
+	objectHashPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	// treeLinePattern matches one "[mode ]hash path" line of a tree object
+	treeLinePattern = regexp.MustCompile(`^(?:[0-7]{6} )?[0-9a-f]{40} .+$`)
+)
+
 // Displays the contents of a kitkat object
 func ShowObject(hash string) error {
 	data, err := storage.ReadObject(hash)
@@ -15,3 +27,152 @@ func ShowObject(hash string) error {
 	fmt.Println(string(data))
 	return nil
 }
+
+// Show prints an object in human-readable form: a commit is shown with its
+// header and its diff against its parent, an annotated tag with its message
+// followed by the tagged commit, a tree as a list of paths and a blob as-is.
+// A "<rev>:<path>" argument prints the file at path as of rev, and ":<path>"
+// prints the version of the file staged in the index.
+func Show(arg string, opts DiffOptions) error {
+	if rev, path, ok := strings.Cut(arg, ":"); ok {
+		return showPath(rev, path)
+	}
+
+	// Annotated tags are shown before the commit they point to
+	if data, err := os.ReadFile(filepath.Join(TagsDir, arg)); err == nil {
+		if tagData, err := storage.ReadObject(strings.TrimSpace(string(data))); err == nil {
+			if tag, ok := parseTagObject(tagData); ok {
+				printTag(tag)
+			}
+		}
+	}
+
+	commit, resolveErr := ResolveCommit(arg)
+	if resolveErr == nil {
+		printCommitHeader(commit, "medium")
+		return printCommitChanges(commit, opts, nil)
+	}
+
+	// Anything that is not a commit must be the full hash of a stored object
+	if !objectHashPattern.MatchString(arg) {
+		return resolveErr
+	}
+	data, err := storage.ReadObject(arg)
+	if err != nil {
+		return fmt.Errorf("unknown revision or object '%s'", arg)
+	}
+	if tag, ok := parseTagObject(data); ok {
+		printTag(tag)
+		return Show(tag.Object, opts)
+	}
+	if isTreeObject(data) {
+		tree, err := storage.ParseTree(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("tree %s\n\n", arg)
+		printTreePaths(tree, "")
+		return nil
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// showPath prints a file, or the list of files below a directory, as of a
+// revision. An empty revision reads from the index instead of a commit.
+func showPath(rev, path string) error {
+	path = filepath.ToSlash(filepath.Clean(path))
+
+	var tree map[string]string
+	if rev == "" {
+		index, err := storage.LoadIndex()
+		if err != nil {
+			return err
+		}
+		tree = index
+	} else {
+		commit, err := ResolveCommit(rev)
+		if err != nil {
+			return err
+		}
+		tree, err = storage.ParseTree(commit.TreeHash)
+		if err != nil {
+			return err
+		}
+	}
+
+	if hash, ok := tree[path]; ok {
+		content, err := storage.ReadObject(hash)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+
+	// Not a file: treat the path as a directory and list what is below it
+	prefix := path + "/"
+	if path == "." {
+		prefix = ""
+	}
+	found := false
+	for p := range tree {
+		if strings.HasPrefix(p, prefix) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("path '%s' does not exist in '%s'", path, rev)
+	}
+	fmt.Printf("tree %s:%s\n\n", rev, path)
+	printTreePaths(tree, prefix)
+	return nil
+}
+
+// printTreePaths lists the direct children of prefix in a flat tree,
+// printing subdirectories once with a trailing slash
+func printTreePaths(tree map[string]string, prefix string) {
+	seen := make(map[string]bool)
+	var names []string
+	for p := range tree {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		name := strings.TrimPrefix(p, prefix)
+		if dir, _, isDir := strings.Cut(name, "/"); isDir {
+			name = dir + "/"
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+// printTag prints the header and message of an annotated tag
+func printTag(tag tagObject) {
+	fmt.Printf("tag %s\n", tag.Name)
+	fmt.Printf("Tagger: %s\n", tag.Tagger)
+	fmt.Printf("Date:   %s\n", tag.Time.Format("Mon Jan 02 15:04:05 2006 -0700"))
+	fmt.Printf("\n%s\n\n", tag.Message)
+}
+
+// isTreeObject reports whether an object's content looks like a tree,
+// i.e. every line is "hash path"
+func isTreeObject(data []byte) bool {
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return false
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if !treeLinePattern.MatchString(line) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,48 +2,69 @@ package core
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/LeeFred3042U/kitcat/internal/storage"
 )
 
+// statusReport is the state of the working directory and index relative to
+// HEAD, each change already formatted as a status line
+type statusReport struct {
+	Branch    string
+	Staged    []string
+	Unstaged  []string
+	Untracked []string
+}
+
 // Status compares the state of the working directory, index, and last commit,
-// then prints a summary of the changes
-func Status() error {
-	// Print the current branch status at the top
-	headState, err := GetHeadState()
+// then prints a summary of the changes to the paths a pathspec selects.
+// A nil pathspec selects every path.
+func Status(ps *Pathspec) error {
+	report, err := collectStatus(ps)
 	if err != nil {
-		headState = "no commits yet"
+		return err
 	}
-	fmt.Printf("On branch %s\n", headState)
+	report.write(os.Stdout, "")
+	return nil
+}
 
-	// Load the tree from the commit that HEAD points to
-	// Note: We use GetHeadCommit() instead of storage.GetLastCommit() because
+// collectStatus gathers the changes Status reports for the paths a pathspec selects
+func collectStatus(ps *Pathspec) (statusReport, error) {
+	// Note: We use the HEAD tree instead of storage.GetLastCommit() because
 	// after a reset, HEAD might point to an earlier commit than the last in the log
-	headTree := make(map[string]string)
-	headCommit, err := GetHeadCommit()
-	if err == nil {
-		tree, parseErr := storage.ParseTree(headCommit.TreeHash)
-		if parseErr != nil {
-			return parseErr
-		}
-		headTree = tree
-	} else if err != storage.ErrNoCommits {
-		return err
+	headTree, err := loadHeadTree()
+	if err != nil {
+		return statusReport{}, err
 	}
 
 	// Load the current staging area
-	index, err := storage.LoadIndex()
+	entries, err := storage.LoadIndexEntries()
 	if err != nil {
-		return err
+		return statusReport{}, err
 	}
+	return collectStatusOf(ps, headTree, entries)
+}
+
+// collectStatusOf gathers the changes between base, the index entries and the
+// working directory. The entries need not be the ones saved on disk, so a
+// commit can be previewed without staging anything.
+func collectStatusOf(ps *Pathspec, headTree map[string]storage.TreeEntry, entries map[string]storage.IndexEntry) (statusReport, error) {
+	var report statusReport
+	headState, err := GetHeadState()
+	if err != nil {
+		headState = "no commits yet"
+	}
+	report.Branch = headState
+	index := storage.IndexHashes(entries)
 
 	// Load ignore patterns
 	ignorePatterns, err := LoadIgnorePatterns()
 	if err != nil {
-		return err
+		return report, err
 	}
 
 	// Prepare slices to hold the categorized changes
@@ -51,30 +72,37 @@ func Status() error {
 	unstagedChanges := []string{}
 	untrackedFiles := []string{}
 
-	// Create a set of all file paths from both HEAD and the index for a complete comparison
-	allPaths := make(map[string]bool)
+	// Create a sorted list of all file paths from both HEAD and the index for a complete comparison
+	var allPaths []string
 	for path := range headTree {
-		allPaths[path] = true
+		allPaths = append(allPaths, path)
 	}
 	for path := range index {
-		allPaths[path] = true
+		if _, ok := headTree[path]; !ok {
+			allPaths = append(allPaths, path)
+		}
 	}
+	sort.Strings(allPaths)
 
 	// Categorize Staged Changes (Index vs. HEAD)
-	for path := range allPaths {
-		headHash, inHead := headTree[path]
-		indexHash, inIndex := index[path]
+	for _, path := range allPaths {
+		if !ps.Matches(path) {
+			continue
+		}
+		headEntry, inHead := headTree[path]
+		indexEntry, inIndex := entries[path]
 
 		if inIndex && !inHead {
 			stagedChanges = append(stagedChanges, fmt.Sprintf("new file:  %s", path))
 		} else if !inIndex && inHead {
 			stagedChanges = append(stagedChanges, fmt.Sprintf("deleted:   %s", path))
-		} else if inIndex && inHead && headHash != indexHash {
-			stagedChanges = append(stagedChanges, fmt.Sprintf("modified:  %s", path))
+		} else if inIndex && inHead && (headEntry.Hash != indexEntry.Hash || headEntry.Mode != indexEntry.Mode) {
+			stagedChanges = append(stagedChanges, fmt.Sprintf("modified:  %s%s", path, modeChange(headEntry.Mode, indexEntry.Mode)))
 		}
 	}
 
 	// Categorize Unstaged & Untracked Changes (Working Directory vs. Index)
+	var tracked []trackedFile
 	err = filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -85,8 +113,11 @@ func Status() error {
 		if info.IsDir() || strings.HasPrefix(cleanPath, RepoDir+string(os.PathSeparator)) || cleanPath == RepoDir {
 			return nil
 		}
+		if !ps.Matches(cleanPath) {
+			return nil
+		}
 
-		indexHash, isTracked := index[cleanPath]
+		entry, isTracked := entries[cleanPath]
 
 		// If the file is not in the index, it's untracked
 		if !isTracked {
@@ -97,34 +128,60 @@ func Status() error {
 			untrackedFiles = append(untrackedFiles, cleanPath)
 			return nil
 		}
-
-		// If the file is tracked, hash it and compare with the index to see if it's been modified
-		currentHash, hashErr := storage.HashFile(cleanPath)
-		if hashErr != nil {
-			return hashErr
-		}
-		if currentHash != indexHash {
-			unstagedChanges = append(unstagedChanges, fmt.Sprintf("modified:  %s", cleanPath))
-		}
+		tracked = append(tracked, trackedFile{Path: cleanPath, Info: info, Entry: entry})
 		return nil
 	})
 	if err != nil {
-		return err
+		return report, err
 	}
 
-	// Print Final Summary
-	fmt.Println("\nChanges to be committed:")
-	for _, change := range stagedChanges {
-		fmt.Printf("\t%s\n", change)
-	}
-	fmt.Println("\nChanges not staged for commit:")
-	for _, change := range unstagedChanges {
-		fmt.Printf("\t%s\n", change)
+	// If the file is tracked, compare it with the index to see if it's been modified.
+	// Files whose stat data still matches the index are not re-hashed.
+	changed, err := checkTrackedFiles(tracked)
+	if err != nil {
+		return report, err
 	}
-	fmt.Println("\nUntracked files:")
-	for _, file := range untrackedFiles {
-		fmt.Printf("\t%s\n", file)
+	for i, file := range tracked {
+		if changed[i] {
+			mode := modeChange(file.Entry.Mode, storage.ModeFromFileInfo(file.Info))
+			unstagedChanges = append(unstagedChanges, fmt.Sprintf("modified:  %s%s", file.Path, mode))
+		}
 	}
 
-	return nil
+	report.Staged = stagedChanges
+	report.Unstaged = unstagedChanges
+	report.Untracked = untrackedFiles
+	return report, nil
+}
+
+// write prints the report with every line starting with prefix, which is how
+// it is shown as comments in a commit message
+func (r statusReport) write(w io.Writer, prefix string) {
+	mark := strings.TrimRight(prefix, " ")
+	line := func(text string) {
+		switch {
+		case prefix == "":
+		case text == "" || strings.HasPrefix(text, "\t"):
+			text = mark + text
+		default:
+			text = prefix + text
+		}
+		fmt.Fprintln(w, text)
+	}
+	line("On branch " + r.Branch)
+	sections := []struct {
+		title string
+		items []string
+	}{
+		{"Changes to be committed:", r.Staged},
+		{"Changes not staged for commit:", r.Unstaged},
+		{"Untracked files:", r.Untracked},
+	}
+	for _, section := range sections {
+		line("")
+		line(section.title)
+		for _, item := range section.items {
+			line("\t" + item)
+		}
+	}
 }
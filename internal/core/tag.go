@@ -5,6 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const tagsDir = ".kitkat/refs/tags"
@@ -36,6 +39,111 @@ func CreateTag(tagName, commitID string) error {
 	return nil
 }
 
+// tagObject is an annotated tag as stored in the object database
+type tagObject struct {
+	Object  string    // ID of the tagged commit
+	Name    string    // Tag name
+	Tagger  string    // "Name <email>" of whoever created the tag
+	Time    time.Time // When the tag was created
+	Message string
+}
+
+// encode serializes the tag object in a git-like text format
+func (t tagObject) encode() []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "object %s\n", t.Object)
+	sb.WriteString("type commit\n")
+	fmt.Fprintf(&sb, "tag %s\n", t.Name)
+	fmt.Fprintf(&sb, "tagger %s %d %s\n", t.Tagger, t.Time.Unix(), t.Time.Format("-0700"))
+	sb.WriteString("\n")
+	sb.WriteString(t.Message)
+	if !strings.HasSuffix(t.Message, "\n") {
+		sb.WriteString("\n")
+	}
+	return []byte(sb.String())
+}
+
+// parseTagObject parses the content of an annotated tag object.
+// It returns false when the data is not a tag object.
+func parseTagObject(data []byte) (tagObject, bool) {
+	header, message, _ := strings.Cut(string(data), "\n\n")
+	if !strings.HasPrefix(header, "object ") {
+		return tagObject{}, false
+	}
+
+	var t tagObject
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "object":
+			t.Object = value
+		case "tag":
+			t.Name = value
+		case "tagger":
+			// "Name <email> <unix> <zone>"
+			fields := strings.Fields(value)
+			if len(fields) >= 2 {
+				if unix, err := strconv.ParseInt(fields[len(fields)-2], 10, 64); err == nil {
+					t.Time = time.Unix(unix, 0)
+					if zone, err := time.Parse("-0700", fields[len(fields)-1]); err == nil {
+						t.Time = t.Time.In(zone.Location())
+					}
+					value = strings.Join(fields[:len(fields)-2], " ")
+				}
+			}
+			t.Tagger = value
+		}
+	}
+	if t.Object == "" || t.Name == "" {
+		return tagObject{}, false
+	}
+	t.Message = strings.TrimSuffix(message, "\n")
+	return t, true
+}
+
+// CreateAnnotatedTag creates a tag object carrying a message and the tagger's
+// identity, and points a new tag ref at it
+func CreateAnnotatedTag(tagName, rev, message string) error {
+	if !IsRepoInitialized() {
+		return fmt.Errorf("not a kitkat repository (or any of the parent directories): .kitkat")
+	}
+
+	tagPath := filepath.Join(tagsDir, tagName)
+	if _, err := os.Stat(tagPath); err == nil {
+		return fmt.Errorf("error: tag %s already exists", tagName)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	commitID, err := ResolveRevision(rev)
+	if err != nil {
+		return err
+	}
+
+	name, email := configIdentity()
+	tag := tagObject{
+		Object:  commitID,
+		Name:    tagName,
+		Tagger:  fmt.Sprintf("%s <%s>", name, email),
+		Time:    time.Now(),
+		Message: message,
+	}
+	tagHash, err := saveObject(tag.encode())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(tagsDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tagPath, []byte(tagHash), 0644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Annotated tag '%s' created for commit %s\n", tagName, commitID)
+	return nil
+}
+
 // ListTags returns all tag names stored in .kitkat/refs/tags
 func ListTags() ([]string, error) {
 	if !IsRepoInitialized() {
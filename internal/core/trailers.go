@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Trailer is a "Key: value" line at the end of a commit message, such as
+// "Signed-off-by: Name <email>"
+type Trailer struct {
+	Key   string
+	Value string
+}
+
+// String formats the trailer the way it appears in a message
+func (t Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// trailerLine matches the first line of a trailer
+var trailerLine = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*)\s*:\s*(.*)$`)
+
+// ParseTrailerArg parses a trailer given on the command line as "key=value"
+// or "key: value"
+func ParseTrailerArg(arg string) (Trailer, error) {
+	sep := strings.IndexAny(arg, "=:")
+	if sep <= 0 {
+		return Trailer{}, fmt.Errorf("invalid trailer '%s': expected <key>=<value>", arg)
+	}
+	key := strings.TrimSpace(arg[:sep])
+	if !trailerLine.MatchString(key + ":") {
+		return Trailer{}, fmt.Errorf("invalid trailer key '%s'", key)
+	}
+	return Trailer{Key: key, Value: strings.TrimSpace(arg[sep+1:])}, nil
+}
+
+// splitTrailers splits a message into its body and the block of trailers at
+// its end. The block is the last paragraph when every line of it is a trailer
+// or continues one with leading whitespace; a subject alone has no trailers.
+func splitTrailers(message string) (body string, block []string) {
+	message = strings.TrimRight(message, "\n")
+	start := strings.LastIndex(message, "\n\n")
+	if start < 0 {
+		return message, nil
+	}
+	lines := strings.Split(message[start+2:], "\n")
+	for i, line := range lines {
+		continuation := i > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"))
+		if !continuation && !trailerLine.MatchString(line) {
+			return message, nil
+		}
+	}
+	return message[:start], lines
+}
+
+// ParseTrailers returns the trailers at the end of a commit message, with
+// continuation lines joined to the value they continue
+func ParseTrailers(message string) []Trailer {
+	_, block := splitTrailers(message)
+	var trailers []Trailer
+	for _, line := range block {
+		if m := trailerLine.FindStringSubmatch(line); m != nil {
+			trailers = append(trailers, Trailer{Key: m[1], Value: strings.TrimSpace(m[2])})
+			continue
+		}
+		last := &trailers[len(trailers)-1]
+		last.Value += " " + strings.TrimSpace(line)
+	}
+	return trailers
+}
+
+// AddTrailers appends trailers to the trailer block of a message, starting one
+// if there is none. A trailer the message already has is not added again.
+func AddTrailers(message string, trailers []Trailer) string {
+	existing := ParseTrailers(message)
+	body, block := splitTrailers(message)
+	for _, t := range trailers {
+		if hasTrailer(existing, t) {
+			continue
+		}
+		existing = append(existing, t)
+		block = append(block, t.String())
+	}
+	if len(block) == 0 {
+		return body
+	}
+	if body == "" {
+		return strings.Join(block, "\n")
+	}
+	return body + "\n\n" + strings.Join(block, "\n")
+}
+
+// hasTrailer reports whether trailers holds t, comparing keys without regard to case
+func hasTrailer(trailers []Trailer, t Trailer) bool {
+	for _, e := range trailers {
+		if strings.EqualFold(e.Key, t.Key) && e.Value == t.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// signoffTrailer returns the Signed-off-by trailer of the committer
+func signoffTrailer() (Trailer, error) {
+	committer, err := committerIdent()
+	if err != nil {
+		return Trailer{}, err
+	}
+	return Trailer{Key: "Signed-off-by", Value: fmt.Sprintf("%s <%s>", committer.Name, committer.Email)}, nil
+}
+
+// TrailerFilter selects commits by trailer: Key matches without regard to case
+// and Value, when set, must be part of the trailer's value
+type TrailerFilter struct {
+	Key   string
+	Value string
+}
+
+// Matches reports whether a message has a trailer the filter selects
+func (f TrailerFilter) Matches(message string) bool {
+	for _, t := range ParseTrailers(message) {
+		if strings.EqualFold(t.Key, f.Key) && strings.Contains(t.Value, f.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// InterpretTrailers adds trailers to a message the way `interpret-trailers`
+// does. With onlyTrailers, just the message's trailers are returned, one per line.
+func InterpretTrailers(message string, trailers []Trailer, onlyTrailers bool) string {
+	message = AddTrailers(message, trailers)
+	if !onlyTrailers {
+		return message + "\n"
+	}
+	var out strings.Builder
+	for _, t := range ParseTrailers(message) {
+		out.WriteString(t.String() + "\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/LeeFred3042U/kitcat/internal/models"
+)
+
+func TestParseTrailers(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []Trailer
+	}{
+		{"Subject: not a trailer", nil},
+		{"Subject\n\nBody text\nSigned-off-by: A <a@x>", nil},
+		{"Subject\n\nSigned-off-by: A <a@x>\nCo-authored-by: B\n  <b@x>\n", []Trailer{
+			{"Signed-off-by", "A <a@x>"},
+			{"Co-authored-by", "B <b@x>"},
+		}},
+	}
+	for _, tt := range tests {
+		if got := ParseTrailers(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseTrailers(%q) = %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestAddTrailers(t *testing.T) {
+	signoff := Trailer{"Signed-off-by", "A <a@x>"}
+	got := AddTrailers("Subject\n\nBody", []Trailer{signoff})
+	if want := "Subject\n\nBody\n\nSigned-off-by: A <a@x>"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Existing trailers are extended, and not repeated
+	got = AddTrailers(got, []Trailer{{"signed-off-by", "A <a@x>"}, {"Fixes", "12"}})
+	if want := "Subject\n\nBody\n\nSigned-off-by: A <a@x>\nFixes: 12"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if _, err := ParseTrailerArg("=value"); err == nil {
+		t.Error("trailer without a key was accepted")
+	}
+	if tr, err := ParseTrailerArg("Co-authored-by=B <b@x>"); err != nil || tr != (Trailer{"Co-authored-by", "B <b@x>"}) {
+		t.Errorf("got %v, %v", tr, err)
+	}
+}
+
+func TestFormatCommit(t *testing.T) {
+	commit := models.Commit{
+		ID:          "0123456789abcdef0123456789abcdef01234567",
+		TreeHash:    "fedcba9876543210fedcba9876543210fedcba98",
+		Message:     "Subject\n\nBody line\n\nSigned-off-by: A <a@x>\nFixes: 12\nsigned-off-by: B <b@x>",
+		AuthorName:  "Ada",
+		AuthorEmail: "ada@example.com",
+		Timestamp:   time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("", 3600)),
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"%h %s", "0123456 Subject"},
+		{"%H%n%T", commit.ID + "\n" + commit.TreeHash},
+		{"%an <%ae> %ad", "Ada <ada@example.com> Thu Jan 02 03:04:05 2020 +0100"},
+		// Without a committer the author counts as one
+		{"%cn <%ce> %cd", "Ada <ada@example.com> Thu Jan 02 03:04:05 2020 +0100"},
+		{"%b", "Body line\n\nSigned-off-by: A <a@x>\nFixes: 12\nsigned-off-by: B <b@x>"},
+		{"100%% %x %", "100% %x %"},
+		{"%(trailers)", "Signed-off-by: A <a@x>\nFixes: 12\nsigned-off-by: B <b@x>\n"},
+		{"%(trailers:key=Signed-off-by)", "Signed-off-by: A <a@x>\nsigned-off-by: B <b@x>\n"},
+		{"%(trailers:key=fixes,valueonly)", "12\n"},
+		{"%(trailers:key=Fixes,key=Signed-off-by,valueonly)|", "A <a@x>\n12\nB <b@x>\n|"},
+		{"%(trailers:key=Reviewed-by)%s", "Subject"},
+		{"%(trailers", "%(trailers"},
+	}
+	for _, tt := range tests {
+		if got := formatCommit(tt.format, commit); got != tt.want {
+			t.Errorf("formatCommit(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+
+	commit.CommitterName, commit.CommitterEmail = "Bob", "bob@example.com"
+	commit.CommitTime = time.Date(2021, 5, 6, 7, 8, 9, 0, time.UTC)
+	if got, want := formatCommit("%cn <%ce> %cd", commit), "Bob <bob@example.com> Thu May 06 07:08:09 2021 +0000"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if got := formatTrailers("Subject only", ""); got != "" {
+		t.Errorf("a message without trailers gave %q", got)
+	}
+}
+
+func TestTrailerFilter(t *testing.T) {
+	message := "Subject\n\nSigned-off-by: A <a@x>\nFixes: #12"
+	tests := []struct {
+		filters []TrailerFilter
+		want    bool
+	}{
+		{nil, true},
+		{[]TrailerFilter{{Key: "Signed-off-by"}}, true},
+		{[]TrailerFilter{{Key: "signed-off-by", Value: "a@x"}}, true},
+		{[]TrailerFilter{{Key: "Signed-off-by", Value: "b@x"}}, false},
+		{[]TrailerFilter{{Key: "Reviewed-by"}}, false},
+		{[]TrailerFilter{{Key: "Fixes", Value: "12"}, {Key: "Signed-off-by"}}, true},
+		{[]TrailerFilter{{Key: "Fixes"}, {Key: "Reviewed-by"}}, false},
+		// "Subject" is not a trailer, nor is text in the body
+		{[]TrailerFilter{{Key: "Subject"}}, false},
+	}
+	for _, tt := range tests {
+		if got := matchesTrailers(message, tt.filters); got != tt.want {
+			t.Errorf("matchesTrailers(%v) = %v, want %v", tt.filters, got, tt.want)
+		}
+	}
+	if (TrailerFilter{Key: "Fixes"}).Matches("Fixes: 12") {
+		t.Error("a subject was read as a trailer")
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+// unifiedContext is the number of unchanged lines shown around each hunk
+const unifiedContext = 3
+
+// noNewlineMarker follows a patch line whose file does not end in a newline
+const noNewlineMarker = "\\ No newline at end of file"
+
+// unifiedLine is a single line of a hunk. Text keeps its trailing newline,
+// if any, so a missing newline at the end of a file is a real difference.
+type unifiedLine struct {
+	Op   diff.Operation
+	Text string
+}
+
+// unifiedHunk is a group of changed lines plus surrounding context.
+// Start positions are 1-based line numbers as printed in the @@ header.
+type unifiedHunk struct {
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []unifiedLine
+}
+
+// splitLinesKeepEnds splits content into lines that keep their "\n" terminator
+func splitLinesKeepEnds(content []byte) []string {
+	s := string(content)
+	if s == "" {
+		return []string{}
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// buildHunks runs the line diff and groups the result into hunks with the
+// given number of context lines. Hunks closer than twice the context are merged.
+func buildHunks(oldContent, newContent []byte, opts DiffOptions, context int) []unifiedHunk {
+	// Flatten the diff into one entry per line, remembering line numbers
+	type numbered struct {
+		unifiedLine
+		oldNo, newNo int // 0-based position of the line on each side before it is applied
+	}
+	var lines []numbered
+	oldNo, newNo := 0, 0
+	for _, d := range lineDiff(splitLinesKeepEnds(oldContent), splitLinesKeepEnds(newContent), opts) {
+		for _, text := range d.Text {
+			lines = append(lines, numbered{unifiedLine{d.Operation, text}, oldNo, newNo})
+			switch d.Operation {
+			case diff.EQUAL:
+				oldNo++
+				newNo++
+			case diff.DELETE:
+				oldNo++
+			case diff.INSERT:
+				newNo++
+			}
+		}
+	}
+
+	var hunks []unifiedHunk
+	for i := 0; i < len(lines); {
+		if lines[i].Op == diff.EQUAL {
+			i++
+			continue
+		}
+
+		// Extend the hunk while the next change is within reach of the context
+		start := max(0, i-context)
+		end := i
+		for end < len(lines) {
+			if lines[end].Op != diff.EQUAL {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == diff.EQUAL {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(len(lines), end+context)
+				break
+			}
+			end = run
+		}
+
+		h := unifiedHunk{OldStart: lines[start].oldNo + 1, NewStart: lines[start].newNo + 1}
+		for _, l := range lines[start:end] {
+			h.Lines = append(h.Lines, l.unifiedLine)
+			if l.Op != diff.INSERT {
+				h.OldLines++
+			}
+			if l.Op != diff.DELETE {
+				h.NewLines++
+			}
+		}
+		// An empty side is addressed as the line before it, like diff(1) does
+		if h.OldLines == 0 {
+			h.OldStart--
+		}
+		if h.NewLines == 0 {
+			h.NewStart--
+		}
+		hunks = append(hunks, h)
+		i = end
+	}
+	return hunks
+}
+
+// hunkRange formats one side of an @@ header
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// writeUnifiedDiff writes a file change as a git-style unified diff.
+// Colors are only used when color is true so the output can be saved as a patch.
+func writeUnifiedDiff(w io.Writer, c fileChange, opts DiffOptions, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	fmt.Fprintln(w, paint(colorBlue, fmt.Sprintf("diff --git %s %s", oldName, newName)))
+	switch c.Status {
+	case 'A':
+		fmt.Fprintln(w, paint(colorBlue, "new file mode 100644"))
+		oldName = "/dev/null"
+	case 'D':
+		fmt.Fprintln(w, paint(colorBlue, "deleted file mode 100644"))
+		newName = "/dev/null"
+	}
+
+	hunks := buildHunks(c.Old, c.New, opts, unifiedContext)
+	if len(hunks) == 0 {
+		return
+	}
+	fmt.Fprintln(w, paint(colorBlue, "--- "+oldName))
+	fmt.Fprintln(w, paint(colorBlue, "+++ "+newName))
+
+	for _, h := range hunks {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+		fmt.Fprintln(w, paint("\033[36m", header))
+		for _, l := range h.Lines {
+			text := strings.TrimSuffix(l.Text, "\n")
+			switch l.Op {
+			case diff.EQUAL:
+				fmt.Fprintln(w, " "+text)
+			case diff.DELETE:
+				fmt.Fprintln(w, paint(colorRed, "-"+text))
+			case diff.INSERT:
+				fmt.Fprintln(w, paint(colorGreen, "+"+text))
+			}
+			if !strings.HasSuffix(l.Text, "\n") {
+				fmt.Fprintln(w, noNewlineMarker)
+			}
+		}
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuildHunks(t *testing.T) {
+	oldContent := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n")
+	newContent := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\nfourteen\n15\n")
+
+	hunks := buildHunks(oldContent, newContent, DiffOptions{}, 3)
+	if len(hunks) != 2 {
+		t.Fatalf("expected 2 hunks, got %d", len(hunks))
+	}
+	if hunks[0].OldStart != 1 || hunks[0].OldLines != 6 || hunks[0].NewStart != 1 || hunks[0].NewLines != 6 {
+		t.Errorf("unexpected first hunk range: %+v", hunks[0])
+	}
+	if hunks[1].OldStart != 11 || hunks[1].OldLines != 5 || hunks[1].NewStart != 11 || hunks[1].NewLines != 5 {
+		t.Errorf("unexpected second hunk range: %+v", hunks[1])
+	}
+
+	// Changes within twice the context of each other share a hunk
+	hunks = buildHunks(oldContent, newContent, DiffOptions{}, 6)
+	if len(hunks) != 1 {
+		t.Errorf("expected hunks to merge with a larger context, got %d", len(hunks))
+	}
+}
+
+func TestWriteUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change fileChange
+		want   string
+	}{
+		{
+			name:   "New file",
+			change: fileChange{Path: "a.txt", Status: 'A', New: []byte("hello\n")},
+			want: "diff --git a/a.txt b/a.txt\n" +
+				"new file mode 100644\n" +
+				"--- /dev/null\n" +
+				"+++ b/a.txt\n" +
+				"@@ -0,0 +1 @@\n" +
+				"+hello\n",
+		},
+		{
+			name:   "Missing newline at end of file",
+			change: fileChange{Path: "a.txt", Status: 'M', Old: []byte("a\nb\n"), New: []byte("a\nb")},
+			want: "diff --git a/a.txt b/a.txt\n" +
+				"--- a/a.txt\n" +
+				"+++ b/a.txt\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"+b\n" +
+				noNewlineMarker + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writeUnifiedDiff(&buf, tt.change, DiffOptions{}, false)
+			if buf.String() != tt.want {
+				t.Errorf("writeUnifiedDiff() =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+			if strings.Contains(buf.String(), "\033[") {
+				t.Errorf("uncolored output contains escape codes")
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+// ignoresWhitespace reports whether any whitespace-insensitive comparison is enabled
+func (o DiffOptions) ignoresWhitespace() bool {
+	return o.IgnoreAllSpace || o.IgnoreSpaceChange || o.IgnoreBlankLines || o.IgnoreCRAtEOL
+}
+
+// normalizeLine returns the key a line is compared by under the whitespace options.
+// Only the key is affected; the original line is what gets printed.
+func (o DiffOptions) normalizeLine(line string) string {
+	// Lines split for unified diffs keep their terminator; it is never part of the comparison
+	line = strings.TrimSuffix(line, "\n")
+	if o.IgnoreCRAtEOL {
+		line = strings.TrimSuffix(line, "\r")
+	}
+	switch {
+	case o.IgnoreAllSpace:
+		line = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	case o.IgnoreSpaceChange:
+		// Collapse every run of whitespace to one space and drop it at the end of the line
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		var sb strings.Builder
+		inSpace := false
+		for _, r := range line {
+			if unicode.IsSpace(r) {
+				if !inSpace {
+					sb.WriteRune(' ')
+				}
+				inSpace = true
+				continue
+			}
+			inSpace = false
+			sb.WriteRune(r)
+		}
+		line = sb.String()
+	}
+	return line
+}
+
+// normalizedDiff runs the Myers engine on the keys of two sequences and maps the
+// result back onto the original elements, so equal keys with different text are
+// reported as EQUAL while the output still carries the original text.
+// EQUAL runs carry the elements of the new sequence.
+func normalizedDiff(oldItems, newItems []string, key func(string) string) []diff.Diff[string] {
+	oldKeys := make([]string, len(oldItems))
+	for i, item := range oldItems {
+		oldKeys[i] = key(item)
+	}
+	newKeys := make([]string, len(newItems))
+	for i, item := range newItems {
+		newKeys[i] = key(item)
+	}
+
+	var result []diff.Diff[string]
+	i, j := 0, 0
+	for _, d := range diff.NewMyersDiff(oldKeys, newKeys).Diffs() {
+		n := len(d.Text)
+		switch d.Operation {
+		case diff.EQUAL:
+			result = append(result, diff.Diff[string]{Operation: diff.EQUAL, Text: newItems[j : j+n]})
+			i += n
+			j += n
+		case diff.DELETE:
+			result = append(result, diff.Diff[string]{Operation: diff.DELETE, Text: oldItems[i : i+n]})
+			i += n
+		case diff.INSERT:
+			result = append(result, diff.Diff[string]{Operation: diff.INSERT, Text: newItems[j : j+n]})
+			j += n
+		}
+	}
+	return result
+}
+
+// lineDiff computes the line diff between two sets of lines honouring the
+// whitespace options in opts
+func lineDiff(oldLines, newLines []string, opts DiffOptions) []diff.Diff[string] {
+	if !opts.ignoresWhitespace() {
+		return diff.NewMyersDiff(oldLines, newLines).Diffs()
+	}
+
+	diffs := normalizedDiff(oldLines, newLines, opts.normalizeLine)
+	if !opts.IgnoreBlankLines {
+		return diffs
+	}
+
+	// Changes that only add or remove blank lines are not reported: added blank
+	// lines become context and removed ones are dropped. Adjacent runs of the same
+	// operation are merged again so deleted/inserted pairs stay together.
+	var result []diff.Diff[string]
+	for _, d := range diffs {
+		if d.Operation != diff.EQUAL && allBlank(d.Text, opts) {
+			if d.Operation == diff.DELETE {
+				continue
+			}
+			d.Operation = diff.EQUAL
+		}
+		if n := len(result); n > 0 && result[n-1].Operation == d.Operation {
+			merged := append([]string{}, result[n-1].Text...)
+			result[n-1].Text = append(merged, d.Text...)
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// allBlank reports whether every line is empty once normalized.
+// Whitespace-only lines count as blank.
+func allBlank(lines []string, opts DiffOptions) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(opts.normalizeLine(line)) != "" {
+			return false
+		}
+	}
+	return true
+}
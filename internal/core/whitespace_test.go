@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+func TestLineDiffWhitespaceOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldLines []string
+		newLines []string
+		opts     DiffOptions
+		changed  bool
+	}{
+		{
+			name:     "Indentation change is reported by default",
+			oldLines: []string{"func main() {", "return", "}"},
+			newLines: []string{"func main() {", "\treturn", "}"},
+			opts:     DiffOptions{},
+			changed:  true,
+		},
+		{
+			name:     "Ignore all space",
+			oldLines: []string{"a = b + c"},
+			newLines: []string{"a=b+c"},
+			opts:     DiffOptions{IgnoreAllSpace: true},
+		},
+		{
+			name:     "Ignore space change collapses runs",
+			oldLines: []string{"a  =  b   "},
+			newLines: []string{"a = b"},
+			opts:     DiffOptions{IgnoreSpaceChange: true},
+		},
+		{
+			name:     "Ignore space change still sees removed spaces",
+			oldLines: []string{"a = b"},
+			newLines: []string{"a=b"},
+			opts:     DiffOptions{IgnoreSpaceChange: true},
+			changed:  true,
+		},
+		{
+			name:     "Ignore blank lines",
+			oldLines: []string{"a", "b"},
+			newLines: []string{"a", "", "b", ""},
+			opts:     DiffOptions{IgnoreBlankLines: true},
+		},
+		{
+			name:     "Ignore CR at end of line",
+			oldLines: []string{"a\r", "b\r"},
+			newLines: []string{"a", "b"},
+			opts:     DiffOptions{IgnoreCRAtEOL: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed := false
+			for _, d := range lineDiff(tt.oldLines, tt.newLines, tt.opts) {
+				if d.Operation != diff.EQUAL {
+					changed = true
+				}
+			}
+			if changed != tt.changed {
+				t.Errorf("lineDiff() reported changes = %v, want %v", changed, tt.changed)
+			}
+		})
+	}
+}
+
+func TestLineDiffKeepsOriginalLines(t *testing.T) {
+	diffs := lineDiff([]string{"x", "a"}, []string{"y", "  a  "}, DiffOptions{IgnoreAllSpace: true})
+	last := diffs[len(diffs)-1]
+	if last.Operation != diff.EQUAL || last.Text[0] != "  a  " {
+		t.Errorf("expected original new line to be kept as context, got %v", last)
+	}
+}
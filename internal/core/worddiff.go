@@ -0,0 +1,132 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/LeeFred3042U/kitcat/internal/diff"
+)
+
+// WordDiffMode selects how changes inside a modified line are highlighted
+type WordDiffMode int
+
+const (
+	// WordDiffNone prints whole changed lines (the default line diff)
+	WordDiffNone WordDiffMode = iota
+	// WordDiffPlain marks changed words inline as [-removed-] and {+added+}
+	WordDiffPlain
+	// WordDiffColor highlights changed words inline using colors only
+	WordDiffColor
+)
+
+// defaultWordRegex treats every run of non-whitespace characters as a word
+var defaultWordRegex = regexp.MustCompile(`\S+`)
+
+// tokenize splits a line into tokens for word-level diffing.
+// Every match of re is a token, and so is every gap between matches,
+// so concatenating the tokens always reproduces the original line.
+func tokenize(line string, re *regexp.Regexp) []string {
+	var tokens []string
+	last := 0
+	for _, loc := range re.FindAllStringIndex(line, -1) {
+		// Zero-width matches would produce empty tokens and never advance
+		if loc[0] == loc[1] {
+			continue
+		}
+		if loc[0] > last {
+			tokens = append(tokens, line[last:loc[0]])
+		}
+		tokens = append(tokens, line[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	if last < len(line) {
+		tokens = append(tokens, line[last:])
+	}
+	return tokens
+}
+
+// markRemoved formats removed text for the given word diff mode
+func markRemoved(text string, mode WordDiffMode) string {
+	if mode == WordDiffColor {
+		return colorRed + text + colorReset
+	}
+	return "[-" + text + "-]"
+}
+
+// markAdded formats added text for the given word diff mode
+func markAdded(text string, mode WordDiffMode) string {
+	if mode == WordDiffColor {
+		return colorGreen + text + colorReset
+	}
+	return "{+" + text + "+}"
+}
+
+// wordDiffLine runs the Myers engine on the tokens of a changed line pair
+// and returns a single line with the intra-line changes highlighted
+func wordDiffLine(oldLine, newLine string, opts DiffOptions) string {
+	re := opts.WordRegex
+	if re == nil {
+		re = defaultWordRegex
+	}
+	oldTokens, newTokens := tokenize(oldLine, re), tokenize(newLine, re)
+
+	// Whitespace options apply to tokens the same way they apply to lines
+	var chunks []diff.Diff[string]
+	if opts.ignoresWhitespace() {
+		chunks = normalizedDiff(oldTokens, newTokens, opts.normalizeLine)
+	} else {
+		chunks = diff.NewMyersDiff(oldTokens, newTokens).Diffs()
+	}
+
+	var sb strings.Builder
+	for _, chunk := range chunks {
+		text := strings.Join(chunk.Text, "")
+		switch chunk.Operation {
+		case diff.EQUAL:
+			sb.WriteString(text)
+		case diff.DELETE:
+			sb.WriteString(markRemoved(text, opts.WordDiff))
+		case diff.INSERT:
+			sb.WriteString(markAdded(text, opts.WordDiff))
+		}
+	}
+	return sb.String()
+}
+
+// displayWordDiff prints a line diff with word-level highlighting.
+// A deleted block directly followed by an inserted block is treated as a set of
+// modified lines: they are paired up in order and diffed token by token.
+// Lines left over on either side are printed as whole-line removals or additions.
+func displayWordDiff(diffs []diff.Diff[string], opts DiffOptions) {
+	mode := opts.WordDiff
+	for i := 0; i < len(diffs); i++ {
+		d := diffs[i]
+		switch d.Operation {
+		case diff.EQUAL:
+			for _, line := range d.Text {
+				fmt.Printf("  %s\n", line)
+			}
+		case diff.INSERT:
+			for _, line := range d.Text {
+				fmt.Printf("  %s\n", markAdded(line, mode))
+			}
+		case diff.DELETE:
+			var inserted []string
+			if i+1 < len(diffs) && diffs[i+1].Operation == diff.INSERT {
+				inserted = diffs[i+1].Text
+				i++
+			}
+			pairs := min(len(d.Text), len(inserted))
+			for j := 0; j < pairs; j++ {
+				fmt.Printf("  %s\n", wordDiffLine(d.Text[j], inserted[j], opts))
+			}
+			for _, line := range d.Text[pairs:] {
+				fmt.Printf("  %s\n", markRemoved(line, mode))
+			}
+			for _, line := range inserted[pairs:] {
+				fmt.Printf("  %s\n", markAdded(line, mode))
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		re   *regexp.Regexp
+		want []string
+	}{
+		{
+			name: "Words and spaces",
+			line: "hello  world",
+			re:   defaultWordRegex,
+			want: []string{"hello", "  ", "world"},
+		},
+		{
+			name: "Leading and trailing whitespace",
+			line: " a b ",
+			re:   defaultWordRegex,
+			want: []string{" ", "a", " ", "b", " "},
+		},
+		{
+			name: "Character level",
+			line: "ab c",
+			re:   regexp.MustCompile(`.`),
+			want: []string{"a", "b", " ", "c"},
+		},
+		{
+			name: "Zero-width matches are skipped",
+			line: "abc",
+			re:   regexp.MustCompile(`x*`),
+			want: []string{"abc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tokenize(tt.line, tt.re)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+			if strings.Join(got, "") != tt.line {
+				t.Errorf("tokens do not reproduce the original line: %q", got)
+			}
+		})
+	}
+}
+
+func TestWordDiffLine(t *testing.T) {
+	got := wordDiffLine("hello world foo", "hello word foo", DiffOptions{WordDiff: WordDiffPlain})
+	want := "hello [-world-]{+word+} foo"
+	if got != want {
+		t.Errorf("wordDiffLine() = %q, want %q", got, want)
+	}
+
+	got = wordDiffLine("hello world", "hello word", DiffOptions{WordDiff: WordDiffPlain, WordRegex: regexp.MustCompile(`.`)})
+	want = "hello wor[-l-]d"
+	if got != want {
+		t.Errorf("wordDiffLine() character level = %q, want %q", got, want)
+	}
+}
@@ -3,11 +3,14 @@ package models
 import "time"
 
 type Commit struct {
-	ID          string
-	Parent      string
-	Message     string
-	Timestamp   time.Time
-	TreeHash    string
-	AuthorName  string
-	AuthorEmail string
+	ID             string
+	Parent         string
+	Message        string
+	Timestamp      time.Time
+	TreeHash       string
+	AuthorName     string
+	AuthorEmail    string
+	CommitterName  string
+	CommitterEmail string
+	CommitTime     time.Time
 }
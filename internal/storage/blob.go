@@ -12,7 +12,15 @@ const (
 	objectsDir = ".kitkat/objects"
 )
 
+// HashAndStoreFile stores a file's content as a blob and returns its hash.
+// Symbolic links are not followed; their target path is stored instead.
 func HashAndStoreFile(path string) (string, error) {
+	if target, ok, err := readSymlink(path); err != nil {
+		return "", err
+	} else if ok {
+		return storeBlob([]byte(target))
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -32,21 +40,31 @@ func HashAndStoreFile(path string) (string, error) {
 	}
 
 	if _, err := os.Stat(objPath); os.IsNotExist(err) {
-		// write via tmp file — reuse already-open file by rewinding
-		tmp := objPath + ".tmp"
+		// write via tmp file — reuse already-open file by rewinding.
+		// The tmp name is unique so files with the same content can be stored concurrently
 		if _, err := f.Seek(0, 0); err != nil {
 			return "", err
 		}
-		out, err := os.Create(tmp)
+		out, err := os.CreateTemp(objectsDir, hash+".tmp-*")
 		if err != nil {
 			return "", err
 		}
+		tmp := out.Name()
+		// CreateTemp uses 0600; objects are readable by everyone, like tree objects
+		if err := out.Chmod(0644); err != nil {
+			out.Close()
+			os.Remove(tmp)
+			return "", err
+		}
 		if _, err := io.Copy(out, f); err != nil {
 			out.Close()
 			os.Remove(tmp)
 			return "", err
 		}
-		out.Close()
+		if err := out.Close(); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
 		if err := os.Rename(tmp, objPath); err != nil {
 			os.Remove(tmp)
 			return "", err
@@ -62,9 +80,15 @@ func ReadObject(hash string) ([]byte, error) {
 	return os.ReadFile(objectPath)
 }
 
-// Computes the SHA-1 hash of a file's content
+// Computes the SHA-1 hash of a file's content (or a symlink's target)
 // does not store the file in the object database
 func HashFile(path string) (string, error) {
+	if target, ok, err := readSymlink(path); err != nil {
+		return "", err
+	} else if ok {
+		return fmt.Sprintf("%x", sha1.Sum([]byte(target))), nil
+	}
+
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -78,3 +102,50 @@ func HashFile(path string) (string, error) {
 
 	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
 }
+
+// readSymlink returns the target of path if it is a symbolic link
+func readSymlink(path string) (string, bool, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", false, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return "", false, nil
+	}
+	target, err := os.Readlink(path)
+	return target, err == nil, err
+}
+
+// storeBlob writes content to the object database and returns its hash
+func storeBlob(content []byte) (string, error) {
+	hash := fmt.Sprintf("%x", sha1.Sum(content))
+	if err := os.MkdirAll(objectsDir, 0755); err != nil {
+		return "", err
+	}
+	objPath := filepath.Join(objectsDir, hash)
+	if _, err := os.Stat(objPath); err == nil {
+		return hash, nil
+	}
+	out, err := os.CreateTemp(objectsDir, hash+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	tmp := out.Name()
+	// CreateTemp uses 0600; objects are readable by everyone, like tree objects
+	err = out.Chmod(0644)
+	if err == nil {
+		_, err = out.Write(content)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := os.Rename(tmp, objPath); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return hash, nil
+}
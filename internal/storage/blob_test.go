@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestObjectsAreWorldReadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("file", []byte("content\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("file", "link"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files are stored through HashAndStoreFile's copy, links through storeBlob
+	for _, path := range []string{"file", "link"} {
+		hash, err := HashAndStoreFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(objectsDir, hash))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm&0044 != 0044 {
+			t.Errorf("object for %s has mode %o, want it readable by group and others", path, perm)
+		}
+	}
+}
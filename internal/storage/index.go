@@ -1,55 +1,221 @@
 package storage
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 )
 
 const indexPath = ".kitkat/index"
 
-// LoadIndex reads the .kitkat/index file (in JSON format) and returns it as a map
-// It returns an empty map if the file doesn't exist, which is normal for a new repository
-func LoadIndex() (map[string]string, error) {
-	index := make(map[string]string)
+// The index file starts with a magic number and a format version, followed by
+// the entry count, the entries sorted by path, and a SHA-1 of everything before it
+const (
+	indexMagic   = "KKIX"
+	indexVersion = 1
+)
+
+// racyWindow is how recently a file may have been modified before its stat data
+// is no longer trusted. A file changed again within the same timestamp tick would
+// keep its mtime, so such entries are always re-hashed. Two seconds covers the
+// coarsest timestamps in common use (FAT).
+const racyWindow = 2 * time.Second
+
+// File modes recorded in index and tree entries. Like git, only the executable
+// bit of a regular file's permissions is tracked.
+const (
+	ModeRegular    uint32 = 0100644
+	ModeExecutable uint32 = 0100755
+	ModeSymlink    uint32 = 0120000
+)
+
+// ModeFromFileInfo returns the mode an lstat result is recorded with
+func ModeFromFileInfo(info os.FileInfo) uint32 {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return ModeSymlink
+	case info.Mode().Perm()&0111 != 0:
+		return ModeExecutable
+	default:
+		return ModeRegular
+	}
+}
+
+// normalizeMode maps any stored mode onto one of the modes above.
+// Missing modes (as in older indexes and trees) mean a regular file.
+func normalizeMode(mode uint32) uint32 {
+	switch {
+	case mode == ModeSymlink:
+		return ModeSymlink
+	case mode&0111 != 0:
+		return ModeExecutable
+	default:
+		return ModeRegular
+	}
+}
+
+// IndexEntry is a staged file together with the file system metadata it had when
+// its content was last hashed. Entries without stat data (MTime == 0) are always
+// compared by content.
+type IndexEntry struct {
+	Path  string
+	Hash  string
+	Mode  uint32 // ModeRegular, ModeExecutable or ModeSymlink
+	Size  int64
+	MTime int64 // Nanoseconds since the Unix epoch
+	CTime int64 // Nanoseconds since the Unix epoch; 0 where unavailable
+	Inode uint64
+}
+
+// NewIndexEntry creates an entry for a file whose content hashes to hash.
+// info must come from lstat-ing the file before its content was read. Its stat
+// data is only recorded if the file was not modified within racyWindow.
+func NewIndexEntry(path, hash string, info os.FileInfo) IndexEntry {
+	entry := IndexEntry{Path: path, Hash: hash, Mode: ModeFromFileInfo(info)}
+	if time.Since(info.ModTime()) < racyWindow {
+		return entry
+	}
+	entry.Size = info.Size()
+	entry.MTime = info.ModTime().UnixNano()
+	entry.CTime, entry.Inode = statExtra(info)
+	return entry
+}
+
+// HasStat reports whether the entry carries stat data that can be trusted
+func (e IndexEntry) HasStat() bool {
+	return e.MTime != 0
+}
+
+// StatMatches reports whether info describes the file exactly as it was when
+// the entry was recorded, in which case its content need not be hashed again
+func (e IndexEntry) StatMatches(info os.FileInfo) bool {
+	if !e.HasStat() {
+		return false
+	}
+	ctime, inode := statExtra(info)
+	return e.Size == info.Size() &&
+		e.MTime == info.ModTime().UnixNano() &&
+		e.CTime == ctime &&
+		e.Inode == inode &&
+		e.Mode == ModeFromFileInfo(info)
+}
+
+// LoadIndexEntries reads the .kitkat/index file and returns its entries keyed by path.
+// It returns an empty map if the file doesn't exist, which is normal for a new repository.
+// Indexes written in the older JSON format are read without stat data.
+func LoadIndexEntries() (map[string]IndexEntry, error) {
+	entries := make(map[string]IndexEntry)
 
 	content, err := os.ReadFile(indexPath)
 	if os.IsNotExist(err) {
 		// File doesn't exist, return empty index. This is not an error ^-^
-		return index, nil
+		return entries, nil
 	}
 	if err != nil {
 		return nil, fmt.Errorf("could not read index file: %w", err)
 	}
 
-	// If the file is empty, avoid a JSON error.
+	// If the file is empty, there is nothing to parse
 	if len(content) == 0 {
-		return index, nil
+		return entries, nil
+	}
+
+	if content[0] == '{' {
+		var legacy map[string]string
+		if err := json.Unmarshal(content, &legacy); err != nil {
+			return nil, fmt.Errorf("could not parse index file: %w", err)
+		}
+		for path, hash := range legacy {
+			entries[path] = IndexEntry{Path: path, Hash: hash, Mode: ModeRegular}
+		}
+		return entries, nil
 	}
 
-	if err := json.Unmarshal(content, &index); err != nil {
+	if err := decodeIndex(content, entries); err != nil {
 		return nil, fmt.Errorf("could not parse index file: %w", err)
 	}
+	return entries, nil
+}
+
+// LoadIndex reads the index and returns it as a map of path to blob hash
+func LoadIndex() (map[string]string, error) {
+	entries, err := LoadIndexEntries()
+	if err != nil {
+		return nil, err
+	}
+	return IndexHashes(entries), nil
+}
 
-	return index, nil
+// IndexHashes returns the path to blob hash view of a set of entries
+func IndexHashes(entries map[string]IndexEntry) map[string]string {
+	index := make(map[string]string, len(entries))
+	for path, entry := range entries {
+		index[path] = entry.Hash
+	}
+	return index
 }
 
-// WriteIndex writes the index map to the .kitkat/index file atomically using a JSON format
-// It uses a temporary file and an atomic rename to prevent corruption 'o'
-func WriteIndex(index map[string]string) error {
+// UpdateIndex loads the index, lets fn modify its entries and writes the result
+// back atomically. The index lock is held from the read to the rename, so two
+// concurrent updates cannot overwrite each other's changes. If fn returns an
+// error the index is left untouched.
+func UpdateIndex(fn func(entries map[string]IndexEntry) error) error {
 	// Ensure the parent directory (.kitkat) exists.
 	if err := os.MkdirAll(filepath.Dir(indexPath), 0755); err != nil {
 		return err
 	}
 
-	// Lock the file to prevent concurrent writes
+	// Lock the file to prevent concurrent read-modify-write cycles
 	l, err := lock(indexPath)
 	if err != nil {
 		return err
 	}
 	defer unlock(l)
 
+	entries, err := LoadIndexEntries()
+	if err != nil {
+		return err
+	}
+	if err := fn(entries); err != nil {
+		return err
+	}
+	return writeIndexLocked(entries)
+}
+
+// RefreshIndexStat records fresh stat data for files that were hashed and found
+// unchanged. Entries whose hash changed in the meantime are left alone.
+func RefreshIndexStat(fresh map[string]IndexEntry) error {
+	if len(fresh) == 0 {
+		return nil
+	}
+	return UpdateIndex(func(entries map[string]IndexEntry) error {
+		for path, entry := range fresh {
+			if current, ok := entries[path]; ok && current.Hash == entry.Hash {
+				entries[path] = entry
+			}
+		}
+		return nil
+	})
+}
+
+// writeIndexLocked writes the entries to the .kitkat/index file atomically.
+// The caller must hold the index lock.
+// It uses a temporary file and an atomic rename to prevent corruption 'o'
+func writeIndexLocked(entries map[string]IndexEntry) error {
+	data, err := encodeIndex(entries)
+	if err != nil {
+		return err
+	}
+
 	// Use a temporary file for the initial write
 	tmpPath := indexPath + ".tmp"
 	file, err := os.Create(tmpPath)
@@ -57,10 +223,7 @@ func WriteIndex(index map[string]string) error {
 		return err
 	}
 
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ")
-
-	err = encoder.Encode(index)
+	_, err = file.Write(data)
 	// Must close the file before renaming it
 	if closeErr := file.Close(); err == nil {
 		err = closeErr
@@ -72,3 +235,83 @@ func WriteIndex(index map[string]string) error {
 	// Atomically rename the temporary file to the final index file
 	return os.Rename(tmpPath, indexPath)
 }
+
+// encodeIndex serializes entries in the binary index format
+func encodeIndex(entries map[string]IndexEntry) ([]byte, error) {
+	paths := make([]string, 0, len(entries))
+	for path := range entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.WriteString(indexMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(indexVersion))
+	binary.Write(&buf, binary.BigEndian, uint32(len(paths)))
+
+	for _, path := range paths {
+		e := entries[path]
+		hash, err := hex.DecodeString(e.Hash)
+		if err != nil || len(hash) != sha1.Size {
+			return nil, fmt.Errorf("invalid object hash %q for %s", e.Hash, path)
+		}
+		if len(path) > 0xffff {
+			return nil, fmt.Errorf("path too long for index: %s", path)
+		}
+		binary.Write(&buf, binary.BigEndian, e.CTime)
+		binary.Write(&buf, binary.BigEndian, e.MTime)
+		binary.Write(&buf, binary.BigEndian, e.Inode)
+		binary.Write(&buf, binary.BigEndian, e.Mode)
+		binary.Write(&buf, binary.BigEndian, e.Size)
+		buf.Write(hash)
+		binary.Write(&buf, binary.BigEndian, uint16(len(path)))
+		buf.WriteString(path)
+	}
+
+	sum := sha1.Sum(buf.Bytes())
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// decodeIndex parses the binary index format into entries
+func decodeIndex(data []byte, entries map[string]IndexEntry) error {
+	if len(data) < len(indexMagic)+8+sha1.Size || string(data[:len(indexMagic)]) != indexMagic {
+		return errors.New("not an index file")
+	}
+	body, trailer := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], trailer) {
+		return errors.New("index checksum mismatch")
+	}
+
+	r := bytes.NewReader(body[len(indexMagic):])
+	var version, count uint32
+	binary.Read(r, binary.BigEndian, &version)
+	binary.Read(r, binary.BigEndian, &count)
+	if version != indexVersion {
+		return fmt.Errorf("unsupported index version %d", version)
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var e IndexEntry
+		var hash [sha1.Size]byte
+		var pathLen uint16
+		fields := []any{&e.CTime, &e.MTime, &e.Inode, &e.Mode, &e.Size, &hash, &pathLen}
+		for _, field := range fields {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return fmt.Errorf("truncated index entry: %w", err)
+			}
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(r, path); err != nil {
+			return fmt.Errorf("truncated index entry: %w", err)
+		}
+		e.Path = string(path)
+		e.Hash = hex.EncodeToString(hash[:])
+		e.Mode = normalizeMode(e.Mode)
+		entries[e.Path] = e
+	}
+	if r.Len() != 0 {
+		return errors.New("trailing data in index")
+	}
+	return nil
+}
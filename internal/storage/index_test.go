@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIndexEntriesRoundTrip(t *testing.T) {
+	entries := map[string]IndexEntry{
+		"a.txt":     {Path: "a.txt", Hash: "da39a3ee5e6b4b0d3255bfef95601890afd80709", Mode: ModeExecutable, Size: 12, MTime: 1700000000123456789, CTime: 1700000000123456789, Inode: 42},
+		"dir/b.txt": {Path: "dir/b.txt", Hash: "8843d7f92416211de9ebb963ff4ce28125932878", Mode: ModeRegular},
+	}
+	data, err := encodeIndex(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := make(map[string]IndexEntry)
+	if err := decodeIndex(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range entries {
+		if got := decoded[path]; got != want {
+			t.Errorf("entry %s: got %+v, want %+v", path, got, want)
+		}
+	}
+
+	data[len(data)-sha1.Size-1] ^= 0xff
+	if err := decodeIndex(data, make(map[string]IndexEntry)); err == nil {
+		t.Errorf("expected a checksum error for a corrupted index")
+	}
+}
+
+func TestIndexEntryStat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file modified just now is racy, so its stat data must not be trusted
+	if entry := NewIndexEntry("file", "hash", info); entry.HasStat() || entry.StatMatches(info) {
+		t.Errorf("stat data recorded for a racily modified file")
+	}
+
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	info, _ = os.Stat(path)
+	entry := NewIndexEntry("file", "hash", info)
+	if !entry.StatMatches(info) {
+		t.Errorf("stat data of an unchanged file does not match")
+	}
+
+	if err := os.WriteFile(path, []byte("changed content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := os.Stat(path)
+	if entry.StatMatches(changed) {
+		t.Errorf("stat data matches after the file was rewritten")
+	}
+}
+
+func TestUpdateIndexConcurrent(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every update holds the lock across its read and write, so none may be lost
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("file%d", i)
+			err := UpdateIndex(func(entries map[string]IndexEntry) error {
+				entries[path] = IndexEntry{Path: path, Hash: "da39a3ee5e6b4b0d3255bfef95601890afd80709"}
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := LoadIndexEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != writers {
+		t.Errorf("expected %d entries, got %d", writers, len(entries))
+	}
+}
+
+func TestTreeEntryModes(t *testing.T) {
+	originalWd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(originalWd)
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(objectsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	const hash = "da39a3ee5e6b4b0d3255bfef95601890afd80709"
+	want := map[string]TreeEntry{
+		"plain":  {Hash: hash, Mode: ModeRegular},
+		"run.sh": {Hash: hash, Mode: ModeExecutable},
+		"link":   {Hash: hash, Mode: ModeSymlink},
+	}
+	err = UpdateIndex(func(entries map[string]IndexEntry) error {
+		for path, entry := range want {
+			entries[path] = IndexEntry{Path: path, Hash: entry.Hash, Mode: entry.Mode}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	treeHash, err := CreateTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseTreeEntries(treeHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, entry := range want {
+		if got[path] != entry {
+			t.Errorf("%s: got %+v, want %+v", path, got[path], entry)
+		}
+	}
+
+	// Regular files keep the original "hash path" line so older trees hash the same
+	data, _ := ReadObject(treeHash)
+	if !strings.Contains(string(data), "\n"+hash+" plain\n") {
+		t.Errorf("regular file written with a mode:\n%s", data)
+	}
+}
@@ -1,7 +1,7 @@
 package storage
 
 import (
-	"encoding/json"
+	"bytes"
 	"os"
 	"testing"
 )
@@ -10,7 +10,7 @@ func TestIndexWriteSanity(t *testing.T) {
 	// Setup isolated environment
 	tmpDir := t.TempDir()
 
-	// Switch CWD to temp dir because WriteIndex writes to ".kitkat/index" relative path
+	// Switch CWD to temp dir because UpdateIndex writes to ".kitkat/index" relative path
 	originalWd, err := os.Getwd()
 	if err != nil {
 		t.Fatal(err)
@@ -29,9 +29,15 @@ func TestIndexWriteSanity(t *testing.T) {
 		"README.md":     "8843d7f92416211de9ebb963ff4ce28125932878",
 	}
 
-	// Execute WriteIndex
-	if err := WriteIndex(indexData); err != nil {
-		t.Fatalf("WriteIndex failed: %v", err)
+	// Execute UpdateIndex
+	err = UpdateIndex(func(entries map[string]IndexEntry) error {
+		for path, hash := range indexData {
+			entries[path] = IndexEntry{Path: path, Hash: hash, Mode: ModeRegular}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateIndex failed: %v", err)
 	}
 
 	// Assertions
@@ -43,10 +49,13 @@ func TestIndexWriteSanity(t *testing.T) {
 		t.Fatalf("Failed to read index file at %s: %v", targetPath, err)
 	}
 
-	// Assert Valid JSON
-	var loadedMap map[string]string
-	if err := json.Unmarshal(content, &loadedMap); err != nil {
-		t.Fatalf("Index file contains invalid JSON: %v", err)
+	// Assert the file is a complete binary index
+	if !bytes.HasPrefix(content, []byte(indexMagic)) {
+		t.Fatalf("Index file does not start with the index magic")
+	}
+	loadedMap, err := LoadIndex()
+	if err != nil {
+		t.Fatalf("Index file could not be parsed: %v", err)
 	}
 
 	// Assert Content Integrity
@@ -2,17 +2,37 @@
 
 package storage
 
-import "os"
+import (
+	"fmt"
+	"os"
+	"time"
+)
 
+// lockTimeout is how long lock waits for another process to release a lock file
+const lockTimeout = 10 * time.Second
+
+// lock creates the lock file exclusively, waiting while another process holds it.
+// Without flock the file's existence is the lock, so it is removed on unlock.
 func lock(path string) (*os.File, error) {
 	lockFile := path + ".lock"
-	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
-	if err != nil {
-		return nil, err
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+		if err == nil {
+			return f, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("unable to lock %s: %s exists; remove it if no other kitkat process is running", path, lockFile)
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
-	return f, nil
 }
 
+// unlock releases the lock by removing the lock file
 func unlock(f *os.File) {
 	f.Close()
+	os.Remove(f.Name())
 }
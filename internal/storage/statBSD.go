@@ -0,0 +1,17 @@
+//go:build darwin || freebsd
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// statExtra returns the change time and inode number of a file
+func statExtra(info os.FileInfo) (ctime int64, inode uint64) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0
+	}
+	return st.Ctimespec.Nano(), uint64(st.Ino)
+}
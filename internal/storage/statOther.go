@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package storage
+
+import "os"
+
+// statExtra returns zeros where change times and inode numbers are unavailable;
+// size, mtime and mode still detect modifications
+func statExtra(info os.FileInfo) (ctime int64, inode uint64) {
+	return 0, 0
+}
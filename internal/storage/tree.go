@@ -8,13 +8,20 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 )
 
+// TreeEntry is a file recorded in a tree object
+type TreeEntry struct {
+	Hash string
+	Mode uint32 // ModeRegular, ModeExecutable or ModeSymlink
+}
+
 // CreateTree creates a tree object from the current index and stores it
 // It ensures the process is deterministic by sorting the file paths
 func CreateTree() (string, error) {
-	index, err := LoadIndex()
+	index, err := LoadIndexEntries()
 	if err != nil {
 		return "", err
 	}
@@ -28,10 +35,16 @@ func CreateTree() (string, error) {
 	}
 	sort.Strings(keys)
 
-	// Iterate over the sorted keys to build the tree content
+	// Iterate over the sorted keys to build the tree content.
+	// Regular files keep the original "hash path" form so existing trees hash
+	// the same; other modes are written as "mode hash path".
 	for _, path := range keys {
-		hash := index[path]
-		treeContent.WriteString(fmt.Sprintf("%s %s\n", hash, path))
+		entry := index[path]
+		if mode := normalizeMode(entry.Mode); mode != ModeRegular {
+			treeContent.WriteString(fmt.Sprintf("%06o %s %s\n", mode, entry.Hash, path))
+			continue
+		}
+		treeContent.WriteString(fmt.Sprintf("%s %s\n", entry.Hash, path))
 	}
 
 	// Hash the deterministic tree content to get the tree's hash
@@ -51,7 +64,20 @@ func CreateTree() (string, error) {
 // ParseTree reads a tree object from storage and returns it as a map of path -> hash
 // This is the function that was missing
 func ParseTree(hash string) (map[string]string, error) {
-	tree := make(map[string]string)
+	entries, err := ParseTreeEntries(hash)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]string, len(entries))
+	for path, entry := range entries {
+		tree[path] = entry.Hash
+	}
+	return tree, nil
+}
+
+// ParseTreeEntries reads a tree object from storage and returns its entries by path
+func ParseTreeEntries(hash string) (map[string]TreeEntry, error) {
+	tree := make(map[string]TreeEntry)
 	objectPath := filepath.Join(objectsDir, hash)
 	data, err := os.ReadFile(objectPath)
 	if err != nil {
@@ -61,11 +87,22 @@ func ParseTree(hash string) (map[string]string, error) {
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
 		line := scanner.Text()
+		entry := TreeEntry{Mode: ModeRegular}
+		// Non-regular files carry a six digit octal mode before the hash
+		if len(line) > 7 && line[6] == ' ' {
+			mode, err := strconv.ParseUint(line[:6], 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("malformed tree entry: %s", line)
+			}
+			entry.Mode = normalizeMode(uint32(mode))
+			line = line[7:]
+		}
 		// The format is "hash path", so we split on the first space
 		parts := strings.SplitN(line, " ", 2)
 		if len(parts) == 2 {
 			// The hash is parts[0], the path is parts[1]
-			tree[parts[1]] = parts[0]
+			entry.Hash = parts[0]
+			tree[parts[1]] = entry
 		}
 	}
 